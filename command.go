@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/strm"
+)
+
+// runCommand 执行子命令, 返回进程退出码
+//
+// 支持的子命令:
+//
+//	strm sync [任务名称...]  根据 strm-sync 配置同步 strm 媒体库, 不传递任务名称时同步所有任务
+func runCommand(args []string) int {
+	switch {
+	case len(args) >= 2 && args[0] == "strm" && args[1] == "sync":
+		if err := strm.SyncAll(args[2:]); err != nil {
+			logger.Error(err.Error())
+			return 1
+		}
+		return 0
+	default:
+		logger.Errorf("不支持的命令: %s", strings.Join(args, " "))
+		return 2
+	}
+}
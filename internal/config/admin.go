@@ -0,0 +1,20 @@
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+// Admin 管理接口配置
+type Admin struct {
+	Enable bool   `yaml:"enable"` // 是否启用管理接口
+	Token  string `yaml:"token"`  // 访问管理接口的密钥
+}
+
+func (a *Admin) Init() error {
+	a.Token = strings.TrimSpace(a.Token)
+	if a.Enable && a.Token == "" {
+		return errors.New("admin.token 配置不能为空")
+	}
+	return nil
+}
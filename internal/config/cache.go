@@ -2,9 +2,12 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/maps"
 )
 
 // durationMap 字符串配置映射成 time.Duration
@@ -15,38 +18,178 @@ var durationMap = map[string]time.Duration{
 	"s": time.Second,
 }
 
+// CacheStorage 缓存存储方式
+type CacheStorage string
+
+const (
+	CacheStorageMemory CacheStorage = "memory" // 只存放在内存中, 重启后丢失
+	CacheStorageDisk   CacheStorage = "disk"   // 同步持久化到磁盘中, 重启后自动加载
+)
+
+// validCacheStorage 用于校验用户配置的存储方式是否合法
+var validCacheStorage = map[CacheStorage]struct{}{
+	CacheStorageMemory: {}, CacheStorageDisk: {},
+}
+
+// sizeUnitMap 字符串配置映射成字节数
+var sizeUnitMap = map[string]int64{
+	"B":  1,
+	"KB": 1024,
+	"MB": 1024 * 1024,
+	"GB": 1024 * 1024 * 1024,
+}
+
+const (
+	// DefaultCacheDir 默认的磁盘缓存目录名称
+	DefaultCacheDir = "cache-data"
+
+	// DefaultCacheMaxSize 默认的缓存最大大小
+	DefaultCacheMaxSize = "100MB"
+
+	// DefaultCacheMaxEntries 默认最多缓存多少个请求信息
+	DefaultCacheMaxEntries = 8092
+)
+
 type Cache struct {
-	Enable  bool          `yaml:"enable"`  // 是否启用缓存
-	Expired string        `yaml:"expired"` // 缓存过期时间
-	expired time.Duration // 配置初始化转换之后的标准时间对象
+	Enable     bool          `yaml:"enable"`      // 是否启用缓存
+	Expired    string        `yaml:"expired"`     // 缓存过期时间
+	Storage    CacheStorage  `yaml:"storage"`     // 缓存存储方式
+	Dir        string        `yaml:"dir"`         // 磁盘缓存目录, 相对路径基于配置文件所在目录
+	MaxSize    string        `yaml:"max-size"`    // 缓存最大大小, 只统计响应体大小, 支持单位: B, KB, MB, GB
+	MaxEntries int           `yaml:"max-entries"` // 最多缓存多少个请求信息
+	Rules      []*CacheRule  `yaml:"rules"`       // 路由缓存规则, 自上而下匹配第一个符合的规则
+	expired    time.Duration // 配置初始化转换之后的标准时间对象
+	maxSize    int64         // 配置初始化转换之后的字节数
+}
+
+// DirPath 获取磁盘缓存目录的绝对路径
+func (c *Cache) DirPath() string {
+	if filepath.IsAbs(c.Dir) {
+		return c.Dir
+	}
+	return filepath.Join(BasePath, c.Dir)
 }
 
 func (c *Cache) ExpiredDuration() time.Duration {
 	return c.expired
 }
 
+// parseDuration 将带单位的时间字符串转换成 time.Duration, 如: 10m, 12h, 30d
+func parseDuration(d string) (time.Duration, error) {
+	d = strings.TrimSpace(d)
+	if len(d) < 2 {
+		return 0, fmt.Errorf("格式错误: %s", d)
+	}
+	timeFlag := d[len(d)-1:]
+	duration, ok := durationMap[timeFlag]
+	if !ok {
+		return 0, fmt.Errorf("%s, 支持的时间单位: s, m, h, d", timeFlag)
+	}
+	base, err := strconv.Atoi(d[:len(d)-1])
+	if err != nil {
+		return 0, err
+	}
+	if base < 1 {
+		return 0, fmt.Errorf("%d, 值需大于 0", base)
+	}
+	return time.Duration(base) * duration, nil
+}
+
+// MatchRule 获取第一个匹配 uri 的缓存规则
+func (c *Cache) MatchRule(uri string) (*CacheRule, bool) {
+	for _, rule := range c.Rules {
+		if rule.reg.MatchString(uri) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// MaxSizeBytes 缓存最大大小 (Byte)
+func (c *Cache) MaxSizeBytes() int64 {
+	return c.maxSize
+}
+
+// parseSize 将带单位的大小字符串转换成字节数, 如: 100MB, 1GB
+func parseSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	numEnd := strings.IndexFunc(size, func(r rune) bool { return r < '0' || r > '9' })
+	if numEnd == -1 {
+		numEnd = len(size)
+	}
+	if numEnd == 0 {
+		return 0, fmt.Errorf("缺少数值: %s", size)
+	}
+
+	unit := strings.TrimSpace(size[numEnd:])
+	if unit == "" {
+		unit = "B"
+	}
+	multiple, ok := sizeUnitMap[unit]
+	if !ok {
+		return 0, fmt.Errorf("不支持的单位: %s, 支持的单位: B, KB, MB, GB", unit)
+	}
+
+	base, err := strconv.ParseInt(size[:numEnd], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if base < 1 {
+		return 0, fmt.Errorf("值需大于 0: %d", base)
+	}
+	return base * multiple, nil
+}
+
 func (c *Cache) Init() error {
 	if len(c.Expired) == 0 {
 		// 缓存默认过期时间一天
 		c.expired = time.Hour * 24
 	} else {
-		timeFlag := c.Expired[len(c.Expired)-1:]
-		duration, ok := durationMap[timeFlag]
-		if !ok {
-			return fmt.Errorf("cache.expired 配置错误: %s, 支持的时间单位: s, m, h, d", timeFlag)
-		}
-		base, err := strconv.Atoi(c.Expired[:len(c.Expired)-1])
+		expired, err := parseDuration(c.Expired)
 		if err != nil {
 			return fmt.Errorf("cache.expired 配置错误: %v", err)
 		}
-		if base < 1 {
-			return fmt.Errorf("cache.exipred 配置错误: %d, 值需大于 0", base)
+		c.expired = expired
+	}
+
+	c.Storage = CacheStorage(strings.TrimSpace(string(c.Storage)))
+	if c.Storage == "" {
+		c.Storage = CacheStorageMemory
+	}
+	if _, ok := validCacheStorage[c.Storage]; !ok {
+		return fmt.Errorf("cache.storage 配置错误, 有效值: %v", maps.Keys(validCacheStorage))
+	}
+	if c.Dir = strings.TrimSpace(c.Dir); c.Dir == "" {
+		c.Dir = DefaultCacheDir
+	}
+
+	if strings.TrimSpace(c.MaxSize) == "" {
+		c.MaxSize = DefaultCacheMaxSize
+	}
+	maxSize, err := parseSize(c.MaxSize)
+	if err != nil {
+		return fmt.Errorf("cache.max-size 配置错误: %v", err)
+	}
+	c.maxSize = maxSize
+
+	if c.MaxEntries == 0 {
+		c.MaxEntries = DefaultCacheMaxEntries
+	}
+	if c.MaxEntries < 0 {
+		return fmt.Errorf("cache.max-entries 配置错误: %d, 值需大于 0", c.MaxEntries)
+	}
+
+	for i, rule := range c.Rules {
+		if rule == nil {
+			return fmt.Errorf("cache.rules[%d] 配置错误: 规则不能为空", i)
+		}
+		if err := rule.Init(); err != nil {
+			return fmt.Errorf("cache.rules[%d] 配置错误: %v", i, err)
 		}
-		c.expired = time.Duration(base) * duration
 	}
 
 	if c.Enable {
-		log.Println("缓存中间件已启用, 过期时间: ", c.Expired)
+		logger.Info("缓存中间件已启用", "expired", c.Expired, "storage", c.Storage)
 	}
 
 	return nil
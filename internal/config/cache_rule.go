@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/constant"
+)
+
+// cacheRouteNames 可以在缓存规则中直接引用的内置路由名称
+//
+// 名称对应 constant 包中 Reg_ 开头的正则表达式, 配置时可省略 Reg_ 前缀
+var cacheRouteNames = map[string]string{
+	"PlaybackInfo":             constant.Reg_PlaybackInfo,
+	"UserItems":                constant.Reg_UserItems,
+	"UserEpisodeItems":         constant.Reg_UserEpisodeItems,
+	"UserItemsRandomResort":    constant.Reg_UserItemsRandomResort,
+	"UserItemsRandomWithLimit": constant.Reg_UserItemsRandomWithLimit,
+	"UserPlayedItems":          constant.Reg_UserPlayedItems,
+	"UserLatestItems":          constant.Reg_UserLatestItems,
+	"ShowEpisodes":             constant.Reg_ShowEpisodes,
+	"VideoSubtitles":           constant.Reg_VideoSubtitles,
+	"ResourceStream":           constant.Reg_ResourceStream,
+	"ResourceMaster":           constant.Reg_ResourceMaster,
+	"ResourceMain":             constant.Reg_ResourceMain,
+	"ProxyMaster":              constant.Reg_ProxyMaster,
+	"ProxyPlaylist":            constant.Reg_ProxyPlaylist,
+	"ProxyDash":                constant.Reg_ProxyDash,
+	"ProxyTs":                  constant.Reg_ProxyTs,
+	"ProxySubtitle":            constant.Reg_ProxySubtitle,
+	"ItemDownload":             constant.Reg_ItemDownload,
+	"ItemSyncDownload":         constant.Reg_ItemSyncDownload,
+	"Images":                   constant.Reg_Images,
+}
+
+// CacheRule 路由缓存规则
+type CacheRule struct {
+	// Route 路由, 可以是内置的路由名称 (如: PlaybackInfo), 也可以是自定义的正则表达式
+	Route string `yaml:"route"`
+	// Expired 缓存过期时间, 为空时使用接口默认的缓存时间
+	Expired string `yaml:"expired"`
+	// Enable 是否缓存匹配的路由, 默认为 true
+	Enable *bool `yaml:"enable"`
+
+	reg     *regexp.Regexp // 路由编译之后的正则表达式
+	expired time.Duration  // 配置初始化转换之后的标准时间对象
+}
+
+func (r *CacheRule) Init() error {
+	r.Route = strings.TrimSpace(r.Route)
+	if r.Route == "" {
+		return fmt.Errorf("route 不能为空")
+	}
+
+	pattern, ok := cacheRouteNames[strings.TrimPrefix(r.Route, "Reg_")]
+	if !ok {
+		pattern = r.Route
+	}
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("route 正则表达式编译失败: %s, err: %v", r.Route, err)
+	}
+	r.reg = reg
+
+	if strings.TrimSpace(r.Expired) != "" {
+		expired, err := parseDuration(r.Expired)
+		if err != nil {
+			return fmt.Errorf("expired 配置错误: %v", err)
+		}
+		r.expired = expired
+	}
+
+	if r.Enable == nil {
+		enable := true
+		r.Enable = &enable
+	}
+	return nil
+}
+
+// Enabled 匹配规则的路由是否需要缓存
+func (r *CacheRule) Enabled() bool {
+	return r.Enable == nil || *r.Enable
+}
+
+// ExpiredDuration 规则配置的缓存时间, 未配置时返回 0
+func (r *CacheRule) ExpiredDuration() time.Duration {
+	return r.expired
+}
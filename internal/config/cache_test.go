@@ -0,0 +1,54 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+func TestCacheMatchRule(t *testing.T) {
+	disable := false
+	c := config.Cache{
+		Rules: []*config.CacheRule{
+			{Route: "Reg_ResourceStream", Expired: "2h"},
+			{Route: "PlaybackInfo", Enable: &disable},
+			{Route: `(?i)^/.*users/.*/views`, Expired: "10m"},
+		},
+	}
+	if err := c.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		uri     string
+		match   bool
+		enabled bool
+		expired time.Duration
+	}{
+		{name: "builtin-with-prefix", uri: "/emby/videos/1/stream.mkv?MediaSourceId=1", match: true, enabled: true, expired: time.Hour * 2},
+		{name: "builtin-disable", uri: "/emby/Items/1/PlaybackInfo?UserId=1", match: true, enabled: false},
+		{name: "custom-regex", uri: "/emby/Users/1/Views", match: true, enabled: true, expired: time.Minute * 10},
+		{name: "no-match", uri: "/emby/System/Info"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := c.MatchRule(tt.uri)
+			if ok != tt.match {
+				t.Fatalf("MatchRule() match = %v, want %v", ok, tt.match)
+			}
+			if !ok {
+				return
+			}
+			if rule.Enabled() != tt.enabled || rule.ExpiredDuration() != tt.expired {
+				t.Errorf("rule = %s, enabled: %v, expired: %v", rule.Route, rule.Enabled(), rule.ExpiredDuration())
+			}
+		})
+	}
+
+	bad := config.Cache{Rules: []*config.CacheRule{{Route: "PlaybackInfo", Expired: "2x"}}}
+	if err := bad.Init(); err == nil {
+		t.Error("Init() expect error with invalid expired")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sync/atomic"
 
 	"gopkg.in/yaml.v3"
 )
@@ -24,14 +25,39 @@ type Config struct {
 	Ssl *Ssl `yaml:"ssl"`
 	// Log 日志相关配置
 	Log *Log `yaml:"log"`
+	// Admin 管理接口相关配置
+	Admin *Admin `yaml:"admin"`
+	// StrmSync strm 媒体库同步相关配置
+	StrmSync *StrmSync `yaml:"strm-sync"`
+	// Prefetch 下一集预取相关配置
+	Prefetch *Prefetch `yaml:"prefetch"`
+	// ProxyStream 代理传输相关配置
+	ProxyStream *ProxyStream `yaml:"proxy-stream"`
 }
 
-// C 全局唯一配置对象
-var C *Config
+// current 全局唯一配置对象
+//
+// 配置热重载时, 会整体替换为一个新的对象, 不会在原对象上修改
+var current atomic.Pointer[Config]
+
+// C 获取当前生效的全局配置
+//
+// 同一个请求内需要多次读取配置时, 应先保存返回值, 避免前后读到不同版本的配置
+func C() *Config {
+	return current.Load()
+}
+
+// Set 直接替换全局配置, 不会触发重载回调, 主要用于测试
+func Set(c *Config) {
+	current.Store(c)
+}
 
 // BasePath 配置文件所在的基础路径
 var BasePath string
 
+// configPath 当前加载的配置文件路径, 用于热重载
+var configPath string
+
 type Initializer interface {
 	// Init 配置初始化
 	Init() error
@@ -39,21 +65,46 @@ type Initializer interface {
 
 // ReadFromFile 从指定文件中读取配置
 func ReadFromFile(path string) error {
-	bytes, err := os.ReadFile(path)
+	basePath, err := resolveBasePath(path)
 	if err != nil {
-		return fmt.Errorf("读取配置文件失败: %v", err)
+		return fmt.Errorf("初始化 BasePath 失败: %v", err)
 	}
 
-	if err = initBasePath(path); err != nil {
-		return fmt.Errorf("初始化 BasePath 失败: %v", err)
+	// 配置项中的相对路径基于 BasePath 解析, 校验前需要先设置, 失败时还原
+	oldBasePath := BasePath
+	BasePath = basePath
+	newC, err := load(path)
+	if err == nil {
+		err = newC.Log.Apply()
+	}
+	if err != nil {
+		BasePath = oldBasePath
+		return err
+	}
+	configPath = path
+	current.Store(newC)
+	return nil
+}
+
+// load 读取并校验配置文件, 返回一个全新的配置对象
+//
+// 只做校验, 不会对全局配置, BasePath 以及日志设置产生影响,
+// 配置项中的相对路径基于当前的 BasePath 解析
+func load(path string) (*Config, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
 	}
 
-	C = new(Config)
-	if err := yaml.Unmarshal(bytes, C); err != nil {
-		return fmt.Errorf("解析配置文件失败: %v", err)
+	newC := new(Config)
+	if err := yaml.Unmarshal(bytes, newC); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	if err := applyEnv(newC); err != nil {
+		return nil, err
 	}
 
-	cVal := reflect.ValueOf(C).Elem()
+	cVal := reflect.ValueOf(newC).Elem()
 	for i := 0; i < cVal.NumField(); i++ {
 		field := cVal.Field(i)
 
@@ -66,24 +117,22 @@ func ReadFromFile(path string) error {
 		// 配置项初始化
 		if i, ok := field.Interface().(Initializer); ok {
 			if err := i.Init(); err != nil {
-				return fmt.Errorf("初始化配置文件失败: %v", err)
+				return nil, fmt.Errorf("初始化配置文件失败: %v", err)
 			}
 		}
 	}
 
-	return nil
+	return newC, nil
 }
 
-// initBasePath 初始化 BasePath
-func initBasePath(path string) error {
+// resolveBasePath 计算配置文件所在的基础路径
+func resolveBasePath(path string) (string, error) {
 	if filepath.IsAbs(path) {
-		BasePath = filepath.Dir(path)
-		return nil
+		return filepath.Dir(path), nil
 	}
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return err
+		return "", err
 	}
-	BasePath = filepath.Dir(absPath)
-	return nil
+	return filepath.Dir(absPath), nil
 }
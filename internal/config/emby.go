@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/maps"
@@ -10,6 +11,19 @@ import (
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
 )
 
+// ServerType 媒体服务器类型
+type ServerType string
+
+const (
+	ServerTypeEmby     ServerType = "emby"     // Emby
+	ServerTypeJellyfin ServerType = "jellyfin" // Jellyfin
+)
+
+// validServerType 用于校验用户配置的服务器类型是否合法
+var validServerType = map[ServerType]struct{}{
+	ServerTypeEmby: {}, ServerTypeJellyfin: {},
+}
+
 // PeStrategy 代理异常策略类型
 type PeStrategy string
 
@@ -41,6 +55,8 @@ var validDlStrategy = map[DlStrategy]struct{}{
 type Emby struct {
 	// Emby 源服务器地址
 	Host string `yaml:"host"`
+	// ServerType 源服务器类型, 默认为 emby
+	ServerType ServerType `yaml:"server-type"`
 	// rclone 或者 cd 的挂载目录
 	MountPath string `yaml:"mount-path"`
 	// EpisodesUnplayPrior 在获取剧集列表时是否将未播资源优先展示
@@ -57,15 +73,31 @@ type Emby struct {
 	DownloadStrategy DlStrategy `yaml:"download-strategy"`
 	// LocalMediaRoot 本地媒体根路径
 	LocalMediaRoot string `yaml:"local-media-root"`
+	// Upstreams 多个上游媒体服务器, 配置后根据请求的 Host, 监听端口或路径前缀选择上游
+	Upstreams []*EmbyUpstream `yaml:"upstreams"`
+
+	// upstreams 初始化后的所有上游服务器
+	upstreams []*EmbyUpstream
+	// defaultUpstream 没有匹配到任何上游时使用的默认上游
+	defaultUpstream *EmbyUpstream
 }
 
 func (e *Emby) Init() error {
-	if strs.AnyEmpty(e.Host) {
-		return errors.New("emby.host 配置不能为空")
+	if len(e.Upstreams) == 0 {
+		if strs.AnyEmpty(e.Host) {
+			return errors.New("emby.host 配置不能为空")
+		}
+		if strs.AnyEmpty(e.MountPath) {
+			return errors.New("emby.mount-path 配置不能为空")
+		}
+	}
+	if e.ServerType = ServerType(strings.TrimSpace(string(e.ServerType))); e.ServerType == "" {
+		e.ServerType = ServerTypeEmby
 	}
-	if strs.AnyEmpty(e.MountPath) {
-		return errors.New("emby.mount-path 配置不能为空")
+	if _, ok := validServerType[e.ServerType]; !ok {
+		return fmt.Errorf("emby.server-type 配置错误, 有效值: %v", maps.Keys(validServerType))
 	}
+
 	if strs.AnyEmpty(string(e.ProxyErrorStrategy)) {
 		// 失败默认回源
 		e.ProxyErrorStrategy = PeStrategyOrigin
@@ -105,27 +137,93 @@ func (e *Emby) Init() error {
 		e.LocalMediaRoot = "/" + randoms.RandomHex(32)
 	}
 
-	return nil
+	return e.initUpstreams()
+}
+
+// StrmRuleType strm 路径映射规则类型
+type StrmRuleType string
+
+const (
+	StrmRuleContains StrmRuleType = "contains" // 包含匹配, 替换路径中第一个匹配的片段
+	StrmRulePrefix   StrmRuleType = "prefix"   // 前缀匹配, 只替换路径的前缀
+	StrmRuleRegex    StrmRuleType = "regex"    // 正则匹配, 支持使用 $1 ${name} 等形式引用捕获组
+)
+
+// strmRulePrefixes 映射规则的类型标记前缀, 没有标记的规则默认为包含匹配
+var strmRulePrefixes = map[string]StrmRuleType{
+	"prefix:": StrmRulePrefix,
+	"regex:":  StrmRuleRegex,
+}
+
+// strmRegexHints 出现在没有标记的匹配片段中时, 说明规则很可能是漏写了 regex: 标记的正则表达式
+//
+// 不包含 . ( ) [ ] 等在路径中也很常见的字符, 避免误报
+var strmRegexHints = []string{`\`, ".*", ".+", "|", "{"}
+
+// strmGroupRefReg 替换片段中引用捕获组的写法, 如: $1 ${name}
+var strmGroupRefReg = regexp.MustCompile(`\$(\d|\{)`)
+
+// looksLikeRegex 判断没有标记的规则是否像一个正则表达式规则
+func looksLikeRegex(from, to string) bool {
+	if strings.HasPrefix(from, "^") || strings.HasSuffix(from, "$") {
+		return true
+	}
+	for _, hint := range strmRegexHints {
+		if strings.Contains(from, hint) {
+			return true
+		}
+	}
+	return strmGroupRefReg.MatchString(to)
 }
 
 // Strm strm 配置
 type Strm struct {
 	// PathMap 远程路径映射
 	PathMap []string `yaml:"path-map"`
-	// pathMap 配置初始化后转换为标准的 map 结构
-	pathMap map[string]string
+	// rules 配置初始化后转换为有序的映射规则列表
+	rules []strmRule
+}
+
+// strmRule strm 路径映射规则
+type strmRule struct {
+	typ  StrmRuleType   // 规则类型
+	from string         // 匹配片段
+	to   string         // 替换片段
+	reg  *regexp.Regexp // 正则匹配规则编译后的表达式
 }
 
 // Init 配置初始化
 func (s *Strm) Init() error {
-	s.pathMap = make(map[string]string)
+	s.rules = make([]strmRule, 0, len(s.PathMap))
 	for _, path := range s.PathMap {
 		splits := strings.Split(path, "=>")
 		if len(splits) != 2 {
 			return fmt.Errorf("映射配置不规范: %s, 请使用 => 进行分割", path)
 		}
-		from, to := strings.TrimSpace(splits[0]), strings.TrimSpace(splits[1])
-		s.pathMap[from] = to
+		rule := strmRule{typ: StrmRuleContains, from: strings.TrimSpace(splits[0]), to: strings.TrimSpace(splits[1])}
+
+		for prefix, typ := range strmRulePrefixes {
+			if strings.HasPrefix(rule.from, prefix) {
+				rule.typ = typ
+				rule.from = strings.TrimSpace(strings.TrimPrefix(rule.from, prefix))
+				break
+			}
+		}
+		if rule.from == "" {
+			return fmt.Errorf("映射配置不规范: %s, 匹配片段不能为空", path)
+		}
+		if rule.typ == StrmRuleContains && looksLikeRegex(rule.from, rule.to) {
+			logger.Warnf("映射配置 [%s] 没有类型标记, 将按照包含匹配处理, 如果是正则表达式, 请在开头加上 regex: 标记", path)
+		}
+
+		if rule.typ == StrmRuleRegex {
+			reg, err := regexp.Compile(rule.from)
+			if err != nil {
+				return fmt.Errorf("映射配置不规范: %s, 正则表达式编译失败: %v", path, err)
+			}
+			rule.reg = reg
+		}
+		s.rules = append(s.rules, rule)
 	}
 	return nil
 }
@@ -133,10 +231,33 @@ func (s *Strm) Init() error {
 // MapPath 将传入路径按照预配置的映射关系从上到下按顺序进行映射,
 // 至多成功映射一次
 func (s *Strm) MapPath(path string) string {
-	for from, to := range s.pathMap {
-		if strings.Contains(path, from) {
-			return strings.Replace(path, from, to, 1)
+	for _, rule := range s.rules {
+		if res, ok := rule.apply(path); ok {
+			return res
 		}
 	}
 	return path
 }
+
+// apply 使用规则映射路径, 匹配失败时返回 false
+func (r strmRule) apply(path string) (string, bool) {
+	switch r.typ {
+	case StrmRulePrefix:
+		if strings.HasPrefix(path, r.from) {
+			return r.to + strings.TrimPrefix(path, r.from), true
+		}
+	case StrmRuleRegex:
+		// 只替换第一个匹配的片段
+		idx := r.reg.FindStringSubmatchIndex(path)
+		if idx == nil {
+			return "", false
+		}
+		dst := r.reg.ExpandString(nil, r.to, path, idx)
+		return path[:idx[0]] + string(dst) + path[idx[1]:], true
+	default:
+		if strings.Contains(path, r.from) {
+			return strings.Replace(path, r.from, r.to, 1), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestLooksLikeRegex(t *testing.T) {
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{rule: `^https://(\w+)\.cdn\.com/(.*) => http://local/$1/$2`, want: true},
+		{rule: `/movie/\d{1,3}/ => /movie/`, want: true},
+		{rule: `/a.mkv => /b/${name}`, want: true},
+		{rule: `https://cdn.example.com => http://localhost:5244`, want: false},
+		{rule: `/电影/[VCB-Studio] 孤独摇滚 (2022)/ => /anime/`, want: false},
+	}
+	for _, tt := range tests {
+		s := Strm{PathMap: []string{tt.rule}}
+		if err := s.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if got := looksLikeRegex(s.rules[0].from, s.rules[0].to); got != tt.want {
+			t.Errorf("looksLikeRegex(%s) = %v, want: %v", tt.rule, got, tt.want)
+		}
+	}
+}
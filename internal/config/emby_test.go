@@ -0,0 +1,111 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+func TestStrmMapPath(t *testing.T) {
+	pathMap := []string{
+		"regex:^https://(\\w+)\\.cdn\\.com/(.*) => http://local/$1/$2",
+		"prefix:https://test-res.com:8094 => http://localhost:8095",
+		"https://test-res.com => http://first-contains",
+		"12138 => 10086",
+		"test-res => http://never-reached",
+	}
+	s := config.Strm{PathMap: pathMap}
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "regex", path: "https://movie.cdn.com/a/1.mp4", want: "http://local/movie/a/1.mp4"},
+		{name: "prefix", path: "https://test-res.com:8094/1.mp4", want: "http://localhost:8095/1.mp4"},
+		{name: "prefix-not-at-start", path: "http://proxy/https://test-res.com:8094/1.mp4", want: "http://proxy/http://first-contains:8094/1.mp4"},
+		{name: "first-match-wins", path: "https://test-res.com:12138/test-id-12138.mp4", want: "http://first-contains:12138/test-id-12138.mp4"},
+		{name: "contains-replace-once", path: "http://a.com:12138/12138.mp4", want: "http://a.com:10086/12138.mp4"},
+		{name: "no-match", path: "http://other.com/1.mp4", want: "http://other.com/1.mp4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 多次映射, 确保结果稳定
+			for range 20 {
+				if got := s.MapPath(tt.path); got != tt.want {
+					t.Fatalf("MapPath() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStrmInitError(t *testing.T) {
+	tests := []struct {
+		name    string
+		pathMap []string
+	}{
+		{name: "no-separator", pathMap: []string{"a -> b"}},
+		{name: "empty-from", pathMap: []string{"prefix: => b"}},
+		{name: "bad-regex", pathMap: []string{"regex:^(a => b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := config.Strm{PathMap: tt.pathMap}
+			if err := s.Init(); err == nil {
+				t.Errorf("Init() expect error, pathMap: %v", tt.pathMap)
+			}
+		})
+	}
+}
+
+func TestSelectUpstream(t *testing.T) {
+	e := config.Emby{
+		Host:      "http://adults:8096",
+		MountPath: "/data",
+		Upstreams: []*config.EmbyUpstream{
+			{Name: "adults", Host: "http://adults:8096"},
+			{Name: "kids", Host: "http://kids:8096", MountPath: "/kids", Match: &config.UpstreamMatch{
+				Hosts: []string{"kids.example.com"}, Ports: []string{"8097"}, PathPrefix: "/kids/",
+			}},
+			{Name: "kids-tv", Host: "http://kids-tv:8096", Match: &config.UpstreamMatch{PathPrefix: "/kids/tv"}},
+		},
+	}
+	if err := e.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		host, port string
+		path       string
+		want       string
+		wantPrefix string
+	}{
+		{name: "default", host: "ge2o:8095", port: "8095", path: "/emby/Items", want: "adults"},
+		{name: "host", host: "kids.example.com:8095", port: "8095", path: "/emby/Items", want: "kids"},
+		{name: "port", host: "ge2o:8097", port: "8097", path: "/emby/Items", want: "kids"},
+		{name: "prefix", host: "ge2o:8095", port: "8095", path: "/kids/emby/Items", want: "kids", wantPrefix: "/kids"},
+		{name: "longest-prefix", host: "ge2o:8095", port: "8095", path: "/kids/tv/emby/Items", want: "kids-tv", wantPrefix: "/kids/tv"},
+		{name: "prefix-boundary", host: "ge2o:8095", port: "8095", path: "/kidsfoo/emby", want: "adults"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, prefix := e.SelectUpstream(tt.host, tt.port, tt.path)
+			if u.Name != tt.want || prefix != tt.wantPrefix {
+				t.Errorf("SelectUpstream() = (%s, %q), want (%s, %q)", u.Name, prefix, tt.want, tt.wantPrefix)
+			}
+		})
+	}
+
+	// 未配置的项继承全局配置
+	if kids := e.AllUpstreams()[1]; kids.MountPath != "/kids" || e.AllUpstreams()[0].MountPath != "/data" {
+		t.Errorf("mount-path 继承错误: %s, %s", e.AllUpstreams()[0].MountPath, kids.MountPath)
+	}
+	if got := e.ListenPorts(); len(got) != 1 || got[0] != "8097" {
+		t.Errorf("ListenPorts() = %v, want [8097]", got)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix 覆盖配置项的环境变量前缀
+const EnvPrefix = "GE2O_"
+
+// applyEnv 使用环境变量覆盖配置文件中的配置项
+//
+// 环境变量名由 GE2O_ 前缀加上配置项的 yaml 路径组成, 路径分隔符以及 '-' 统一转换为 '_' 并大写,
+// 如: emby.host => GE2O_EMBY_HOST, emby.strm.path-map => GE2O_EMBY_STRM_PATH_MAP
+//
+// 切片类型的配置项需要使用 yaml 的行内数组写法设置多个值, 如: ["/movie:/电影", "/tv:/电视剧"],
+// 不以 '[' 开头的值整体作为切片中的唯一一个元素, 不会按照 ',' 分割
+func applyEnv(c *Config) error {
+	return applyEnvStruct(reflect.ValueOf(c).Elem(), strings.TrimSuffix(EnvPrefix, "_"))
+}
+
+// applyEnvStruct 递归遍历结构体的配置项, 使用环境变量进行覆盖
+func applyEnvStruct(sv reflect.Value, prefix string) error {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		fieldType := st.Field(i)
+		field := sv.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		tag := strings.Split(fieldType.Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(strings.ReplaceAll(tag, "-", "_"))
+
+		// 嵌套的配置结构, 只有存在相关的环境变量时才初始化
+		if field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct {
+			if !hasEnvPrefix(name + "_") {
+				continue
+			}
+			if field.IsNil() {
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			if err := applyEnvStruct(field.Elem(), name); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.Kind() == reflect.Struct {
+			if err := applyEnvStruct(field, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(field, value); err != nil {
+			return fmt.Errorf("环境变量 %s 覆盖配置失败: %v", name, err)
+		}
+		logger.Debugf("使用环境变量覆盖配置项: %s", name)
+	}
+	return nil
+}
+
+// setEnvValue 将环境变量的值转换为配置项的类型并写入
+func setEnvValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+
+	// 字符串切片的多个值只能使用 yaml 行内数组写法,
+	// 不以 '[' 开头时整体作为一个值, 避免按照 ',' 分割时截断 \d{1,3} 之类的正则规则
+	trimVal := strings.TrimSpace(value)
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String && !strings.HasPrefix(trimVal, "[") {
+		items := reflect.MakeSlice(field.Type(), 0, 1)
+		if trimVal != "" {
+			items = reflect.Append(items, reflect.ValueOf(trimVal).Convert(field.Type().Elem()))
+		}
+		field.Set(items)
+		return nil
+	}
+
+	// 其余类型交给 yaml 解析
+	ptr := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(trimVal), ptr.Interface()); err != nil {
+		return err
+	}
+	field.Set(ptr.Elem())
+	return nil
+}
+
+// hasEnvPrefix 判断是否存在以 prefix 开头的环境变量
+func hasEnvPrefix(prefix string) bool {
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, prefix) {
+			return true
+		}
+	}
+	return false
+}
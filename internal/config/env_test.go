@@ -0,0 +1,63 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+func TestEnvOverride(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "config.yml")
+	content := `
+emby:
+  host: http://localhost:8096
+  mount-path: /data
+  images-quality: 80
+openlist:
+  host: http://localhost:5244
+  token: token-in-file
+path:
+  emby2openlist:
+    - /movie:/电影
+`
+	if err := os.WriteFile(fp, []byte(content), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GE2O_EMBY_HOST", "http://emby:8096")
+	t.Setenv("GE2O_EMBY_IMAGES_QUALITY", "90")
+	t.Setenv("GE2O_EMBY_STRM_PATH_MAP", `regex:/S\d{1,3}/ => /Season/`)
+	t.Setenv("GE2O_OPENLIST_TOKEN", "token-in-env")
+	t.Setenv("GE2O_PATH_EMBY2OPENLIST", `["/tv:/电视剧", "/movie:/电影"]`)
+	t.Setenv("GE2O_CACHE_ENABLE", "true")
+
+	if err := config.ReadFromFile(fp); err != nil {
+		t.Fatal(err)
+	}
+
+	c := config.C()
+	if c.Emby.Host != "http://emby:8096" {
+		t.Errorf("emby.host = %s", c.Emby.Host)
+	}
+	if c.Emby.MountPath != "/data" {
+		t.Errorf("emby.mount-path = %s", c.Emby.MountPath)
+	}
+	if c.Emby.ImagesQuality != 90 {
+		t.Errorf("emby.images-quality = %d", c.Emby.ImagesQuality)
+	}
+	if want := []string{`regex:/S\d{1,3}/ => /Season/`}; !reflect.DeepEqual(c.Emby.Strm.PathMap, want) {
+		t.Errorf("emby.strm.path-map = %v, want %v", c.Emby.Strm.PathMap, want)
+	}
+	if c.Openlist.Token != "token-in-env" {
+		t.Errorf("openlist.token = %s", c.Openlist.Token)
+	}
+	if want := []string{"/tv:/电视剧", "/movie:/电影"}; !reflect.DeepEqual(c.Path.Emby2Openlist, want) {
+		t.Errorf("path.emby2openlist = %v, want %v", c.Path.Emby2Openlist, want)
+	}
+	if !c.Cache.Enable {
+		t.Error("cache.enable = false")
+	}
+}
@@ -1,18 +1,144 @@
 package config
 
-import "github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
+)
+
+// logger config 模块日志记录器
+var logger = logs.Module("config")
+
+const (
+	// DefaultLogFileMaxSize 默认的单个日志文件最大大小
+	DefaultLogFileMaxSize = "10MB"
+
+	// DefaultLogFileMaxAge 默认的日志文件保留时间
+	DefaultLogFileMaxAge = "7d"
+)
 
 // Log 日志配置
 type Log struct {
-	DisableColor bool `yaml:"disable-color"` // 是否禁用彩色日志输出
+	DisableColor bool              `yaml:"disable-color"` // 是否禁用彩色日志输出
+	Level        string            `yaml:"level"`         // 默认日志级别: debug, info, warn, error
+	Format       string            `yaml:"format"`        // 日志格式: text, json
+	File         *LogFile          `yaml:"file"`          // 日志文件输出配置
+	Modules      map[string]string `yaml:"modules"`       // 单独设置指定模块的日志级别
+
+	opts logs.Options // 校验通过后的日志参数, 由 Apply 应用
+}
+
+// LogFile 日志文件输出配置
+type LogFile struct {
+	Enable     bool   `yaml:"enable"`      // 是否输出到文件
+	Path       string `yaml:"path"`        // 日志文件路径, 相对路径基于配置文件所在目录
+	MaxSize    string `yaml:"max-size"`    // 单个日志文件的最大大小, 超出后进行切割
+	MaxAge     string `yaml:"max-age"`     // 切割后的日志文件保留时间
+	MaxBackups int    `yaml:"max-backups"` // 切割后的日志文件最多保留个数, 0 表示不限制
 }
 
 // Init 配置初始化
+//
+// 只做校验, 不会修改当前生效的日志设置, 需要调用 Apply 应用
 func (lc *Log) Init() error {
+	opts := logs.Options{
+		Level:   slog.LevelInfo,
+		Format:  strings.ToLower(strings.TrimSpace(lc.Format)),
+		Color:   lc.EnableColor(),
+		Modules: make(map[string]slog.Level, len(lc.Modules)),
+	}
+
+	if strings.TrimSpace(lc.Level) != "" {
+		level, err := logs.ParseLevel(lc.Level)
+		if err != nil {
+			return fmt.Errorf("log.level 配置错误: %v", err)
+		}
+		opts.Level = level
+	}
+
+	for module, l := range lc.Modules {
+		level, err := logs.ParseLevel(l)
+		if err != nil {
+			return fmt.Errorf("log.modules.%s 配置错误: %v", module, err)
+		}
+		opts.Modules[module] = level
+	}
+
+	if lc.File != nil && lc.File.Enable {
+		fo, err := lc.File.options()
+		if err != nil {
+			return err
+		}
+		opts.File = fo
+	}
+
+	if opts.Format == "" {
+		opts.Format = logs.FormatText
+	}
+	if opts.Format != logs.FormatText && opts.Format != logs.FormatJSON {
+		return fmt.Errorf("log.format 配置错误: %s, 支持的格式: %s, %s", opts.Format, logs.FormatText, logs.FormatJSON)
+	}
+
+	lc.opts = opts
+	return nil
+}
+
+// Apply 应用日志配置
+//
+// 应用失败时, 当前生效的日志设置保持不变
+func (lc *Log) Apply() error {
+	if err := logs.Setup(lc.opts); err != nil {
+		return fmt.Errorf("初始化日志失败: %v", err)
+	}
 	colors.SetEnabler(lc)
 	return nil
 }
 
+// options 转换成日志文件输出参数
+func (lf *LogFile) options() (*logs.FileOptions, error) {
+	if strings.TrimSpace(lf.Path) == "" {
+		return nil, errors.New("log.file.path 配置不能为空")
+	}
+	if lf.MaxSize == "" {
+		lf.MaxSize = DefaultLogFileMaxSize
+	}
+	if lf.MaxAge == "" {
+		lf.MaxAge = DefaultLogFileMaxAge
+	}
+	if lf.MaxBackups < 0 {
+		return nil, fmt.Errorf("log.file.max-backups 配置错误: %d, 值不能小于 0", lf.MaxBackups)
+	}
+
+	maxSize, err := parseSize(lf.MaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("log.file.max-size 配置错误: %v", err)
+	}
+	maxAge, err := parseDuration(lf.MaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("log.file.max-age 配置错误: %v", err)
+	}
+
+	return &logs.FileOptions{
+		Path:       lf.FilePath(),
+		MaxSize:    maxSize,
+		MaxAge:     maxAge,
+		MaxBackups: lf.MaxBackups,
+	}, nil
+}
+
+// FilePath 日志文件的绝对路径
+func (lf *LogFile) FilePath() string {
+	if filepath.IsAbs(lf.Path) {
+		return lf.Path
+	}
+	return filepath.Join(BasePath, lf.Path)
+}
+
 // EnableColor 标记是否启用颜色输出
 func (lc *Log) EnableColor() bool {
 	return !lc.DisableColor
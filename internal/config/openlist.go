@@ -1,12 +1,203 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
+)
+
+const (
+	// DefaultOpenlistBackendName 未配置 backends 时, 使用 host 等配置生成的默认后端名称
+	DefaultOpenlistBackendName = "default"
+
+	// DefaultOpenlistFailThreshold 默认的后端连续失败阈值
+	DefaultOpenlistFailThreshold = 3
+
+	// DefaultOpenlistCooldown 默认的后端不健康持续时间
+	DefaultOpenlistCooldown = "1m"
+)
+
 type Openlist struct {
 	// Token 访问 openlist 接口的密钥, 在 openlist 管理后台获取
 	Token string `yaml:"token"`
 	// Host openlist 访问地址（如果 openlist 使用本地代理模式, 则这个地址必须配置公网可访问地址）
 	Host string `yaml:"host"`
+	// Username openlist 登录用户名, 与 Password 同时配置时, 使用账号密码登录获取 token
+	Username string `yaml:"username"`
+	// Password openlist 登录密码
+	Password string `yaml:"password"`
+	// Backends 多个 openlist 后端, 配置后忽略上方的 host, token, username, password
+	Backends []*OpenlistBackend `yaml:"backends"`
+	// Failover 后端故障转移配置
+	Failover *OpenlistFailover `yaml:"failover"`
+
+	// backends 按照优先级排序后的所有后端
+	backends []*OpenlistBackend
+}
+
+// OpenlistBackend 单个 openlist 后端
+type OpenlistBackend struct {
+	// Name 后端名称, 用于日志和监控中区分后端, 为空时使用 Host
+	Name string `yaml:"name"`
+	// Host openlist 访问地址
+	Host string `yaml:"host"`
+	// Token 访问 openlist 接口的密钥
+	Token string `yaml:"token"`
+	// Username openlist 登录用户名, 与 Password 同时配置时, 使用账号密码登录获取 token
+	Username string `yaml:"username"`
+	// Password openlist 登录密码
+	Password string `yaml:"password"`
+	// Priority 优先级, 数值越小越优先使用
+	Priority int `yaml:"priority"`
+	// Paths 该后端负责的 openlist 路径前缀, 为空时负责所有路径
+	Paths []string `yaml:"paths"`
+}
+
+// OpenlistFailover 后端故障转移配置
+type OpenlistFailover struct {
+	// FailThreshold 后端连续失败多少次后被标记为不健康
+	FailThreshold int `yaml:"fail-threshold"`
+	// Cooldown 后端被标记为不健康后, 多久之后再重新尝试
+	Cooldown string `yaml:"cooldown"`
+
+	// cooldown 解析后的不健康持续时间
+	cooldown time.Duration
 }
 
 func (a *Openlist) Init() error {
+	if len(a.Backends) == 0 {
+		a.backends = []*OpenlistBackend{a.defaultBackend()}
+		if err := a.backends[0].check(); err != nil {
+			return fmt.Errorf("openlist 配置错误: %v", err)
+		}
+	} else {
+		names := make(map[string]struct{}, len(a.Backends))
+		for i, b := range a.Backends {
+			if b == nil {
+				return fmt.Errorf("openlist.backends[%d] 配置不能为空", i)
+			}
+			if strs.AnyEmpty(b.Host) {
+				return fmt.Errorf("openlist.backends[%d].host 配置不能为空", i)
+			}
+			if strs.AnyEmpty(b.Name) {
+				b.Name = b.Host
+			}
+			if _, ok := names[b.Name]; ok {
+				return fmt.Errorf("openlist.backends 名称重复: %s", b.Name)
+			}
+			names[b.Name] = struct{}{}
+			if err := b.check(); err != nil {
+				return fmt.Errorf("openlist.backends[%s] 配置错误: %v", b.Name, err)
+			}
+		}
+		a.backends = slices.Clone(a.Backends)
+		slices.SortStableFunc(a.backends, func(x, y *OpenlistBackend) int {
+			return x.Priority - y.Priority
+		})
+	}
+
+	if a.Failover == nil {
+		a.Failover = new(OpenlistFailover)
+	}
+	return a.Failover.init()
+}
+
+// defaultBackend 使用 host, token 等配置生成默认后端
+func (a *Openlist) defaultBackend() *OpenlistBackend {
+	return &OpenlistBackend{
+		Name:     DefaultOpenlistBackendName,
+		Host:     a.Host,
+		Token:    a.Token,
+		Username: a.Username,
+		Password: a.Password,
+	}
+}
+
+// AllBackends 按照优先级排序后的所有后端
+func (a *Openlist) AllBackends() []*OpenlistBackend {
+	if a.backends == nil {
+		return []*OpenlistBackend{a.defaultBackend()}
+	}
+	return a.backends
+}
+
+// BackendsFor 获取负责指定 openlist 路径的后端, 按照优先级排序
+//
+// path 为空时返回所有后端
+func (a *Openlist) BackendsFor(path string) []*OpenlistBackend {
+	all := a.AllBackends()
+	if path == "" {
+		return all
+	}
+	res := make([]*OpenlistBackend, 0, len(all))
+	for _, b := range all {
+		if b.Match(path) {
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+// check 校验后端配置
+func (b *OpenlistBackend) check() error {
+	if strs.AnyEmpty(b.Username) != strs.AnyEmpty(b.Password) {
+		return errors.New("username 和 password 需要同时配置")
+	}
+	return nil
+}
+
+// UseLogin 是否使用账号密码登录的方式获取 token
+func (b *OpenlistBackend) UseLogin() bool {
+	return strs.AllNotEmpty(b.Username, b.Password)
+}
+
+// Match 判断后端是否负责指定的 openlist 路径
+func (b *OpenlistBackend) Match(path string) bool {
+	if len(b.Paths) == 0 {
+		return true
+	}
+	for _, p := range b.Paths {
+		if path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *OpenlistFailover) init() error {
+	if f.FailThreshold == 0 {
+		f.FailThreshold = DefaultOpenlistFailThreshold
+	}
+	if f.FailThreshold < 0 {
+		return fmt.Errorf("openlist.failover.fail-threshold 配置错误: %d, 值需大于 0", f.FailThreshold)
+	}
+	if f.Cooldown == "" {
+		f.Cooldown = DefaultOpenlistCooldown
+	}
+	cooldown, err := parseDuration(f.Cooldown)
+	if err != nil {
+		return fmt.Errorf("openlist.failover.cooldown 配置错误: %v", err)
+	}
+	f.cooldown = cooldown
 	return nil
 }
+
+// Threshold 后端连续失败多少次后被标记为不健康
+func (f *OpenlistFailover) Threshold() int {
+	if f == nil || f.FailThreshold <= 0 {
+		return DefaultOpenlistFailThreshold
+	}
+	return f.FailThreshold
+}
+
+// CooldownDuration 后端被标记为不健康的持续时间
+func (f *OpenlistFailover) CooldownDuration() time.Duration {
+	if f == nil || f.cooldown <= 0 {
+		return time.Minute
+	}
+	return f.cooldown
+}
@@ -2,20 +2,68 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
 )
 
+// pathLogger 路径映射日志记录器, 与 path 模块共用日志级别
+var pathLogger = logs.Module("path")
+
+const (
+	// DefaultPathIndexFile 默认的路径索引文件名称
+	DefaultPathIndexFile = "path-index.json"
+
+	// DefaultPathIndexRefreshInterval 默认的路径索引刷新间隔
+	DefaultPathIndexRefreshInterval = "6h"
+
+	// DefaultPathIndexFullRefreshInterval 默认的路径索引全量刷新间隔
+	DefaultPathIndexFullRefreshInterval = "7d"
+)
+
+// defaultPathIndexExts 默认索引的文件扩展名
+var defaultPathIndexExts = []string{
+	".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv", ".ts", ".m2ts", ".rmvb", ".webm", ".iso", ".mpg", ".mpeg",
+	".mp3", ".flac", ".aac", ".m4a", ".ape", ".wav", ".strm",
+}
+
 type Path struct {
 	// Emby2Openlist Emby 的路径前缀映射到 Openlist 的路径前缀, 两个路径使用 : 符号隔开
 	Emby2Openlist []string `yaml:"emby2openlist"`
+	// Index openlist 路径索引配置
+	Index *PathIndex `yaml:"index"`
 
 	// emby2OpenlistArr 根据 Emby2Openlist 转换成路径键值对数组
 	emby2OpenlistArr [][2]string
 }
 
+// PathIndex openlist 路径索引配置
+//
+// 开启后在后台遍历 openlist 目录, 将文件路径和大小保存到本地,
+// 路径映射失败时直接从索引中查找, 不再逐个尝试 openlist 根目录
+type PathIndex struct {
+	// Enable 是否启用路径索引
+	Enable bool `yaml:"enable"`
+	// Roots 需要索引的 openlist 目录, 为空时索引整个 openlist
+	Roots []string `yaml:"roots"`
+	// File 索引文件路径, 相对路径基于配置文件所在目录
+	File string `yaml:"file"`
+	// RefreshInterval 索引增量刷新间隔, 刷新时跳过修改时间没有变化的目录
+	RefreshInterval string `yaml:"refresh-interval"`
+	// FullRefreshInterval 索引全量刷新间隔, 部分网盘的子目录变更不会更新上级目录的修改时间
+	FullRefreshInterval string `yaml:"full-refresh-interval"`
+	// Exts 需要索引的文件扩展名, 为空时只索引常见的音视频文件
+	Exts []string `yaml:"exts"`
+
+	// refreshInterval 解析后的增量刷新间隔
+	refreshInterval time.Duration
+	// fullRefreshInterval 解析后的全量刷新间隔
+	fullRefreshInterval time.Duration
+}
+
 func (p *Path) Init() error {
 	p.emby2OpenlistArr = make([][2]string, 0)
 	for _, e2a := range p.Emby2Openlist {
@@ -25,6 +73,13 @@ func (p *Path) Init() error {
 		}
 		p.emby2OpenlistArr = append(p.emby2OpenlistArr, [2]string{arr[0], arr[1]})
 	}
+
+	if p.Index == nil {
+		p.Index = new(PathIndex)
+	}
+	if err := p.Index.init(); err != nil {
+		return fmt.Errorf("path.index 配置错误: %v", err)
+	}
 	return nil
 }
 
@@ -33,9 +88,86 @@ func (p *Path) MapEmby2Openlist(embyPath string) (string, bool) {
 	for _, cfg := range p.emby2OpenlistArr {
 		ep, ap := cfg[0], cfg[1]
 		if strings.HasPrefix(embyPath, ep) {
-			log.Printf(colors.ToGray("命中 emby2openlist 路径映射: %s => %s (如命中错误, 请将正确的映射配置前移)"), ep, ap)
+			pathLogger.Debugf("命中 emby2openlist 路径映射: %s => %s (如命中错误, 请将正确的映射配置前移)", ep, ap)
 			return strings.Replace(embyPath, ep, ap, 1), true
 		}
 	}
 	return "", false
 }
+
+func (pi *PathIndex) init() error {
+	roots := make([]string, 0, len(pi.Roots))
+	for _, root := range pi.Roots {
+		if root = strings.TrimSpace(root); root == "" {
+			continue
+		}
+		if !strings.HasPrefix(root, "/") {
+			return fmt.Errorf("roots 配置错误: %s, 需要以 / 开头", root)
+		}
+		if root != "/" {
+			root = strings.TrimSuffix(root, "/")
+		}
+		roots = append(roots, root)
+	}
+	if len(roots) == 0 {
+		roots = append(roots, "/")
+	}
+	pi.Roots = roots
+
+	if pi.File = strings.TrimSpace(pi.File); pi.File == "" {
+		pi.File = DefaultPathIndexFile
+	}
+
+	if strings.TrimSpace(pi.RefreshInterval) == "" {
+		pi.RefreshInterval = DefaultPathIndexRefreshInterval
+	}
+	interval, err := parseDuration(pi.RefreshInterval)
+	if err != nil {
+		return fmt.Errorf("refresh-interval 配置错误: %v", err)
+	}
+	pi.refreshInterval = interval
+
+	if strings.TrimSpace(pi.FullRefreshInterval) == "" {
+		pi.FullRefreshInterval = DefaultPathIndexFullRefreshInterval
+	}
+	fullInterval, err := parseDuration(pi.FullRefreshInterval)
+	if err != nil {
+		return fmt.Errorf("full-refresh-interval 配置错误: %v", err)
+	}
+	pi.fullRefreshInterval = fullInterval
+
+	if len(pi.Exts) == 0 {
+		pi.Exts = slices.Clone(defaultPathIndexExts)
+	}
+	normalizeExts(pi.Exts)
+	return nil
+}
+
+// FilePath 获取索引文件的绝对路径
+func (pi *PathIndex) FilePath() string {
+	if filepath.IsAbs(pi.File) {
+		return pi.File
+	}
+	return filepath.Join(BasePath, pi.File)
+}
+
+// RefreshDuration 索引增量刷新间隔
+func (pi *PathIndex) RefreshDuration() time.Duration {
+	if pi.refreshInterval <= 0 {
+		return time.Hour * 6
+	}
+	return pi.refreshInterval
+}
+
+// FullRefreshDuration 索引全量刷新间隔
+func (pi *PathIndex) FullRefreshDuration() time.Duration {
+	if pi.fullRefreshInterval <= 0 {
+		return time.Hour * 24 * 7
+	}
+	return pi.fullRefreshInterval
+}
+
+// MatchExt 判断文件是否需要被索引
+func (pi *PathIndex) MatchExt(name string) bool {
+	return slices.Contains(pi.Exts, strings.ToLower(filepath.Ext(name)))
+}
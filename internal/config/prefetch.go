@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPrefetchPercent 默认的预取触发播放进度百分比
+	DefaultPrefetchPercent = 70
+
+	// DefaultPrefetchExpired 默认的预取结果有效期
+	DefaultPrefetchExpired = "10m"
+)
+
+// Prefetch 下一集预取配置
+type Prefetch struct {
+	// Enable 是否启用下一集预取
+	Enable bool `yaml:"enable"`
+	// Percent 当前剧集播放进度达到多少百分比时, 预取下一集
+	Percent int `yaml:"percent"`
+	// Expired 预取结果的有效期, 不宜超过网盘直链的有效期
+	Expired string `yaml:"expired"`
+
+	// expired 解析后的有效期
+	expired time.Duration
+}
+
+func (p *Prefetch) Init() error {
+	if p.Percent == 0 {
+		p.Percent = DefaultPrefetchPercent
+	}
+	if p.Percent < 0 || p.Percent > 100 {
+		return fmt.Errorf("prefetch.percent 配置错误: %d, 值需在 1 ~ 100 之间", p.Percent)
+	}
+
+	if strings.TrimSpace(p.Expired) == "" {
+		p.Expired = DefaultPrefetchExpired
+	}
+	expired, err := parseDuration(p.Expired)
+	if err != nil {
+		return fmt.Errorf("prefetch.expired 配置错误: %v", err)
+	}
+	p.expired = expired
+	return nil
+}
+
+// ExpiredDuration 预取结果的有效期
+func (p *Prefetch) ExpiredDuration() time.Duration {
+	if p.expired <= 0 {
+		return time.Minute * 10
+	}
+	return p.expired
+}
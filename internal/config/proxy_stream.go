@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ProxyStream 代理传输配置
+//
+// 匹配规则的播放请求不再重定向到网盘直链, 而是由程序请求直链后将数据流转发给客户端,
+// 用于无法跟随跨域重定向, 或者无法携带网盘所需请求头的客户端
+type ProxyStream struct {
+	// Enable 是否启用代理传输
+	Enable bool `yaml:"enable"`
+	// Rules 代理传输规则, 满足任意一条规则的请求会被代理传输
+	Rules []*ProxyStreamRule `yaml:"rules"`
+}
+
+func (p *ProxyStream) Init() error {
+	for i, rule := range p.Rules {
+		if rule == nil {
+			return fmt.Errorf("proxy-stream.rules[%d] 配置不能为空", i)
+		}
+		if err := rule.Init(); err != nil {
+			return fmt.Errorf("proxy-stream.rules[%d] 配置错误: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Match 获取第一条匹配的代理传输规则
+//
+// client 为客户端名称 (X-Emby-Client), ua 为客户端的 User-Agent,
+// resPath 为 openlist 资源路径或远程 strm 链接
+func (p *ProxyStream) Match(client, ua, resPath string) (*ProxyStreamRule, bool) {
+	if !p.Enable {
+		return nil, false
+	}
+	for _, rule := range p.Rules {
+		if rule.matchClient(client, ua) && rule.matchPath(resPath) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// ProxyStreamRule 代理传输规则
+type ProxyStreamRule struct {
+	// Clients 匹配客户端名称或 User-Agent 的正则表达式, 为空时匹配所有客户端
+	Clients []string `yaml:"clients"`
+	// Paths 匹配 openlist 资源路径的正则表达式, 可用于限定网盘的挂载目录, 为空时匹配所有资源
+	Paths []string `yaml:"paths"`
+	// Headers 请求网盘直链时额外携带的请求头
+	Headers map[string]string `yaml:"headers"`
+
+	clientRegs []*regexp.Regexp // 客户端编译之后的正则表达式
+	pathRegs   []*regexp.Regexp // 路径编译之后的正则表达式
+	header     http.Header      // 转换之后的请求头
+}
+
+func (r *ProxyStreamRule) Init() error {
+	var err error
+	if r.clientRegs, err = compileRegs(r.Clients); err != nil {
+		return fmt.Errorf("clients %v", err)
+	}
+	if r.pathRegs, err = compileRegs(r.Paths); err != nil {
+		return fmt.Errorf("paths %v", err)
+	}
+
+	r.header = make(http.Header)
+	for key, value := range r.Headers {
+		if key = strings.TrimSpace(key); key == "" {
+			return fmt.Errorf("headers 的键不能为空")
+		}
+		r.header.Set(key, value)
+	}
+	return nil
+}
+
+// Header 请求网盘直链时额外携带的请求头
+func (r *ProxyStreamRule) Header() http.Header {
+	return r.header.Clone()
+}
+
+// matchClient 判断客户端名称或 User-Agent 是否满足规则
+func (r *ProxyStreamRule) matchClient(client, ua string) bool {
+	if len(r.clientRegs) == 0 {
+		return true
+	}
+	for _, reg := range r.clientRegs {
+		if (client != "" && reg.MatchString(client)) || (ua != "" && reg.MatchString(ua)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath 判断资源路径是否满足规则
+func (r *ProxyStreamRule) matchPath(resPath string) bool {
+	if len(r.pathRegs) == 0 {
+		return true
+	}
+	for _, reg := range r.pathRegs {
+		if reg.MatchString(resPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileRegs 编译正则表达式列表
+func compileRegs(patterns []string) ([]*regexp.Regexp, error) {
+	regs := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		reg, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式编译失败: %s, err: %v", pattern, err)
+		}
+		regs = append(regs, reg)
+	}
+	return regs, nil
+}
@@ -0,0 +1,51 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+func TestProxyStreamMatch(t *testing.T) {
+	p := config.ProxyStream{
+		Enable: true,
+		Rules: []*config.ProxyStreamRule{
+			{Clients: []string{`(?i)tizen|webos`}, Headers: map[string]string{"referer": "https://115.com"}},
+			{Paths: []string{`^/quark/`}},
+		},
+	}
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		client  string
+		ua      string
+		path    string
+		match   bool
+		referer string
+	}{
+		{name: "client-name", client: "Emby for Tizen", path: "/115/a.mp4", match: true, referer: "https://115.com"},
+		{name: "user-agent", ua: "Mozilla/5.0 (Web0S; Linux/SmartTV) WebOS", path: "/115/a.mp4", match: true, referer: "https://115.com"},
+		{name: "drive-path", client: "Emby Web", path: "/quark/a.mp4", match: true},
+		{name: "no-match", client: "Emby Web", path: "/115/a.mp4", match: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := p.Match(tt.client, tt.ua, tt.path)
+			if ok != tt.match {
+				t.Fatalf("期望匹配结果: %v, 实际: %v", tt.match, ok)
+			}
+			if ok && rule.Header().Get("Referer") != tt.referer {
+				t.Fatalf("期望 Referer: %s, 实际: %s", tt.referer, rule.Header().Get("Referer"))
+			}
+		})
+	}
+
+	p.Enable = false
+	if _, ok := p.Match("Emby for Tizen", "", "/115/a.mp4"); ok {
+		t.Fatal("未启用时不应该匹配任何规则")
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// WatchInterval 检测配置文件变更的时间间隔
+const WatchInterval = time.Second * 3
+
+// ReloadListener 配置热重载成功后的回调函数
+//
+// 两个参数分别是旧配置和新配置
+type ReloadListener func(oldC, newC *Config)
+
+var (
+	// reloadMutex 保证同一时间只有一个重载任务在执行
+	reloadMutex sync.Mutex
+
+	// reloadListeners 注册的重载回调
+	reloadListeners []ReloadListener
+
+	// lastReload 最近一次配置重载的结果
+	lastReload ReloadStatus
+)
+
+// ReloadStatus 配置重载结果
+type ReloadStatus struct {
+	Time time.Time // 重载时间, 零值表示还未重载过
+	Err  error     // 重载失败的原因
+}
+
+// LastReload 获取最近一次配置重载的结果
+func LastReload() ReloadStatus {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	return lastReload
+}
+
+// FilePath 当前加载的配置文件路径
+func FilePath() string {
+	return configPath
+}
+
+// OnReload 注册一个配置热重载回调
+func OnReload(l ReloadListener) {
+	if l == nil {
+		return
+	}
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	reloadListeners = append(reloadListeners, l)
+}
+
+// Reload 重新读取配置文件
+//
+// 新配置需要通过所有配置项的 Init 校验, 才会应用日志设置并替换掉全局配置,
+// 失败时, 返回错误并继续使用旧配置
+//
+// 重载时配置文件路径不变, BasePath 也保持不变
+func Reload() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	if configPath == "" {
+		return errors.New("尚未加载过配置文件")
+	}
+
+	newC, err := load(configPath)
+	if err == nil {
+		err = newC.Log.Apply()
+	}
+	lastReload = ReloadStatus{Time: time.Now(), Err: err}
+	if err != nil {
+		return err
+	}
+
+	oldC := current.Swap(newC)
+	warnRestartRequired(oldC, newC)
+	for _, l := range reloadListeners {
+		l(oldC, newC)
+	}
+	return nil
+}
+
+// Watch 监听配置文件变更以及 SIGHUP 信号, 自动重载配置
+func Watch() {
+	go watchFile()
+	go watchSignal()
+}
+
+// watchFile 定时检查配置文件的修改时间, 发生变更时重载配置
+func watchFile() {
+	stat, err := os.Stat(configPath)
+	if err != nil {
+		logger.Errorf("监听配置文件失败: %v", err)
+		return
+	}
+	lastMod, lastSize := stat.ModTime(), stat.Size()
+
+	t := time.NewTicker(WatchInterval)
+	defer t.Stop()
+	for range t.C {
+		stat, err := os.Stat(configPath)
+		if err != nil {
+			// 编辑器保存文件时可能会短暂删除原文件
+			continue
+		}
+		if stat.ModTime().Equal(lastMod) && stat.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = stat.ModTime(), stat.Size()
+		logger.Info("检测到配置文件变更, 正在重载配置...")
+		doReload()
+	}
+}
+
+// watchSignal 接收到 SIGHUP 信号时重载配置
+func watchSignal() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	for range sigChan {
+		logger.Info("接收到 SIGHUP 信号, 正在重载配置...")
+		doReload()
+	}
+}
+
+// doReload 重载配置并输出结果日志
+func doReload() {
+	if err := Reload(); err != nil {
+		logger.Errorf("配置重载失败, 继续使用旧配置: %v", err)
+		return
+	}
+	logger.Info("配置重载成功")
+}
+
+// warnRestartRequired 对于需要重启才能生效的配置项, 变更时输出提示
+func warnRestartRequired(oldC, newC *Config) {
+	if oldC == nil || newC == nil {
+		return
+	}
+
+	if *oldC.Ssl != *newC.Ssl {
+		logger.Warn("ssl 配置变更需要重启服务后才能生效")
+	}
+	if oldC.Cache.Enable != newC.Cache.Enable {
+		logger.Warn("cache.enable 配置变更需要重启服务后才能生效")
+	}
+	if oldC.Path.Index.Enable != newC.Path.Index.Enable {
+		logger.Warn("path.index.enable 配置变更需要重启服务后才能生效")
+	}
+	if oldC.StrmSync.Enable != newC.StrmSync.Enable {
+		logger.Warn("strm-sync.enable 配置变更需要重启服务后才能生效")
+	}
+}
@@ -0,0 +1,62 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+func TestReloadRejected(t *testing.T) {
+	valid := `
+emby:
+  host: http://localhost:8096
+  mount-path: /data
+openlist:
+  host: http://localhost:5244
+  token: token
+`
+	invalid := valid + `
+log:
+  level: unknown
+`
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(fp, []byte(valid), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ReadFromFile(fp); err != nil {
+		t.Fatal(err)
+	}
+	c := config.C()
+
+	tests := []struct {
+		name   string
+		reload func() error
+	}{
+		{name: "读取其他目录中的错误配置", reload: func() error {
+			other := filepath.Join(t.TempDir(), "config.yml")
+			if err := os.WriteFile(other, []byte(invalid), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			return config.ReadFromFile(other)
+		}},
+		{name: "重载错误配置", reload: func() error {
+			if err := os.WriteFile(fp, []byte(invalid), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			return config.Reload()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.reload(); err == nil {
+				t.Fatal("错误的配置应该校验失败")
+			}
+			if config.C() != c || config.BasePath != dir || config.FilePath() != fp {
+				t.Errorf("校验失败后不应修改全局状态, BasePath: %s, FilePath: %s", config.BasePath, config.FilePath())
+			}
+		})
+	}
+}
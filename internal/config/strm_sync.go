@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
+)
+
+// DefaultStrmSyncInterval 默认的 strm 定时同步间隔
+const DefaultStrmSyncInterval = "1d"
+
+var (
+	// defaultStrmSyncVideoExts 默认生成 strm 文件的视频扩展名
+	defaultStrmSyncVideoExts = []string{
+		".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv", ".ts", ".m2ts", ".rmvb", ".webm", ".iso", ".mpg", ".mpeg",
+	}
+
+	// defaultStrmSyncSidecarExts 默认直接复制到本地的附属文件扩展名
+	defaultStrmSyncSidecarExts = []string{
+		".nfo", ".srt", ".ass", ".ssa", ".vtt", ".sub", ".idx", ".jpg", ".jpeg", ".png", ".webp",
+	}
+)
+
+// StrmSync 根据 openlist 目录生成 strm 媒体库的配置
+type StrmSync struct {
+	// Enable 是否启用定时同步, 不启用时仍可通过 strm sync 命令手动同步
+	Enable bool `yaml:"enable"`
+	// BaseUrl 写入 strm 文件中的本程序访问地址, 如: http://192.168.0.10:8095
+	BaseUrl string `yaml:"base-url"`
+	// Secret 签名 strm 链接的密钥, 没有携带有效签名的 strm 链接会被拒绝访问
+	Secret string `yaml:"secret"`
+	// Interval 定时同步间隔
+	Interval string `yaml:"interval"`
+	// VideoExts 生成 strm 文件的视频扩展名
+	VideoExts []string `yaml:"video-exts"`
+	// SidecarExts 直接复制到本地的附属文件扩展名, 如 nfo, 字幕, 海报
+	SidecarExts []string `yaml:"sidecar-exts"`
+	// Jobs 同步任务
+	Jobs []*StrmSyncJob `yaml:"jobs"`
+
+	// interval 解析后的定时同步间隔
+	interval time.Duration
+}
+
+// StrmSyncJob strm 同步任务, 将 openlist 目录同步到本地目录
+type StrmSyncJob struct {
+	// Name 任务名称, 为空时使用 OpenlistPath
+	Name string `yaml:"name"`
+	// OpenlistPath 需要同步的 openlist 目录
+	OpenlistPath string `yaml:"openlist-path"`
+	// LocalPath 生成 strm 文件的本地目录, 相对路径基于配置文件所在目录
+	LocalPath string `yaml:"local-path"`
+}
+
+func (s *StrmSync) Init() error {
+	s.BaseUrl = strings.TrimSuffix(strings.TrimSpace(s.BaseUrl), "/")
+	if len(s.Jobs) > 0 && s.BaseUrl == "" {
+		return errors.New("strm-sync.base-url 配置不能为空")
+	}
+	s.Secret = strings.TrimSpace(s.Secret)
+	if len(s.Jobs) > 0 && s.Secret == "" {
+		return errors.New("strm-sync.secret 配置不能为空")
+	}
+	if s.BaseUrl != "" && !strings.HasPrefix(s.BaseUrl, "http://") && !strings.HasPrefix(s.BaseUrl, "https://") {
+		return fmt.Errorf("strm-sync.base-url 配置错误: %s, 需要以 http:// 或 https:// 开头", s.BaseUrl)
+	}
+	if s.Enable && len(s.Jobs) == 0 {
+		return errors.New("strm-sync.jobs 配置不能为空")
+	}
+
+	if strings.TrimSpace(s.Interval) == "" {
+		s.Interval = DefaultStrmSyncInterval
+	}
+	interval, err := parseDuration(s.Interval)
+	if err != nil {
+		return fmt.Errorf("strm-sync.interval 配置错误: %v", err)
+	}
+	s.interval = interval
+
+	if len(s.VideoExts) == 0 {
+		s.VideoExts = slices.Clone(defaultStrmSyncVideoExts)
+	}
+	if len(s.SidecarExts) == 0 {
+		s.SidecarExts = slices.Clone(defaultStrmSyncSidecarExts)
+	}
+	normalizeExts(s.VideoExts)
+	normalizeExts(s.SidecarExts)
+
+	names := make(map[string]struct{}, len(s.Jobs))
+	for i, job := range s.Jobs {
+		if job == nil {
+			return fmt.Errorf("strm-sync.jobs[%d] 配置不能为空", i)
+		}
+		if err := job.init(); err != nil {
+			return fmt.Errorf("strm-sync.jobs[%d] 配置错误: %v", i, err)
+		}
+		if _, ok := names[job.Name]; ok {
+			return fmt.Errorf("strm-sync.jobs 名称重复: %s", job.Name)
+		}
+		names[job.Name] = struct{}{}
+	}
+	return nil
+}
+
+func (j *StrmSyncJob) init() error {
+	j.OpenlistPath = strings.TrimSpace(j.OpenlistPath)
+	j.LocalPath = strings.TrimSpace(j.LocalPath)
+	if strs.AnyEmpty(j.OpenlistPath, j.LocalPath) {
+		return errors.New("openlist-path 和 local-path 配置不能为空")
+	}
+	if !strings.HasPrefix(j.OpenlistPath, "/") {
+		return fmt.Errorf("openlist-path 配置错误: %s, 需要以 / 开头", j.OpenlistPath)
+	}
+	if j.OpenlistPath != "/" {
+		j.OpenlistPath = strings.TrimSuffix(j.OpenlistPath, "/")
+	}
+	if !filepath.IsAbs(j.LocalPath) {
+		j.LocalPath = filepath.Join(BasePath, j.LocalPath)
+	}
+	if strs.AnyEmpty(j.Name) {
+		j.Name = j.OpenlistPath
+	}
+	return nil
+}
+
+// IntervalDuration 定时同步间隔
+func (s *StrmSync) IntervalDuration() time.Duration {
+	if s.interval <= 0 {
+		return time.Hour * 24
+	}
+	return s.interval
+}
+
+// IsVideo 判断文件是否需要生成 strm 文件
+func (s *StrmSync) IsVideo(name string) bool {
+	return slices.Contains(s.VideoExts, strings.ToLower(filepath.Ext(name)))
+}
+
+// IsSidecar 判断文件是否需要直接复制到本地
+func (s *StrmSync) IsSidecar(name string) bool {
+	return slices.Contains(s.SidecarExts, strings.ToLower(filepath.Ext(name)))
+}
+
+// Contains 判断 openlist 路径是否在某个同步任务的目录下, 判断前会先清理路径中的 . 和 ..
+func (s *StrmSync) Contains(openlistPath string) bool {
+	openlistPath = path.Clean("/" + openlistPath)
+	for _, job := range s.Jobs {
+		if job.OpenlistPath == "/" || openlistPath == job.OpenlistPath ||
+			strings.HasPrefix(openlistPath, job.OpenlistPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeExts 将扩展名统一转换为小写并以 . 开头
+func normalizeExts(exts []string) {
+	for i, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts[i] = ext
+	}
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/maps"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
+)
+
+// DefaultUpstreamName 未配置 upstreams 时, 使用 emby 配置生成的默认上游名称
+const DefaultUpstreamName = "default"
+
+// EmbyUpstream 上游媒体服务器
+//
+// 未配置的 server-type, mount-path, local-media-root, strm 继承 emby 下的同名配置,
+// 未配置的 emby2openlist 使用 path.emby2openlist 配置
+type EmbyUpstream struct {
+	// Name 上游名称, 用于日志和缓存中区分上游
+	Name string `yaml:"name"`
+	// Host 媒体服务器地址
+	Host string `yaml:"host"`
+	// ServerType 媒体服务器类型
+	ServerType ServerType `yaml:"server-type"`
+	// MountPath rclone 或者 cd 的挂载目录
+	MountPath string `yaml:"mount-path"`
+	// LocalMediaRoot 本地媒体根路径
+	LocalMediaRoot string `yaml:"local-media-root"`
+	// Strm strm 配置
+	Strm *Strm `yaml:"strm"`
+	// Emby2Openlist 路径前缀映射, 格式与 path.emby2openlist 一致
+	Emby2Openlist []string `yaml:"emby2openlist"`
+	// Match 上游匹配规则, 为空时作为默认上游
+	Match *UpstreamMatch `yaml:"match"`
+
+	// path 上游单独配置的路径映射, 为空时使用全局配置
+	path *Path
+}
+
+// UpstreamMatch 上游匹配规则, 优先级: 路径前缀 > Host > 监听端口
+type UpstreamMatch struct {
+	// Hosts 客户端请求的 Host, 可以带上端口号进行精确匹配
+	Hosts []string `yaml:"hosts"`
+	// Ports 服务监听端口, 不是程序默认监听的端口时会额外启动一个 http 服务
+	Ports []string `yaml:"ports"`
+	// PathPrefix 请求路径前缀, 匹配后会从请求路径中移除再交给后续处理
+	PathPrefix string `yaml:"path-prefix"`
+}
+
+// empty 判断匹配规则是否为空
+func (m *UpstreamMatch) empty() bool {
+	return m == nil || (len(m.Hosts) == 0 && len(m.Ports) == 0 && m.PathPrefix == "")
+}
+
+// initUpstreams 初始化上游服务器
+func (e *Emby) initUpstreams() error {
+	if len(e.Upstreams) == 0 {
+		e.defaultUpstream = e.newDefaultUpstream()
+		e.upstreams = []*EmbyUpstream{e.defaultUpstream}
+		return nil
+	}
+
+	names := make(map[string]struct{}, len(e.Upstreams))
+	prefixes := make(map[string]struct{})
+	e.upstreams = make([]*EmbyUpstream, 0, len(e.Upstreams))
+	e.defaultUpstream = nil
+	for i, u := range e.Upstreams {
+		if u == nil {
+			return fmt.Errorf("emby.upstreams[%d] 配置不能为空", i)
+		}
+		if strs.AnyEmpty(u.Host) {
+			return fmt.Errorf("emby.upstreams[%d].host 配置不能为空", i)
+		}
+		if strs.AnyEmpty(u.Name) {
+			u.Name = u.Host
+		}
+		if _, ok := names[u.Name]; ok {
+			return fmt.Errorf("emby.upstreams 名称重复: %s", u.Name)
+		}
+		names[u.Name] = struct{}{}
+
+		if err := e.inheritUpstream(u); err != nil {
+			return fmt.Errorf("emby.upstreams[%s] 配置错误: %v", u.Name, err)
+		}
+
+		if u.Match.empty() {
+			if e.defaultUpstream != nil {
+				return fmt.Errorf("emby.upstreams 中只能有一个未配置 match 的默认上游: %s, %s", e.defaultUpstream.Name, u.Name)
+			}
+			e.defaultUpstream = u
+		} else if p := u.Match.PathPrefix; p != "" {
+			if !strings.HasPrefix(p, "/") {
+				return fmt.Errorf("emby.upstreams[%s].match.path-prefix 配置错误: %s, 需要以 / 开头", u.Name, p)
+			}
+			u.Match.PathPrefix = strings.TrimSuffix(p, "/")
+			if _, ok := prefixes[u.Match.PathPrefix]; ok {
+				return fmt.Errorf("emby.upstreams 路径前缀重复: %s", p)
+			}
+			prefixes[u.Match.PathPrefix] = struct{}{}
+		}
+		e.upstreams = append(e.upstreams, u)
+	}
+
+	// 没有配置默认上游时, 使用第一个上游
+	if e.defaultUpstream == nil {
+		e.defaultUpstream = e.upstreams[0]
+	}
+	return nil
+}
+
+// newDefaultUpstream 使用 emby 配置生成默认上游
+func (e *Emby) newDefaultUpstream() *EmbyUpstream {
+	strm := e.Strm
+	if strm == nil {
+		strm = new(Strm)
+	}
+	serverType := e.ServerType
+	if serverType == "" {
+		serverType = ServerTypeEmby
+	}
+	return &EmbyUpstream{
+		Name:           DefaultUpstreamName,
+		Host:           e.Host,
+		ServerType:     serverType,
+		MountPath:      e.MountPath,
+		LocalMediaRoot: e.LocalMediaRoot,
+		Strm:           strm,
+	}
+}
+
+// inheritUpstream 初始化上游配置, 未配置的项继承 emby 下的同名配置
+func (e *Emby) inheritUpstream(u *EmbyUpstream) error {
+	if u.ServerType = ServerType(strings.TrimSpace(string(u.ServerType))); u.ServerType == "" {
+		u.ServerType = e.ServerType
+	}
+	if _, ok := validServerType[u.ServerType]; !ok {
+		return fmt.Errorf("server-type 配置错误, 有效值: %v", maps.Keys(validServerType))
+	}
+	if u.MountPath == "" {
+		u.MountPath = e.MountPath
+	}
+	if strs.AnyEmpty(u.MountPath) {
+		return errors.New("mount-path 配置不能为空")
+	}
+	if u.LocalMediaRoot = strings.TrimSpace(u.LocalMediaRoot); u.LocalMediaRoot == "" {
+		u.LocalMediaRoot = e.LocalMediaRoot
+	}
+
+	if u.Strm == nil {
+		u.Strm = e.Strm
+	} else if err := u.Strm.Init(); err != nil {
+		return fmt.Errorf("strm 配置错误: %v", err)
+	}
+
+	u.path = nil
+	if len(u.Emby2Openlist) > 0 {
+		u.path = &Path{Emby2Openlist: u.Emby2Openlist}
+		if err := u.path.Init(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AllUpstreams 获取所有上游服务器
+func (e *Emby) AllUpstreams() []*EmbyUpstream {
+	if e == nil || e.upstreams == nil {
+		return []*EmbyUpstream{e.DefaultUpstream()}
+	}
+	return e.upstreams
+}
+
+// DefaultUpstream 获取默认上游服务器
+func (e *Emby) DefaultUpstream() *EmbyUpstream {
+	if e == nil {
+		return &EmbyUpstream{Name: DefaultUpstreamName, ServerType: ServerTypeEmby, Strm: new(Strm)}
+	}
+	if e.defaultUpstream == nil {
+		return e.newDefaultUpstream()
+	}
+	return e.defaultUpstream
+}
+
+// SelectUpstream 根据请求信息选择上游服务器
+//
+// 通过路径前缀匹配成功时, 第二个返回值为匹配到的前缀, 否则为空
+func (e *Emby) SelectUpstream(host, port, path string) (*EmbyUpstream, string) {
+	ups := e.AllUpstreams()
+
+	var matched *EmbyUpstream
+	for _, u := range ups {
+		if u.Match.empty() || u.Match.PathPrefix == "" {
+			continue
+		}
+		p := u.Match.PathPrefix
+		if path != p && !strings.HasPrefix(path, p+"/") {
+			continue
+		}
+		if matched == nil || len(p) > len(matched.Match.PathPrefix) {
+			matched = u
+		}
+	}
+	if matched != nil {
+		return matched, matched.Match.PathPrefix
+	}
+
+	host = strings.ToLower(host)
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	for _, u := range ups {
+		if u.Match.empty() {
+			continue
+		}
+		for _, h := range u.Match.Hosts {
+			if h = strings.ToLower(strings.TrimSpace(h)); h == host || h == hostname {
+				return u, ""
+			}
+		}
+	}
+
+	for _, u := range ups {
+		if u.Match.empty() {
+			continue
+		}
+		for _, p := range u.Match.Ports {
+			if strings.TrimSpace(p) == port {
+				return u, ""
+			}
+		}
+	}
+	return e.DefaultUpstream(), ""
+}
+
+// ListenPorts 获取上游匹配规则中配置的所有监听端口
+func (e *Emby) ListenPorts() []string {
+	var ports []string
+	seen := make(map[string]struct{})
+	for _, u := range e.AllUpstreams() {
+		if u.Match.empty() {
+			continue
+		}
+		for _, p := range u.Match.Ports {
+			p = strings.TrimSpace(p)
+			if _, ok := seen[p]; ok || p == "" {
+				continue
+			}
+			seen[p] = struct{}{}
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
+
+// MapEmby2Openlist 将 emby 路径映射成 openlist 路径
+//
+// 上游没有单独配置映射时, 使用 path.emby2openlist 配置
+func (u *EmbyUpstream) MapEmby2Openlist(embyPath string) (string, bool) {
+	if u.path != nil {
+		return u.path.MapEmby2Openlist(embyPath)
+	}
+	return C().Path.MapEmby2Openlist(embyPath)
+}
+
+// IsJellyfin 判断上游是否为 jellyfin 服务器
+func (u *EmbyUpstream) IsJellyfin() bool {
+	return u.ServerType == ServerTypeJellyfin
+}
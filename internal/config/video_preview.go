@@ -1,5 +1,39 @@
 package config
 
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPlaylistMaxNum 默认在内存中最多维护的 m3u8 播放列表个数
+	DefaultPlaylistMaxNum = 10
+
+	// DefaultPlaylistRefreshInterval 默认的播放列表刷新间隔
+	DefaultPlaylistRefreshInterval = "10m"
+
+	// DefaultPlaylistRefreshAhead 默认在直链过期前多久刷新播放列表
+	DefaultPlaylistRefreshAhead = "1m"
+
+	// DefaultPlaylistStopUpdateAfter 默认的播放列表停止更新时间
+	DefaultPlaylistStopUpdateAfter = "11m"
+
+	// DefaultPlaylistRemoveAfter 默认的播放列表移除时间
+	DefaultPlaylistRemoveAfter = "1h"
+
+	// DefaultPlaylistFile 默认的播放列表持久化文件名称
+	DefaultPlaylistFile = "m3u8-playlists.json"
+
+	// DefaultSegmentReadAhead 默认预读的分片个数
+	DefaultSegmentReadAhead = 3
+
+	// DefaultSegmentBufferSize 默认的分片缓冲区大小 (MB)
+	DefaultSegmentBufferSize = 256
+)
+
 type VideoPreview struct {
 	// Enable 是否开启网盘转码链接代理
 	Enable bool `yaml:"enable"`
@@ -7,6 +41,12 @@ type VideoPreview struct {
 	Containers []string `yaml:"containers"`
 	// IgnoreTemplateIds 忽略的转码清晰度
 	IgnoreTemplateIds []string `yaml:"ignore-template-ids"`
+	// Adaptive 是否额外提供一个自适应清晰度的转码版本, 由播放器根据网络状况自动切换清晰度
+	Adaptive bool `yaml:"adaptive"`
+	// Playlist 转码播放列表维护配置
+	Playlist *PlaylistPool `yaml:"playlist"`
+	// SegmentProxy 转码分片代理配置
+	SegmentProxy *SegmentProxy `yaml:"segment-proxy"`
 
 	// containerMap 依据 Containers 初始化该 map, 便于后续快速判断
 	containerMap map[string]struct{}
@@ -23,6 +63,20 @@ func (vp *VideoPreview) Init() error {
 	for _, id := range vp.IgnoreTemplateIds {
 		vp.ignoreTemplateIdMap[id] = struct{}{}
 	}
+
+	if vp.Playlist == nil {
+		vp.Playlist = new(PlaylistPool)
+	}
+	if err := vp.Playlist.init(); err != nil {
+		return fmt.Errorf("video-preview.playlist 配置错误: %v", err)
+	}
+
+	if vp.SegmentProxy == nil {
+		vp.SegmentProxy = new(SegmentProxy)
+	}
+	if err := vp.SegmentProxy.init(); err != nil {
+		return fmt.Errorf("video-preview.segment-proxy 配置错误: %v", err)
+	}
 	return nil
 }
 
@@ -37,3 +91,167 @@ func (vp *VideoPreview) IsTemplateIgnore(templateId string) bool {
 	_, ok := vp.ignoreTemplateIdMap[templateId]
 	return ok
 }
+
+// PlaylistPool 内存中 m3u8 转码播放列表的维护配置
+//
+// 播放列表会在其中最早过期的签名直链过期之前自动刷新,
+// 无法从直链中解析出过期时间时, 按照 RefreshInterval 定时刷新
+type PlaylistPool struct {
+	// MaxNum 内存中最多维护的播放列表个数, 超出则淘汰最久没有读取的播放列表
+	MaxNum int `yaml:"max-num"`
+	// RefreshInterval 无法解析直链过期时间时, 播放列表的刷新间隔
+	RefreshInterval string `yaml:"refresh-interval"`
+	// RefreshAhead 在直链过期前多久刷新播放列表
+	RefreshAhead string `yaml:"refresh-ahead"`
+	// StopUpdateAfter 超过这个时间没有被客户端读取, 播放列表停止刷新
+	StopUpdateAfter string `yaml:"stop-update-after"`
+	// RemoveAfter 超过这个时间没有被刷新, 播放列表从内存中移除
+	RemoveAfter string `yaml:"remove-after"`
+	// Persist 是否将播放列表持久化到磁盘, 服务重启之后无需重新请求 openlist
+	Persist bool `yaml:"persist"`
+	// File 持久化文件路径, 相对路径基于配置文件所在目录
+	File string `yaml:"file"`
+
+	// refreshInterval 解析后的刷新间隔
+	refreshInterval time.Duration
+	// refreshAhead 解析后的提前刷新时间
+	refreshAhead time.Duration
+	// stopUpdateAfter 解析后的停止更新时间
+	stopUpdateAfter time.Duration
+	// removeAfter 解析后的移除时间
+	removeAfter time.Duration
+}
+
+func (pp *PlaylistPool) init() error {
+	if pp.MaxNum == 0 {
+		pp.MaxNum = DefaultPlaylistMaxNum
+	}
+	if pp.MaxNum < 0 {
+		return fmt.Errorf("max-num 配置错误: %d, 值需大于 0", pp.MaxNum)
+	}
+
+	durations := []struct {
+		name   string
+		raw    *string
+		def    string
+		parsed *time.Duration
+	}{
+		{name: "refresh-interval", raw: &pp.RefreshInterval, def: DefaultPlaylistRefreshInterval, parsed: &pp.refreshInterval},
+		{name: "refresh-ahead", raw: &pp.RefreshAhead, def: DefaultPlaylistRefreshAhead, parsed: &pp.refreshAhead},
+		{name: "stop-update-after", raw: &pp.StopUpdateAfter, def: DefaultPlaylistStopUpdateAfter, parsed: &pp.stopUpdateAfter},
+		{name: "remove-after", raw: &pp.RemoveAfter, def: DefaultPlaylistRemoveAfter, parsed: &pp.removeAfter},
+	}
+	for _, d := range durations {
+		if strings.TrimSpace(*d.raw) == "" {
+			*d.raw = d.def
+		}
+		parsed, err := parseDuration(*d.raw)
+		if err != nil {
+			return fmt.Errorf("%s 配置错误: %v", d.name, err)
+		}
+		*d.parsed = parsed
+	}
+	if pp.refreshAhead >= pp.refreshInterval {
+		return fmt.Errorf("refresh-ahead 配置错误: %s, 值需小于 refresh-interval", pp.RefreshAhead)
+	}
+	if pp.removeAfter < pp.stopUpdateAfter {
+		return fmt.Errorf("remove-after 配置错误: %s, 值不能小于 stop-update-after", pp.RemoveAfter)
+	}
+
+	if pp.File = strings.TrimSpace(pp.File); pp.File == "" {
+		pp.File = DefaultPlaylistFile
+	}
+	return nil
+}
+
+// RefreshDuration 无法解析直链过期时间时, 播放列表的刷新间隔
+func (pp *PlaylistPool) RefreshDuration() time.Duration {
+	if pp.refreshInterval <= 0 {
+		return time.Minute * 10
+	}
+	return pp.refreshInterval
+}
+
+// RefreshAheadDuration 在直链过期前多久刷新播放列表
+func (pp *PlaylistPool) RefreshAheadDuration() time.Duration {
+	if pp.refreshAhead <= 0 {
+		return time.Minute
+	}
+	return pp.refreshAhead
+}
+
+// StopUpdateDuration 播放列表多久没有被读取后停止刷新
+func (pp *PlaylistPool) StopUpdateDuration() time.Duration {
+	if pp.stopUpdateAfter <= 0 {
+		return time.Minute * 11
+	}
+	return pp.stopUpdateAfter
+}
+
+// RemoveDuration 播放列表多久没有被刷新后从内存中移除
+func (pp *PlaylistPool) RemoveDuration() time.Duration {
+	if pp.removeAfter <= 0 {
+		return time.Hour
+	}
+	return pp.removeAfter
+}
+
+// FilePath 获取持久化文件的绝对路径
+func (pp *PlaylistPool) FilePath() string {
+	if filepath.IsAbs(pp.File) {
+		return pp.File
+	}
+	return filepath.Join(BasePath, pp.File)
+}
+
+// SegmentProxy 转码分片代理配置
+//
+// 开启后转码分片不再重定向到网盘, 而是由程序请求后返回给客户端,
+// 同时预读后续的分片到内存缓冲区中, 适用于分片直链容易过期或需要携带请求头的网盘
+type SegmentProxy struct {
+	// Enable 是否启用分片代理
+	Enable bool `yaml:"enable"`
+	// ReadAhead 每次请求分片后, 预读后续的分片个数
+	ReadAhead int `yaml:"read-ahead"`
+	// BufferSize 分片缓冲区大小 (MB), 超出则淘汰最久没有读取的分片
+	BufferSize int `yaml:"buffer-size"`
+	// Headers 请求分片时携带的请求头, 如: Referer, Cookie
+	Headers map[string]string `yaml:"headers"`
+
+	// header 根据 Headers 初始化的请求头
+	header http.Header
+}
+
+func (sp *SegmentProxy) init() error {
+	if sp.ReadAhead == 0 {
+		sp.ReadAhead = DefaultSegmentReadAhead
+	}
+	if sp.ReadAhead < 0 {
+		return fmt.Errorf("read-ahead 配置错误: %d, 值需大于 0", sp.ReadAhead)
+	}
+	if sp.BufferSize == 0 {
+		sp.BufferSize = DefaultSegmentBufferSize
+	}
+	if sp.BufferSize < 0 {
+		return fmt.Errorf("buffer-size 配置错误: %d, 值需大于 0", sp.BufferSize)
+	}
+
+	sp.header = make(http.Header)
+	for key, value := range sp.Headers {
+		sp.header.Set(key, value)
+	}
+	return nil
+}
+
+// Header 请求分片时携带的请求头, 返回副本, 调用方可以修改
+func (sp *SegmentProxy) Header() http.Header {
+	return sp.header.Clone()
+}
+
+// BufferBytes 分片缓冲区大小 (字节)
+func (sp *SegmentProxy) BufferBytes() int64 {
+	if sp.BufferSize <= 0 {
+		return DefaultSegmentBufferSize << 20
+	}
+	return int64(sp.BufferSize) << 20
+}
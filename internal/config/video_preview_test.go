@@ -0,0 +1,41 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+func TestPlaylistPoolInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		pool    *config.PlaylistPool
+		wantErr bool
+		maxNum  int
+		refresh time.Duration
+	}{
+		{name: "default", pool: nil, maxNum: config.DefaultPlaylistMaxNum, refresh: time.Minute * 10},
+		{name: "custom", pool: &config.PlaylistPool{MaxNum: 50, RefreshInterval: "5m", RefreshAhead: "30s"}, maxNum: 50, refresh: time.Minute * 5},
+		{name: "negative max-num", pool: &config.PlaylistPool{MaxNum: -1}, wantErr: true},
+		{name: "ahead too long", pool: &config.PlaylistPool{RefreshInterval: "5m", RefreshAhead: "5m"}, wantErr: true},
+		{name: "remove before stop", pool: &config.PlaylistPool{StopUpdateAfter: "2h", RemoveAfter: "1h"}, wantErr: true},
+		{name: "invalid duration", pool: &config.PlaylistPool{RefreshInterval: "10x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vp := config.VideoPreview{Playlist: tt.pool}
+			err := vp.Init()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("期望错误: %v, 实际: %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if vp.Playlist.MaxNum != tt.maxNum || vp.Playlist.RefreshDuration() != tt.refresh {
+				t.Fatalf("配置解析错误, max-num: %d, refresh: %v", vp.Playlist.MaxNum, vp.Playlist.RefreshDuration())
+			}
+		})
+	}
+}
@@ -5,6 +5,9 @@ const (
 	RepoAddr       = "https://github.com/AmbitiousJun/go-emby2openlist"
 )
 
+// Pattern_ItemId 资源 id, 兼容 emby 的数字 id 和 jellyfin 的 GUID (可以不带 - 符号)
+const Pattern_ItemId = `(?:\d+|[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12})`
+
 const (
 	Reg_Socket       = `(?i)^/.*(socket|embywebsocket)`
 	Reg_PlaybackInfo = `(?i)^/.*items/.*/playbackinfo\??`
@@ -12,11 +15,11 @@ const (
 	Reg_PlayingStopped  = `(?i)^/.*sessions/playing/stopped`
 	Reg_PlayingProgress = `(?i)^/.*sessions/playing/progress`
 
-	Reg_UserItems                = `(?i)^/.*users/.*/items/\d+($|\?)`
+	Reg_UserItems                = `(?i)^/.*users/.*/items/` + Pattern_ItemId + `($|\?)`
 	Reg_UserEpisodeItems         = `(?i)^/.*users/.*/items\?.*includeitemtypes=(episode|movie)`
 	Reg_UserItemsRandomResort    = `(?i)^/.*users/.*/items\?.*SortBy=Random`
 	Reg_UserItemsRandomWithLimit = `(?i)^/.*users/.*/items/with_limit\?.*SortBy=Random`
-	Reg_UserPlayedItems          = `(?i)^/.*users/.*/playeditems/(\d+)($|\?|/.*)?`
+	Reg_UserPlayedItems          = `(?i)^/.*users/.*/playeditems/(` + Pattern_ItemId + `)($|\?|/.*)?`
 	Reg_UserLatestItems          = `(?i)^/.*users/.*/items/latest($|\?)`
 
 	Reg_ShowEpisodes   = `(?i)^/.*shows/.*/episodes\??`
@@ -26,11 +29,13 @@ const (
 	Reg_ResourceMaster = `(?i)^/.*(videos|audio)/.*/(master)(\.\w+)?\??`
 	Reg_ResourceMain   = `(?i)^/.*(videos|audio)/.*/main.m3u8\??`
 
+	Reg_ProxyMaster   = `(?i)^/.*videos/proxy_master\??`
 	Reg_ProxyPlaylist = `(?i)^/.*videos/proxy_playlist\??`
+	Reg_ProxyDash     = `(?i)^/.*videos/proxy_mpd\??`
 	Reg_ProxyTs       = `(?i)^/.*videos/proxy_ts\??`
 	Reg_ProxySubtitle = `(?i)^/.*videos/proxy_subtitle\??`
 
-	Reg_ItemDownload     = `(?i)^/.*items/\d+/download($|\?)`
+	Reg_ItemDownload     = `(?i)^/.*items/` + Pattern_ItemId + `/download($|\?)`
 	Reg_ItemSyncDownload = `(?i)^/.*sync/jobitems/\d+/file($|\?)`
 
 	Reg_Images             = `(?i)^/.*images`
@@ -42,6 +47,12 @@ const (
 	Route_CustomJs  = `/ge2o/custom.js`
 	Route_CustomCss = `/ge2o/custom.css`
 
+	Reg_Admin   = `(?i)^/ge2o/admin/`
+	Reg_Metrics = `^/metrics($|\?)`
+	Reg_Healthz = `(?i)^/ge2o/healthz($|\?)`
+	Reg_Readyz  = `(?i)^/ge2o/readyz($|\?)`
+	Reg_Strm    = `(?i)^/ge2o/strm/`
+
 	Reg_All = `.*`
 )
 
@@ -0,0 +1,196 @@
+// 简易的 Prometheus 指标实现, 以文本格式对外暴露
+//
+// 只实现了程序需要用到的 counter, gauge, histogram 三种指标类型
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Namespace 所有指标名称的前缀
+const Namespace = "ge2o_"
+
+// DefBuckets 默认的耗时分布桶 (秒)
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector 指标收集器
+type collector interface {
+	// write 按照 Prometheus 文本格式输出指标
+	write(w io.Writer)
+}
+
+var (
+	// registry 已注册的所有指标
+	registry []collector
+
+	// registryNames 已注册的指标名称, 防止重复注册
+	registryNames = map[string]struct{}{}
+
+	// registryMu 控制指标注册
+	registryMu sync.RWMutex
+)
+
+// register 注册指标, 名称重复时 panic
+func register(name string, c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registryNames[name]; ok {
+		panic("指标重复注册: " + name)
+	}
+	registryNames[name] = struct{}{}
+	registry = append(registry, c)
+}
+
+// WriteAll 输出所有已注册的指标
+func WriteAll(w io.Writer) {
+	registryMu.RLock()
+	cs := slices.Clone(registry)
+	registryMu.RUnlock()
+	for _, c := range cs {
+		c.write(w)
+	}
+}
+
+// series 一个指标下的所有标签组合
+type series[T any] struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu     sync.RWMutex
+	values map[string]T
+	keys   map[string][]string // 记录每个组合对应的标签值
+	newVal func() T
+}
+
+func newSeries[T any](name, help, typ string, labels []string, newVal func() T) *series[T] {
+	return &series[T]{
+		name:   Namespace + name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		values: map[string]T{},
+		keys:   map[string][]string{},
+		newVal: newVal,
+	}
+}
+
+// get 获取指定标签值对应的指标值, 不存在时初始化
+func (s *series[T]) get(labelValues []string) T {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("指标 %s 标签数量不匹配, 需要: %v, 实际: %v", s.name, s.labels, labelValues))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	s.mu.RLock()
+	v, ok := s.values[key]
+	s.mu.RUnlock()
+	if ok {
+		return v
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok = s.values[key]; ok {
+		return v
+	}
+	v = s.newVal()
+	s.values[key] = v
+	s.keys[key] = slices.Clone(labelValues)
+	return v
+}
+
+// rangeSorted 按照标签值顺序遍历所有指标值
+func (s *series[T]) rangeSorted(fn func(labelValues []string, v T)) {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	s.mu.RUnlock()
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		s.mu.RLock()
+		v, lvs := s.values[key], s.keys[key]
+		s.mu.RUnlock()
+		fn(lvs, v)
+	}
+}
+
+// writeHeader 输出指标的 HELP 和 TYPE 信息
+func (s *series[T]) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", s.name, s.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", s.name, s.typ)
+}
+
+// formatLabels 将标签转换成 {k="v",...} 格式, extra 为额外追加的标签键值对
+func formatLabels(names, values []string, extra ...string) string {
+	pairs := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		pairs = append(pairs, name+"="+quoteLabel(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+quoteLabel(extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelEscaper Prometheus 文本格式中标签值需要转义的字符
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel 按照 Prometheus 文本格式转义标签值并加上引号, 非 ASCII 字符原样输出
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+// formatFloat 格式化指标数值
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// atomicFloat 支持并发读写的 float64
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+func (f *atomicFloat) Store(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func (f *atomicFloat) Add(delta float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Handle 以 Prometheus 文本格式响应所有指标
+func Handle(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	WriteAll(c.Writer)
+}
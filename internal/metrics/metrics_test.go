@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "test counter", "route", "code")
+	c.Inc("/a", "200")
+	c.Inc("/a", "200")
+	c.Add(3, "/b", "500")
+
+	g := NewGaugeVec("test_bytes", "test gauge")
+	g.Set(10)
+	g.Add(-4)
+
+	h := NewHistogramVec("test_duration_seconds", "test histogram", []float64{1, 0.1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.1, "/a")
+	h.Observe(5, "/a")
+
+	buf := new(bytes.Buffer)
+	c.write(buf)
+	g.write(buf)
+	h.write(buf)
+	got := buf.String()
+
+	for _, want := range []string{
+		"# TYPE ge2o_test_requests_total counter\n",
+		`ge2o_test_requests_total{route="/a",code="200"} 2` + "\n",
+		`ge2o_test_requests_total{route="/b",code="500"} 3` + "\n",
+		"# TYPE ge2o_test_bytes gauge\n",
+		"ge2o_test_bytes 6\n",
+		`ge2o_test_duration_seconds_bucket{route="/a",le="0.1"} 2` + "\n",
+		`ge2o_test_duration_seconds_bucket{route="/a",le="1"} 2` + "\n",
+		`ge2o_test_duration_seconds_bucket{route="/a",le="+Inf"} 3` + "\n",
+		`ge2o_test_duration_seconds_sum{route="/a"} 5.15` + "\n",
+		`ge2o_test_duration_seconds_count{route="/a"} 3` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in output:\n%s", want, got)
+		}
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "/电影/a.mkv", want: `{route="/电影/a.mkv"}`},
+		{value: `a"b\c`, want: `{route="a\"b\\c"}`},
+		{value: "a\nb\t", want: `{route="a\nb` + "\t" + `"}`},
+	}
+	for _, tt := range tests {
+		if got := formatLabels([]string{"route"}, []string{tt.value}); got != tt.want {
+			t.Fatalf("标签格式错误, 期望: %s, 实际: %s", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+)
+
+// CounterVec 只增不减的计数器
+type CounterVec struct {
+	s *series[*atomicFloat]
+}
+
+// NewCounterVec 创建并注册一个计数器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{s: newSeries(name, help, "counter", labels, func() *atomicFloat { return new(atomicFloat) })}
+	register(c.s.name, c)
+	return c
+}
+
+// Inc 计数加一
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.s.get(labelValues).Add(1)
+}
+
+// Add 计数增加指定值, 值必须大于等于 0
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.s.get(labelValues).Add(v)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.s.writeHeader(w)
+	c.s.rangeSorted(func(lvs []string, v *atomicFloat) {
+		fmt.Fprintf(w, "%s%s %s\n", c.s.name, formatLabels(c.s.labels, lvs), formatFloat(v.Load()))
+	})
+}
+
+// GaugeVec 可增可减的仪表盘
+type GaugeVec struct {
+	s *series[*atomicFloat]
+}
+
+// NewGaugeVec 创建并注册一个仪表盘
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{s: newSeries(name, help, "gauge", labels, func() *atomicFloat { return new(atomicFloat) })}
+	register(g.s.name, g)
+	return g
+}
+
+// Set 设置当前值
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.s.get(labelValues).Store(v)
+}
+
+// Add 增加指定值, 传递负数即为减少
+func (g *GaugeVec) Add(v float64, labelValues ...string) {
+	g.s.get(labelValues).Add(v)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.s.writeHeader(w)
+	g.s.rangeSorted(func(lvs []string, v *atomicFloat) {
+		fmt.Fprintf(w, "%s%s %s\n", g.s.name, formatLabels(g.s.labels, lvs), formatFloat(v.Load()))
+	})
+}
+
+// HistogramVec 数值分布直方图
+type HistogramVec struct {
+	s       *series[*histogram]
+	buckets []float64
+}
+
+// histogram 一组标签对应的直方图数据
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64 // 每个桶的计数, 不累加
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec 创建并注册一个直方图, buckets 为 nil 时使用 DefBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	h := &HistogramVec{buckets: buckets}
+	h.s = newSeries(name, help, "histogram", labels, func() *histogram {
+		return &histogram{counts: make([]uint64, len(buckets))}
+	})
+	register(h.s.name, h)
+	return h
+}
+
+// Observe 记录一个观测值
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	hg := h.s.get(labelValues)
+	idx, _ := slices.BinarySearch(h.buckets, v)
+
+	hg.mu.Lock()
+	defer hg.mu.Unlock()
+	if idx < len(hg.counts) {
+		hg.counts[idx]++
+	}
+	hg.sum += v
+	hg.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.s.writeHeader(w)
+	h.s.rangeSorted(func(lvs []string, hg *histogram) {
+		hg.mu.Lock()
+		counts, sum, count := slices.Clone(hg.counts), hg.sum, hg.count
+		hg.mu.Unlock()
+
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.s.name, formatLabels(h.s.labels, lvs, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.s.name, formatLabels(h.s.labels, lvs, "le", formatFloat(math.Inf(1))), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.s.name, formatLabels(h.s.labels, lvs), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.s.name, formatLabels(h.s.labels, lvs), count)
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/model"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,7 +20,7 @@ import (
 // 如果请求是失败的响应, 会直接返回客户端, 并在第二个参数中返回 false
 func proxyAndSetRespHeader(c *gin.Context) (model.HttpRes[*jsons.Item], bool) {
 	c.Request.Header.Del("Accept-Encoding")
-	res, respHeader := RawFetch(c.Request.URL.String(), c.Request.Method, c.Request.Header, c.Request.Body)
+	res, respHeader := RawFetch(upstream.Of(c), c.Request.URL.String(), c.Request.Method, c.Request.Header, c.Request.Body)
 	if res.Code != http.StatusOK {
 		checkErr(c, errors.New(res.Msg))
 		return res, false
@@ -28,14 +29,14 @@ func proxyAndSetRespHeader(c *gin.Context) (model.HttpRes[*jsons.Item], bool) {
 	return res, true
 }
 
-// Fetch 请求 emby api 接口, 使用 map 请求体
-func Fetch(uri, method string, header http.Header, body map[string]any) (model.HttpRes[*jsons.Item], http.Header) {
-	return RawFetch(uri, method, header, https.MapBody(body))
+// Fetch 请求上游 emby api 接口, 使用 map 请求体
+func Fetch(up *config.EmbyUpstream, uri, method string, header http.Header, body map[string]any) (model.HttpRes[*jsons.Item], http.Header) {
+	return RawFetch(up, uri, method, header, https.MapBody(body))
 }
 
-// RawFetch 请求 emby api 接口, 使用流式请求体
-func RawFetch(uri, method string, header http.Header, body io.ReadCloser) (model.HttpRes[*jsons.Item], http.Header) {
-	u := config.C.Emby.Host + uri
+// RawFetch 请求上游 emby api 接口, 使用流式请求体
+func RawFetch(up *config.EmbyUpstream, uri, method string, header http.Header, body io.ReadCloser) (model.HttpRes[*jsons.Item], http.Header) {
+	u := up.Host + uri
 
 	// 构造请求头, 发出请求
 	if header == nil {
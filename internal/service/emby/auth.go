@@ -2,18 +2,16 @@ package emby
 
 import (
 	"io"
-	"log"
 	"net/http"
 	"regexp"
 	"strings"
 	"sync"
 
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/constant"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,6 +23,8 @@ const AuthUri = "/emby/Auth/Keys"
 
 // validApiKeys 已经校验通过的 api_key, 下次就不再校验
 //
+// key 为上游名称和 api_key 的组合, 不同上游服务器的 api_key 互不信任
+//
 // 这个 map 不会进行大小限制, 考虑到 emby 原服务器中合法的 api_key 个数不是无限个
 // 所以这里也不用限制太多
 var validApiKeys = sync.Map{}
@@ -58,7 +58,9 @@ func ApiKeyChecker() gin.HandlerFunc {
 		regexp.MustCompile(constant.Reg_ItemDownload),
 		regexp.MustCompile(constant.Reg_ItemSyncDownload),
 		regexp.MustCompile(constant.Reg_VideoSubtitles),
+		regexp.MustCompile(constant.Reg_ProxyMaster),
 		regexp.MustCompile(constant.Reg_ProxyPlaylist),
+		regexp.MustCompile(constant.Reg_ProxyDash),
 		regexp.MustCompile(constant.Reg_ProxyTs),
 		regexp.MustCompile(constant.Reg_ProxySubtitle),
 		regexp.MustCompile(constant.Reg_ShowEpisodes),
@@ -68,9 +70,12 @@ func ApiKeyChecker() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1 取出 api_key
 		kType, kName, apiKey := getApiKey(c)
+		up := upstream.Of(c)
+		validKey := up.Name + "|" + apiKey
 
 		// 2 如果该 key 已经是被信任的, 跳过校验
-		if _, ok := validApiKeys.Load(apiKey); ok {
+		if _, ok := validApiKeys.Load(validKey); ok {
+			apiKeyChecks.Inc("trusted")
 			return
 		}
 
@@ -87,7 +92,10 @@ func ApiKeyChecker() gin.HandlerFunc {
 		}
 
 		// 4 发出请求, 验证 api_key
-		u := config.C.Emby.Host + AuthUri
+		u := up.Host + AuthUri
+		if up.IsJellyfin() {
+			u = up.Host + JellyfinAuthUri
+		}
 		var header http.Header
 		if kType == Query {
 			u = urls.AppendArgs(u, kName, apiKey)
@@ -97,27 +105,30 @@ func ApiKeyChecker() gin.HandlerFunc {
 		}
 		resp, err := https.Get(u).Header(header).Do()
 		if err != nil {
-			log.Printf(colors.ToRed("鉴权失败: %v"), err)
+			logger.Errorf("鉴权失败: %v", err)
+			apiKeyChecks.Inc("error")
 			c.Abort()
 			return
 		}
 		defer resp.Body.Close()
 		bodyBytes, err := io.ReadAll(resp.Body)
 		if err != nil {
-			log.Printf(colors.ToRed("鉴权中间件读取源服务器响应失败: %v"), err)
+			logger.Errorf("鉴权中间件读取源服务器响应失败: %v", err)
 			bodyBytes = []byte(UnauthorizedResp)
 		}
 		respBody := strings.TrimSpace(string(bodyBytes))
 
-		// 5 判断是否被源服务器拒绝
-		if resp.StatusCode == http.StatusUnauthorized && respBody == UnauthorizedResp {
+		// 5 判断是否被源服务器拒绝, jellyfin 拒绝时不一定有响应体
+		if resp.StatusCode == http.StatusUnauthorized && (up.IsJellyfin() || respBody == UnauthorizedResp) {
+			apiKeyChecks.Inc("invalid")
 			c.String(http.StatusUnauthorized, "鉴权失败")
 			c.Abort()
 			return
 		}
 
 		// 6 校验通过, 加入信任集合
-		validApiKeys.Store(apiKey, struct{}{})
+		validApiKeys.Store(validKey, struct{}{})
+		apiKeyChecks.Inc("valid")
 	}
 }
 
@@ -126,6 +137,9 @@ func getApiKey(c *gin.Context) (keyType ApiKeyType, keyName string, apiKey strin
 	if c == nil {
 		return Query, "", ""
 	}
+	if upstream.Of(c).IsJellyfin() {
+		return getJellyfinApiKey(c)
+	}
 
 	keyName = QueryApiKeyName
 	keyType = Query
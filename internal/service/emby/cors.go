@@ -5,8 +5,8 @@ import (
 	"io"
 	"net/http"
 
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,7 +15,7 @@ func ChangeBaseVideoModuleCorsDefined(c *gin.Context) {
 	// 1 代理请求
 	c.Request.Header.Del("If-Modified-Since")
 	c.Request.Header.Del("If-None-Match")
-	resp, err := https.ProxyRequest(c.Request, config.C.Emby.Host)
+	resp, err := https.ProxyRequest(c.Request, upstream.Of(c).Host)
 	if checkErr(c, err) {
 		return
 	}
@@ -3,7 +3,6 @@ package emby
 import (
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -11,9 +10,9 @@ import (
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/constant"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 	"github.com/gin-gonic/gin"
 )
 
@@ -24,7 +23,7 @@ func HandleSyncDownload(c *gin.Context) {
 	if checkErr(c, err) {
 		return
 	}
-	log.Printf(colors.ToBlue("解析出来的 itemInfo 信息: %v"), itemInfo)
+	logger.Infof("解析出来的 itemInfo 信息: %v", itemInfo)
 	if itemInfo.Id == "" {
 		checkErr(c, errors.New("JobItems id 为空"))
 		return
@@ -32,7 +31,7 @@ func HandleSyncDownload(c *gin.Context) {
 
 	// 请求 targets 列表
 	targetUri := "/Sync/Targets?api_key=" + itemInfo.ApiKey
-	resp, _ := Fetch(targetUri, http.MethodGet, nil, nil)
+	resp, _ := Fetch(itemInfo.Upstream, targetUri, http.MethodGet, nil, nil)
 	if resp.Code != http.StatusOK {
 		checkErr(c, fmt.Errorf("请求 emby 失败: %v, uri: %s", resp.Msg, targetUri))
 		return
@@ -53,7 +52,7 @@ func HandleSyncDownload(c *gin.Context) {
 
 		// 请求 Ready 接口
 		readyUri := readyUriTmpl + id
-		resp, _ := Fetch(readyUri, http.MethodGet, nil, nil)
+		resp, _ := Fetch(itemInfo.Upstream, readyUri, http.MethodGet, nil, nil)
 		if resp.Code != http.StatusOK {
 			checkErr(c, fmt.Errorf("请求 emby 失败: %v, uri: %s", resp.Msg, readyUri))
 			return jsons.ErrBreakRange
@@ -87,9 +86,9 @@ func HandleSyncDownload(c *gin.Context) {
 				breakRange = true
 				return jsons.ErrBreakRange
 			}
-			log.Printf(colors.ToGreen("成功匹配到 itemId: %s, mediaSourceId: %s"), itemId, msId)
+			logger.Infof("成功匹配到 itemId: %s, mediaSourceId: %s", itemId, msId)
 
-			newUrl, _ := url.Parse(fmt.Sprintf("/videos/%s/stream?MediaSourceId=%s&api_key=%s&Static=true", itemId, msId, itemInfo.ApiKey))
+			newUrl, _ := url.Parse(upstream.Prefix(c) + fmt.Sprintf("/videos/%s/stream?MediaSourceId=%s&api_key=%s&Static=true", itemId, msId, itemInfo.ApiKey))
 			c.Redirect(http.StatusTemporaryRedirect, newUrl.String())
 			breakRange = true
 			return jsons.ErrBreakRange
@@ -125,7 +124,7 @@ func DownloadStrategyChecker() gin.HandlerFunc {
 			return
 		}
 
-		strategy := config.C.Emby.DownloadStrategy
+		strategy := config.C().Emby.DownloadStrategy
 
 		if strategy == config.DlStrategyDirect {
 			return
@@ -138,8 +137,8 @@ func DownloadStrategyChecker() gin.HandlerFunc {
 		}
 
 		if strategy == config.DlStrategyOrigin {
-			if err := https.ProxyPass(c.Request, c.Writer, config.C.Emby.Host); err != nil {
-				log.Printf(colors.ToRed("下载接口代理失败: %v"), err)
+			if err := https.ProxyPass(c.Request, c.Writer, upstream.Of(c).Host); err != nil {
+				logger.Errorf("下载接口代理失败: %v", err)
 			}
 		}
 
@@ -3,7 +3,6 @@ package emby
 import (
 	"bytes"
 	"io"
-	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -12,14 +11,18 @@ import (
 	"sync"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/webport"
 
 	"github.com/gin-gonic/gin"
 )
 
+// logger emby 模块日志记录器
+var logger = logs.Module("emby")
+
 // NoRedirectClients 不使用重定向的客户端
 var NoRedirectClients = map[string]struct{}{
 	"Emby for iOS":     {},
@@ -29,27 +32,35 @@ var NoRedirectClients = map[string]struct{}{
 
 func ProxySocket() func(*gin.Context) {
 
-	var proxy *httputil.ReverseProxy
-	var once = sync.Once{}
+	// proxies 每个上游服务器的代理对象, key 为上游地址
+	proxies := make(map[string]*httputil.ReverseProxy)
+	var mu = sync.Mutex{}
+
+	// getProxy 获取上游服务器的代理对象, 不存在时初始化
+	getProxy := func(origin string) *httputil.ReverseProxy {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if proxy, ok := proxies[origin]; ok {
+			return proxy
+		}
 
-	initFunc := func() {
-		origin := config.C.Emby.Host
 		u, err := url.Parse(origin)
 		if err != nil {
 			panic("转换 emby host 异常: " + err.Error())
 		}
 
-		proxy = httputil.NewSingleHostReverseProxy(u)
-
+		proxy := httputil.NewSingleHostReverseProxy(u)
 		proxy.Director = func(r *http.Request) {
 			r.URL.Scheme = u.Scheme
 			r.URL.Host = u.Host
 		}
+		proxies[origin] = proxy
+		return proxy
 	}
 
 	return func(c *gin.Context) {
-		once.Do(initFunc)
-		proxy.ServeHTTP(c.Writer, c.Request)
+		getProxy(upstream.Of(c).Host).ServeHTTP(c.Writer, c.Request)
 	}
 }
 
@@ -60,7 +71,7 @@ func HandleImages(c *gin.Context) {
 	q := c.Request.URL.Query()
 	q.Del("quality")
 	q.Del("Quality")
-	q.Set("Quality", strconv.Itoa(config.C.Emby.ImagesQuality))
+	q.Set("Quality", strconv.Itoa(config.C().Emby.ImagesQuality))
 	c.Request.URL.RawQuery = q.Encode()
 	ProxyOrigin(c)
 }
@@ -70,14 +81,14 @@ func ProxyOrigin(c *gin.Context) {
 	if c == nil {
 		return
 	}
-	origin := config.C.Emby.Host
+	origin := upstream.Of(c).Host
 
 	// 传递客户端 IP 到 emby
 	c.Request.Header.Set("X-Forwarded-For", c.ClientIP())
 	c.Request.Header.Set("X-Real-IP", c.ClientIP())
 
 	if err := https.ProxyPass(c.Request, c.Writer, origin); err != nil {
-		log.Printf(colors.ToRed("代理异常: %v"), err)
+		logger.Errorf("代理异常: %v", err)
 	}
 }
 
@@ -120,18 +131,18 @@ func TestProxyUri(c *gin.Context) bool {
 
 	bodyBytes, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		log.Printf(colors.ToRed("测试 uri 执行异常: %v"), err)
+		logger.Errorf("测试 uri 执行异常: %v", err)
 		return false
 	}
 	infos.Body = string(bodyBytes)
 
-	origin := config.C.Emby.Host
+	origin := upstream.Of(c).Host
 	resp, err := https.Request(infos.Method, origin+infos.Uri).
 		Header(c.Request.Header).
 		Body(io.NopCloser(bytes.NewBuffer(bodyBytes))).
 		Do()
 	if err != nil {
-		log.Printf(colors.ToRed("测试 uri 执行异常: %v"), err)
+		logger.Errorf("测试 uri 执行异常: %v", err)
 		return false
 	}
 	defer resp.Body.Close()
@@ -145,12 +156,12 @@ func TestProxyUri(c *gin.Context) bool {
 
 	bodyBytes, err = io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf(colors.ToRed("测试 uri 执行异常: %v"), err)
+		logger.Errorf("测试 uri 执行异常: %v", err)
 		return false
 	}
 	infos.RespBody = string(bodyBytes)
 	infos.RespStatus = resp.StatusCode
-	log.Printf(colors.ToYellow("测试 uri 代理信息: %s"), jsons.FromValue(infos))
+	logger.Warnf("测试 uri 代理信息: %s", jsons.FromValue(infos))
 
 	c.Status(infos.RespStatus)
 	c.Writer.Write(bodyBytes)
@@ -176,17 +187,17 @@ func RedirectOrigin(c *gin.Context) {
 	}
 
 	port, exist := c.Get(webport.GinKey)
-	if config.C.Ssl.Enable && (exist && port == webport.HTTPS) {
+	if config.C().Ssl.Enable && (exist && port == webport.HTTPS) {
 		// https 只能走代理
 		ProxyOrigin(c)
 		return
 	}
 
-	origin := config.C.Emby.Host
+	origin := upstream.Of(c).Host
 	c.Redirect(http.StatusPermanentRedirect, origin+c.Request.URL.String())
 }
 
 // RedirectIndexHtml 重定向到 web 首页
 func RedirectIndexHtml(c *gin.Context) {
-	c.Redirect(http.StatusTemporaryRedirect, "/web/index.html")
+	c.Redirect(http.StatusTemporaryRedirect, upstream.Prefix(c)+"/web/index.html")
 }
@@ -10,6 +10,7 @@ import (
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,8 +21,8 @@ import (
 // 则会将未播剧集排在前面位置
 func ResortEpisodes(c *gin.Context) {
 	// 1 检查配置是否开启
-	if !config.C.Emby.EpisodesUnplayPrior {
-		checkErr(c, https.ProxyPass(c.Request, c.Writer, config.C.Emby.Host))
+	if !config.C().Emby.EpisodesUnplayPrior {
+		checkErr(c, https.ProxyPass(c.Request, c.Writer, upstream.Of(c).Host))
 		return
 	}
 
@@ -33,7 +34,7 @@ func ResortEpisodes(c *gin.Context) {
 
 	// 3 代理请求
 	c.Request.Header.Del("Accept-Encoding")
-	resp, err := https.ProxyRequest(c.Request, config.C.Emby.Host)
+	resp, err := https.ProxyRequest(c.Request, upstream.Of(c).Host)
 	if checkErr(c, err) {
 		return
 	}
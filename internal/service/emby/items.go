@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"math/rand"
 	"net/http"
 	"strconv"
@@ -12,11 +11,11 @@ import (
 	"time"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/jsons"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 
 	"github.com/gin-gonic/gin"
 )
@@ -33,7 +32,7 @@ const (
 // ResortRandomItems 对随机的 items 列表进行重排序
 func ResortRandomItems(c *gin.Context) {
 	// 如果没有开启配置, 代理原请求并返回
-	if !config.C.Emby.ResortRandomItems {
+	if !config.C().Emby.ResortRandomItems {
 		ProxyOrigin(c)
 		return
 	}
@@ -50,7 +49,7 @@ func ResortRandomItems(c *gin.Context) {
 
 	// 缓存空间没有数据时, 默认使用 emby 的原始随机结果
 	if !ok {
-		u := strings.ReplaceAll(https.ClientRequestUrl(c.Request), "/Items", "/Items/with_limit")
+		u := strings.ReplaceAll(upstream.BaseUrl(c)+c.Request.URL.String(), "/Items", "/Items/with_limit")
 		c.Redirect(http.StatusTemporaryRedirect, u)
 		return
 	}
@@ -58,7 +57,7 @@ func ResortRandomItems(c *gin.Context) {
 	bodyBytes := spaceCache.BodyBytes()
 	code := spaceCache.Code()
 	header := spaceCache.Headers()
-	log.Println(colors.ToBlue("使用缓存空间中的 random items 列表"))
+	logger.Info("使用缓存空间中的 random items 列表")
 
 	// 响应客户端, 根据 err 自动判断
 	// 如果 err 不为空, 使用原始 bodyBytes
@@ -67,7 +66,7 @@ func ResortRandomItems(c *gin.Context) {
 	defer func() {
 		respBody, _ := json.Marshal(ih)
 		if err != nil {
-			log.Printf(colors.ToRed("随机排序接口非预期响应, err: %v, 返回原始响应"), err)
+			logger.Errorf("随机排序接口非预期响应, err: %v, 返回原始响应", err)
 			respBody = bodyBytes
 		}
 
@@ -99,7 +98,7 @@ func RandomItemsWithLimit(c *gin.Context) {
 	q.Set("Limit", "500")
 	q.Del("SortOrder")
 	u.RawQuery = q.Encode()
-	embyHost := config.C.Emby.Host
+	embyHost := upstream.Of(c).Host
 	c.Request.Header.Del("Accept-Encoding")
 	resp, err := https.Request(c.Request.Method, embyHost+u.String()).
 		Header(c.Request.Header).
@@ -132,14 +131,15 @@ func calcRandomItemsCacheKey(c *gin.Context) string {
 		c.Query("IsFavorite") +
 		c.Query("IsFolder") +
 		c.Query("ProjectToMedia") +
-		c.Query("ParentId")
+		c.Query("ParentId") +
+		upstream.Of(c).Name
 }
 
 // ProxyAddItemsPreviewInfo 代理 Items 接口, 并附带上转码版本信息
 func ProxyAddItemsPreviewInfo(c *gin.Context) {
 	// 代理请求
 	c.Request.Header.Del("Accept-Encoding")
-	resp, err := https.ProxyRequest(c.Request, config.C.Emby.Host)
+	resp, err := https.ProxyRequest(c.Request, upstream.Of(c).Host)
 	if checkErr(c, err) {
 		return
 	}
@@ -187,7 +187,7 @@ func ProxyAddItemsPreviewInfo(c *gin.Context) {
 			}
 
 			// 检查用户是否启用了转码版本获取
-			if !config.C.VideoPreview.Enable {
+			if !config.C().VideoPreview.Enable {
 				return nil
 			}
 
@@ -210,7 +210,7 @@ func ProxyAddItemsPreviewInfo(c *gin.Context) {
 func ProxyLatestItems(c *gin.Context) {
 	// 代理请求
 	c.Request.Header.Del("Accept-Encoding")
-	resp, err := https.ProxyRequest(c.Request, config.C.Emby.Host)
+	resp, err := https.ProxyRequest(c.Request, upstream.Of(c).Host)
 	if checkErr(c, err) {
 		return
 	}
@@ -0,0 +1,67 @@
+package emby
+
+import (
+	"regexp"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JellyfinAuthUri jellyfin 鉴权接口, 携带无效的 api_key 请求时返回 401
+const JellyfinAuthUri = "/Users/Me"
+
+const (
+	QueryJellyfinApiKeyName = "ApiKey"               // jellyfin 10.9 之后支持的 query 参数
+	HeaderJellyfinTokenName = "X-MediaBrowser-Token" // jellyfin 的 token 请求头
+)
+
+// mediaBrowserTokenRegex 匹配 MediaBrowser 格式认证头中的 Token 字段
+//
+// 例: MediaBrowser Client="Jellyfin Web", Device="Chrome", DeviceId="xxx", Version="10.10.0", Token="xxx"
+var mediaBrowserTokenRegex = regexp.MustCompile(`(?i)(?:^|[\s,])Token="?([^",\s]+)"?`)
+
+// parseMediaBrowserToken 从 MediaBrowser 格式的认证头中解析出 token
+func parseMediaBrowserToken(auth string) (string, bool) {
+	matches := mediaBrowserTokenRegex.FindStringSubmatch(auth)
+	if len(matches) < 2 {
+		return "", false
+	}
+	return matches[1], true
+}
+
+// getJellyfinApiKey 获取 jellyfin 请求中的 api_key 信息
+//
+// jellyfin 的所有接口都支持通过 query 参数 api_key 传递 token,
+// 所以不管 token 是以哪种形式传递的, 都统一转换为 query 参数
+func getJellyfinApiKey(c *gin.Context) (ApiKeyType, string, string) {
+	for _, name := range []string{QueryApiKeyName, QueryJellyfinApiKeyName} {
+		if apiKey := c.Query(name); strs.AllNotEmpty(apiKey) {
+			return Query, QueryApiKeyName, apiKey
+		}
+	}
+
+	for _, name := range []string{QueryTokenName, HeaderJellyfinTokenName} {
+		if apiKey := c.GetHeader(name); strs.AllNotEmpty(apiKey) {
+			return Query, QueryApiKeyName, apiKey
+		}
+	}
+
+	for _, name := range []string{HeaderAuthName, HeaderFullAuthName} {
+		if apiKey, ok := parseMediaBrowserToken(c.GetHeader(name)); ok {
+			return Query, QueryApiKeyName, apiKey
+		}
+	}
+	return Query, QueryApiKeyName, ""
+}
+
+// apiPrefix 获取上游服务器的接口前缀
+//
+// emby 的接口统一带有 /emby 前缀, jellyfin 没有
+func apiPrefix(up *config.EmbyUpstream) string {
+	if up.IsJellyfin() {
+		return ""
+	}
+	return "/emby"
+}
@@ -0,0 +1,41 @@
+package emby
+
+import "testing"
+
+func TestItemIdRegex(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{uri: "/emby/Items/2008/PlaybackInfo?UserId=abc", want: "2008"},
+		{uri: "/emby/videos/2008/stream.mkv?api_key=xxx", want: "2008"},
+		{uri: "/Items/3f2a9b1c8d7e4f60a1b2c3d4e5f60718/PlaybackInfo?UserId=1b2c", want: "3f2a9b1c8d7e4f60a1b2c3d4e5f60718"},
+		{uri: "/Videos/3f2a9b1c-8d7e-4f60-a1b2-c3d4e5f60718/stream.mkv?Static=true", want: "3f2a9b1c-8d7e-4f60-a1b2-c3d4e5f60718"},
+		{uri: "/Items/3f2a9b1c8d7e4f60a1b2c3d4e5f60718/Download", want: "3f2a9b1c8d7e4f60a1b2c3d4e5f60718"},
+	}
+	for _, tt := range tests {
+		matches := itemIdRegex.FindStringSubmatch(tt.uri)
+		if len(matches) < 2 || matches[1] != tt.want {
+			t.Errorf("itemIdRegex(%q) = %v, want %s", tt.uri, matches, tt.want)
+		}
+	}
+}
+
+func TestParseMediaBrowserToken(t *testing.T) {
+	tests := []struct {
+		auth   string
+		want   string
+		wantOk bool
+	}{
+		{auth: `MediaBrowser Client="Jellyfin Web", Device="Chrome", DeviceId="abc", Version="10.10.0", Token="f53f3bf3"`, want: "f53f3bf3", wantOk: true},
+		{auth: `MediaBrowser Token=f53f3bf3, Client="Android TV"`, want: "f53f3bf3", wantOk: true},
+		{auth: `MediaBrowser Client="Jellyfin Web", Device="Chrome", DeviceId="abc", Version="10.10.0"`},
+		{auth: `MediaBrowser Client="Jellyfin Web", DeviceToken="abc"`},
+	}
+	for _, tt := range tests {
+		got, ok := parseMediaBrowserToken(tt.auth)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("parseMediaBrowserToken(%q) = (%s, %v), want (%s, %v)", tt.auth, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -14,95 +13,142 @@ import (
 	"sync"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/constant"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/path"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/jsons"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/randoms"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
 )
 
 // MediaSourceIdSegment 自定义 MediaSourceId 的分隔符
 const MediaSourceIdSegment = "[[_]]"
 
+// AdaptiveTemplateId 自适应清晰度转码版本的模板 id, 播放时返回包含所有清晰度的 master 播放列表
+const AdaptiveTemplateId = "AUTO"
+
+// embyFile Emby 资源的本地文件信息
+type embyFile struct {
+	// Path 资源在 Emby 中的 Path 参数
+	Path string
+
+	// Size 资源的文件大小, 获取不到时为 0
+	Size int64
+}
+
 // getEmbyFileLocalPath 获取 Emby 指定资源的 Path 参数
 //
-// 优先从缓存空间中获取 PlaybackInfo 数据
+// 优先使用预取的结果
 //
 // uri 中必须有 query 参数 MediaSourceId,
 // 如果没有携带该参数, 可能会请求到多个资源, 默认返回第一个资源
-func getEmbyFileLocalPath(itemInfo ItemInfo) (string, error) {
-	var header http.Header
-	if itemInfo.ApiKeyType == Header {
-		// 带上请求头的 api key
-		header = http.Header{itemInfo.ApiKeyName: []string{itemInfo.ApiKey}}
+func getEmbyFileLocalPath(itemInfo ItemInfo) (embyFile, error) {
+	if file, ok := loadPrefetchedFile(itemInfo); ok {
+		logger.Infof("使用预取的资源路径: %s", file.Path)
+		return file, nil
 	}
 
-	resp, err := https.Post(config.C.Emby.Host + itemInfo.PlaybackInfoUri).Header(header).Do()
+	// 相同资源的并发请求, 只向 Emby 发起一次请求
+	key := strings.Join([]string{itemInfo.Upstream.Name, itemInfo.PlaybackInfoUri, itemInfo.MsInfo.OriginId, itemInfo.ApiKey}, "|")
+	file, err, _ := localPathGroup.Do(key, func() (any, error) {
+		return fetchEmbyFileLocalPath(itemInfo)
+	})
 	if err != nil {
-		return "", fmt.Errorf("请求 Emby 接口异常, error: %v", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("请求 Emby 接口异常, error: %s", resp.Status)
+		return embyFile{}, err
 	}
+	return file.(embyFile), nil
+}
 
-	type MediaSourcesHolder struct {
-		MediaSources []struct {
-			Path string
-			Id   string
-		}
-	}
+// localPathGroup 合并 getEmbyFileLocalPath 的并发请求
+var localPathGroup singleflight.Group
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+// fetchEmbyFileLocalPath 请求 Emby 获取资源的 Path 参数
+func fetchEmbyFileLocalPath(itemInfo ItemInfo) (embyFile, error) {
+	sources, err := fetchEmbyMediaSources(itemInfo)
 	if err != nil {
-		return "", fmt.Errorf("读取 Emby 响应异常, error: %v", err)
-	}
-	var holder MediaSourcesHolder
-	if err = json.Unmarshal(bodyBytes, &holder); err != nil {
-		return "", fmt.Errorf("解析 Emby 响应异常, error: %v, 原始响应: %s", err, string(bodyBytes))
-	}
-
-	if len(holder.MediaSources) == 0 {
-		return "", fmt.Errorf("获取不到 MediaSources, 原始响应: %v", string(bodyBytes))
+		return embyFile{}, err
 	}
 
-	var path string
-	var defaultPath string
+	var file embyFile
+	var defaultFile embyFile
 
 	reqId := itemInfo.MsInfo.OriginId
 	// 获取指定 MediaSourceId 的 Path
-	for _, value := range holder.MediaSources {
-		if strs.AnyEmpty(defaultPath) {
+	for _, value := range sources {
+		if strs.AnyEmpty(defaultFile.Path) {
 			// 默认选择第一个路径
-			defaultPath = value.Path
+			defaultFile = value.embyFile
 		}
 		if itemInfo.MsInfo.Empty {
 			// 如果没有传递 MediaSourceId, 就使用默认的 Path
 			break
 		}
 		if value.Id == reqId {
-			path = value.Path
+			file = value.embyFile
 			break
 		}
 	}
 
-	if strs.AllNotEmpty(path) {
-		return path, nil
+	if strs.AllNotEmpty(file.Path) {
+		return file, nil
 	}
-	if strs.AllNotEmpty(defaultPath) {
-		return defaultPath, nil
+	if strs.AllNotEmpty(defaultFile.Path) {
+		return defaultFile, nil
 	}
-	return "", fmt.Errorf("获取不到 Path 参数, 原始响应: %v", string(bodyBytes))
+	return embyFile{}, fmt.Errorf("获取不到 Path 参数, itemId: %s", itemInfo.Id)
+}
+
+// embyMediaSource Emby PlaybackInfo 接口中的单个 MediaSource
+type embyMediaSource struct {
+	embyFile
+	Id string
+}
+
+// fetchEmbyMediaSources 请求 Emby 的 PlaybackInfo 接口获取资源的所有 MediaSource
+func fetchEmbyMediaSources(itemInfo ItemInfo) ([]embyMediaSource, error) {
+	var header http.Header
+	if itemInfo.ApiKeyType == Header {
+		// 带上请求头的 api key
+		header = http.Header{itemInfo.ApiKeyName: []string{itemInfo.ApiKey}}
+	}
+
+	resp, err := https.Post(itemInfo.Upstream.Host + itemInfo.PlaybackInfoUri).Header(header).Do()
+	if err != nil {
+		return nil, fmt.Errorf("请求 Emby 接口异常, error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("请求 Emby 接口异常, error: %s", resp.Status)
+	}
+
+	type MediaSourcesHolder struct {
+		MediaSources []embyMediaSource
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取 Emby 响应异常, error: %v", err)
+	}
+	var holder MediaSourcesHolder
+	if err = json.Unmarshal(bodyBytes, &holder); err != nil {
+		return nil, fmt.Errorf("解析 Emby 响应异常, error: %v, 原始响应: %s", err, string(bodyBytes))
+	}
+
+	if len(holder.MediaSources) == 0 {
+		return nil, fmt.Errorf("获取不到 MediaSources, 原始响应: %v", string(bodyBytes))
+	}
+	return holder.MediaSources, nil
 }
 
 // findVideoPreviewInfos 查找 source 的所有转码资源
 //
 // 传递 resChan 进行异步查询, 通过监听 resChan 获取查询结果
-func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string, resChan chan []*jsons.Item) {
+func findVideoPreviewInfos(up *config.EmbyUpstream, source *jsons.Item, originName, clientApiKey string, resChan chan []*jsons.Item) {
 	if resChan == nil {
 		return
 	}
@@ -114,7 +160,7 @@ func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string,
 	}
 
 	// 未启用配置
-	cfg := config.C.VideoPreview
+	cfg := config.C().VideoPreview
 	srcContainer, _ := source.Attr("Container").String()
 	if !cfg.Enable || !cfg.ContainerValid(srcContainer) {
 		resChan <- nil
@@ -122,7 +168,8 @@ func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string,
 	}
 
 	// 转换 openlist 绝对路径
-	openlistPathRes := path.Emby2Openlist(source.Attr("Path").Val().(string))
+	srcSize, _ := source.Attr("Size").Int64()
+	openlistPathRes := resolveOpenlistPath(up, source.Attr("Path").Val().(string), srcSize)
 	var transcodingList []openlist.TranscodingVideoInfo
 	var subtitleList []openlist.TranscodingSubtitleInfo
 	firstFetchSuccess := false
@@ -145,7 +192,7 @@ func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string,
 	if !firstFetchSuccess {
 		paths, err := openlistPathRes.Range()
 		if err != nil {
-			log.Printf("转换 openlist 路径异常: %v", err)
+			logger.Errorf("转换 openlist 路径异常: %v", err)
 			resChan <- nil
 			return
 		}
@@ -167,47 +214,18 @@ func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string,
 
 	res := make([]*jsons.Item, len(transcodingList))
 	wg := sync.WaitGroup{}
-	itemId, _ := source.Attr("ItemId").String()
 	for idx, transcode := range transcodingList {
 		idx, transcode := idx, transcode
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if config.C.VideoPreview.IsTemplateIgnore(transcode.TemplateId) {
+			if config.C().VideoPreview.IsTemplateIgnore(transcode.TemplateId) {
 				// 当前清晰度被忽略
 				return
 			}
 
-			copySource := jsons.FromValue(source.Struct())
 			format := fmt.Sprintf("%dx%d", transcode.TemplateWidth, transcode.TemplateHeight)
-			copySource.Attr("Name").Set(fmt.Sprintf("(%s_%s) %s", transcode.TemplateId, format, originName))
-
-			// 重要！！！这里的 id 必须和原本的 id 不一样, 但又要确保能够正常反推出原本的 id
-			newId := fmt.Sprintf(
-				"%s%s%s%s%s%s%s",
-				source.Attr("Id").Val(), MediaSourceIdSegment,
-				transcode.TemplateId, MediaSourceIdSegment,
-				format, MediaSourceIdSegment,
-				openlist.PathEncode(openlistPathRes.Path),
-			)
-			copySource.Attr("Id").Set(newId)
-
-			// 设置转码代理播放链接
-			tu, _ := url.Parse(strings.ReplaceAll(MasterM3U8UrlTemplate, "${itemId}", itemId))
-			q := tu.Query()
-			q.Set("openlist_path", openlist.PathEncode(openlistPathRes.Path))
-			q.Set("template_id", transcode.TemplateId)
-			q.Set(QueryApiKeyName, clientApiKey)
-			tu.RawQuery = q.Encode()
-
-			// 标记转码资源使用转码容器
-			copySource.Put("SupportsTranscoding", jsons.FromValue(true))
-			copySource.Put("TranscodingContainer", jsons.FromValue("ts"))
-			copySource.Put("TranscodingSubProtocol", jsons.FromValue("hls"))
-			copySource.Put("TranscodingUrl", jsons.FromValue(tu.String()))
-			copySource.DelKey("DirectStreamUrl")
-			copySource.Put("SupportsDirectPlay", jsons.FromValue(false))
-			copySource.Put("SupportsDirectStream", jsons.FromValue(false))
+			copySource := newPreviewSource(source, originName, openlistPathRes.Path, transcode.TemplateId, format, clientApiKey)
 
 			// 设置转码字幕
 			addSubtitles2MediaStreams(copySource, subtitleList, openlistPathRes.Path, transcode.TemplateId, clientApiKey)
@@ -225,9 +243,61 @@ func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string,
 		}
 		nonNil = append(nonNil, v)
 	}
+
+	// 多个清晰度时, 额外提供一个自适应清晰度的版本, 放在所有转码版本的最前面
+	if cfg.Adaptive && len(nonNil) > 1 {
+		var best openlist.TranscodingVideoInfo
+		for _, transcode := range transcodingList {
+			if !cfg.IsTemplateIgnore(transcode.TemplateId) && transcode.TemplateHeight >= best.TemplateHeight {
+				best = transcode
+			}
+		}
+		format := fmt.Sprintf("%dx%d", best.TemplateWidth, best.TemplateHeight)
+		adaptive := newPreviewSource(source, originName, openlistPathRes.Path, AdaptiveTemplateId, format, clientApiKey)
+		// 字幕与清晰度无关, 使用最高清晰度的模板获取
+		addSubtitles2MediaStreams(adaptive, subtitleList, openlistPathRes.Path, best.TemplateId, clientApiKey)
+		nonNil = append([]*jsons.Item{adaptive}, nonNil...)
+	}
 	resChan <- nonNil
 }
 
+// newPreviewSource 基于原始的 source 生成一个转码版本的 MediaSource
+//
+// format 为转码资源的分辨率, 如: 1920x1080
+func newPreviewSource(source *jsons.Item, originName, openlistPath, templateId, format, clientApiKey string) *jsons.Item {
+	copySource := jsons.FromValue(source.Struct())
+	copySource.Attr("Name").Set(fmt.Sprintf("(%s_%s) %s", templateId, format, originName))
+
+	// 重要！！！这里的 id 必须和原本的 id 不一样, 但又要确保能够正常反推出原本的 id
+	newId := fmt.Sprintf(
+		"%s%s%s%s%s%s%s",
+		source.Attr("Id").Val(), MediaSourceIdSegment,
+		templateId, MediaSourceIdSegment,
+		format, MediaSourceIdSegment,
+		openlist.PathEncode(openlistPath),
+	)
+	copySource.Attr("Id").Set(newId)
+
+	// 设置转码代理播放链接
+	itemId, _ := source.Attr("ItemId").String()
+	tu, _ := url.Parse(strings.ReplaceAll(MasterM3U8UrlTemplate, "${itemId}", itemId))
+	q := tu.Query()
+	q.Set("openlist_path", openlist.PathEncode(openlistPath))
+	q.Set("template_id", templateId)
+	q.Set(QueryApiKeyName, clientApiKey)
+	tu.RawQuery = q.Encode()
+
+	// 标记转码资源使用转码容器
+	copySource.Put("SupportsTranscoding", jsons.FromValue(true))
+	copySource.Put("TranscodingContainer", jsons.FromValue("ts"))
+	copySource.Put("TranscodingSubProtocol", jsons.FromValue("hls"))
+	copySource.Put("TranscodingUrl", jsons.FromValue(tu.String()))
+	copySource.DelKey("DirectStreamUrl")
+	copySource.Put("SupportsDirectPlay", jsons.FromValue(false))
+	copySource.Put("SupportsDirectStream", jsons.FromValue(false))
+	return copySource
+}
+
 // addSubtitles2MediaStreams 添加转码字幕到 PlaybackInfo 的 MediaStreams 项中
 //
 // subtitleList 是请求 openlist 转码信息接口获取到的字幕列表
@@ -299,7 +369,9 @@ func findMediaSourceName(source *jsons.Item) string {
 }
 
 // itemIdRegex 用于匹配出请求 uri 中的 itemId
-var itemIdRegex = regexp.MustCompile(`(?:/emby)?/.*/(\d+)(?:/|\?)?`)
+//
+// id 后面必须紧跟 / 或 ? 或结束, 避免只匹配到 jellyfin GUID 开头的数字
+var itemIdRegex = regexp.MustCompile(`(?:/emby)?/.*/(` + constant.Pattern_ItemId + `)(?:/|\?|$)`)
 
 // resolveItemInfo 解析 emby 资源 item 信息
 func resolveItemInfo(c *gin.Context) (ItemInfo, error) {
@@ -313,7 +385,7 @@ func resolveItemInfo(c *gin.Context) (ItemInfo, error) {
 	if len(matches) < 2 {
 		return ItemInfo{}, fmt.Errorf("itemId 匹配失败, uri: %s", uri)
 	}
-	itemInfo := ItemInfo{Id: matches[1]}
+	itemInfo := ItemInfo{Id: matches[1], Upstream: upstream.Of(c)}
 
 	// 获取客户端请求的 api_key
 	itemInfo.ApiKeyType, itemInfo.ApiKeyName, itemInfo.ApiKey = getApiKey(c)
@@ -325,10 +397,13 @@ func resolveItemInfo(c *gin.Context) (ItemInfo, error) {
 	}
 	itemInfo.MsInfo = msInfo
 
-	u, err := url.Parse(fmt.Sprintf("/Items/%s/PlaybackInfo", itemInfo.Id))
-	if err != nil {
-		return ItemInfo{}, fmt.Errorf("构建 PlaybackInfo uri 失败, err: %v", err)
-	}
+	itemInfo.PlaybackInfoUri = buildPlaybackInfoUri(itemInfo)
+	return itemInfo, nil
+}
+
+// buildPlaybackInfoUri 构建向 Emby 查询 item 信息的 PlaybackInfo uri
+func buildPlaybackInfoUri(itemInfo ItemInfo) string {
+	u := url.URL{Path: fmt.Sprintf("/Items/%s/PlaybackInfo", itemInfo.Id)}
 	q := u.Query()
 	// 默认只携带 query 形式的 api key
 	if itemInfo.ApiKeyType == Query {
@@ -337,13 +412,11 @@ func resolveItemInfo(c *gin.Context) (ItemInfo, error) {
 	q.Set("reqformat", "json")
 	q.Set("IsPlayback", "false")
 	q.Set("AutoOpenLiveStream", "false")
-	if !msInfo.Empty {
-		q.Set("MediaSourceId", msInfo.OriginId)
+	if !itemInfo.MsInfo.Empty {
+		q.Set("MediaSourceId", itemInfo.MsInfo.OriginId)
 	}
 	u.RawQuery = q.Encode()
-	itemInfo.PlaybackInfoUri = u.String()
-
-	return itemInfo, nil
+	return u.String()
 }
 
 // getRequestMediaSourceId 尝试从请求参数或请求体中获取 MediaSourceId 信息
@@ -354,10 +427,11 @@ func getRequestMediaSourceId(c *gin.Context) string {
 		return ""
 	}
 
-	// 1 从请求参数中获取
-	q := c.Query("MediaSourceId")
-	if strs.AllNotEmpty(q) {
-		return q
+	// 1 从请求参数中获取, jellyfin 客户端使用小驼峰的参数名
+	for _, key := range []string{"MediaSourceId", "mediaSourceId"} {
+		if q := c.Query(key); strs.AllNotEmpty(q) {
+			return q
+		}
 	}
 
 	// 2 从请求体中获取
@@ -418,7 +492,7 @@ func getAllPreviewTemplateIds() []string {
 
 	res := []string{}
 	for _, id := range allIds {
-		if config.C.VideoPreview.IsTemplateIgnore(id) {
+		if config.C().VideoPreview.IsTemplateIgnore(id) {
 			continue
 		}
 		res = append(res, id)
@@ -0,0 +1,12 @@
+package emby
+
+import "github.com/AmbitiousJun/go-emby2openlist/v2/internal/metrics"
+
+// apiKeyChecks api_key 校验结果统计, result 取值: trusted, valid, invalid, error
+var apiKeyChecks = metrics.NewCounterVec("emby_api_key_checks_total", "api_key 鉴权中间件的校验结果", "result")
+
+// prefetchTotal 下一集预取结果统计, result 取值: success, error
+var prefetchTotal = metrics.NewCounterVec("emby_prefetch_total", "下一集预取的结果", "result")
+
+// proxyStreamTotal 代理传输结果统计, result 取值: success, aborted, error
+var proxyStreamTotal = metrics.NewCounterVec("emby_proxy_stream_total", "代理传输播放资源的结果", "result")
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -14,11 +13,11 @@ import (
 	"time"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/jsons"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 
 	"github.com/gin-gonic/gin"
 )
@@ -48,10 +47,11 @@ var (
 func TransferPlaybackInfo(c *gin.Context) {
 	// 1 解析资源信息
 	itemInfo, err := resolveItemInfo(c)
-	log.Printf(colors.ToBlue("ItemInfo 解析结果: %s"), itemInfo)
+	logger.Infof("ItemInfo 解析结果: %s", itemInfo)
 	if checkErr(c, err) {
 		return
 	}
+	recordPlaybackInfoRequest(c, itemInfo)
 
 	// 如果是远程资源, 直接代理到源服务器
 	if handleRemotePlayback(c, itemInfo) {
@@ -70,7 +70,7 @@ func TransferPlaybackInfo(c *gin.Context) {
 	c.Request.Header.Del("Accept-Encoding")
 	originRequestBody := c.Request.Body
 	c.Request.Body = io.NopCloser(bytes.NewBufferString(PlaybackCommonPayload))
-	res, respHeader := RawFetch(itemInfo.PlaybackInfoUri, c.Request.Method, c.Request.Header, c.Request.Body)
+	res, respHeader := RawFetch(itemInfo.Upstream, itemInfo.PlaybackInfoUri, c.Request.Method, c.Request.Header, c.Request.Body)
 	if res.Code != http.StatusOK {
 		checkErr(c, errors.New(res.Msg))
 		return
@@ -85,12 +85,12 @@ func TransferPlaybackInfo(c *gin.Context) {
 	}
 
 	if mediaSources.Empty() {
-		log.Println(colors.ToYellow("没有找到可播放的资源"))
+		logger.Warn("没有找到可播放的资源")
 		jsons.OkResp(c.Writer, resJson)
 		return
 	}
 
-	log.Printf(colors.ToBlue("获取到的 MediaSources 个数: %d"), mediaSources.Len())
+	logger.Infof("获取到的 MediaSources 个数: %d", mediaSources.Len())
 	var haveReturned = errors.New("have returned")
 	resChans := make([]chan []*jsons.Item, 0)
 	err = mediaSources.RangeArr(func(_ int, source *jsons.Item) error {
@@ -104,7 +104,7 @@ func TransferPlaybackInfo(c *gin.Context) {
 
 		// 提前触发转码版本收集
 		resChan := make(chan []*jsons.Item, 1)
-		go findVideoPreviewInfos(source, name, itemInfo.ApiKey, resChan)
+		go findVideoPreviewInfos(itemInfo.Upstream, source, name, itemInfo.ApiKey, resChan)
 
 		// 如果客户端请求携带了 MediaSourceId 参数
 		// 在返回数据时, 需要重新设置回原始的 Id
@@ -122,7 +122,7 @@ func TransferPlaybackInfo(c *gin.Context) {
 
 		// 如果是本地媒体, 不处理
 		embyPath, _ := source.Attr("Path").String()
-		if strings.HasPrefix(embyPath, config.C.Emby.LocalMediaRoot) {
+		if strings.HasPrefix(embyPath, itemInfo.Upstream.LocalMediaRoot) {
 			return nil
 		}
 
@@ -134,7 +134,7 @@ func TransferPlaybackInfo(c *gin.Context) {
 			itemInfo.Id, source.Attr("Id").Val(), itemInfo.ApiKeyName, itemInfo.ApiKey,
 		)
 		source.Put("DirectStreamUrl", jsons.FromValue(newUrl))
-		log.Printf(colors.ToBlue("设置直链播放链接为: %s"), newUrl)
+		logger.Infof("设置直链播放链接为: %s", newUrl)
 
 		// path 解码
 		if path, ok := source.Attr("Path").String(); ok {
@@ -145,7 +145,7 @@ func TransferPlaybackInfo(c *gin.Context) {
 		source.DelKey("TranscodingUrl")
 		source.DelKey("TranscodingSubProtocol")
 		source.DelKey("TranscodingContainer")
-		log.Println(colors.ToBlue("转码配置被移除"))
+		logger.Info("转码配置被移除")
 
 		// 如果是远程资源, 不获取转码地址
 		ir, _ := source.Attr("IsRemote").Bool()
@@ -154,7 +154,7 @@ func TransferPlaybackInfo(c *gin.Context) {
 		}
 
 		// 添加转码 MediaSource 获取
-		cfg := config.C.VideoPreview
+		cfg := config.C().VideoPreview
 		if !msInfo.Empty || !cfg.Enable || !cfg.ContainerValid(source.Attr("Container").Val().(string)) {
 			return nil
 		}
@@ -178,7 +178,7 @@ func TransferPlaybackInfo(c *gin.Context) {
 	for _, resChan := range resChans {
 		previewInfos := <-resChan
 		if len(previewInfos) > 0 {
-			log.Printf(colors.ToGreen("找到 %d 个转码资源信息"), len(previewInfos))
+			logger.Infof("找到 %d 个转码资源信息", len(previewInfos))
 			mediaSources.Append(previewInfos...)
 		}
 	}
@@ -197,7 +197,7 @@ func handleRemotePlayback(c *gin.Context, itemInfo ItemInfo) bool {
 	c.Request.Header.Del("Accept-Encoding")
 	originRequestBody := c.Request.Body
 	c.Request.Body = io.NopCloser(bytes.NewBufferString(PlaybackCommonPayload))
-	res, _ := RawFetch(itemInfo.PlaybackInfoUri, c.Request.Method, c.Request.Header, c.Request.Body)
+	res, _ := RawFetch(itemInfo.Upstream, itemInfo.PlaybackInfoUri, c.Request.Method, c.Request.Header, c.Request.Body)
 	if res.Code != http.StatusOK {
 		return false
 	}
@@ -235,10 +235,15 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 	}
 	reqId := itemInfo.MsInfo.RawId
 
-	if !config.C.Cache.Enable {
+	cacheCfg := config.C().Cache
+	if !cacheCfg.Enable {
 		// 未开启缓存功能
 		return false
 	}
+	if rule, ok := cacheCfg.MatchRule(c.Request.RequestURI); ok && !rule.Enabled() {
+		// PlaybackInfo 接口被缓存规则禁用
+		return false
+	}
 
 	// updateCache 刷新缓存空间的缓存
 	//
@@ -298,7 +303,7 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 		newHeader := spaceCache.Headers()
 		newHeader.Set("Content-Length", strconv.Itoa(len(newBody)))
 		spaceCache.Update(0, newBody, newHeader)
-		log.Printf(colors.ToPurple("刷新缓存空间 PlaybackInfo 信息, space: %s, spaceKey: %s"), spaceCache.Space(), spaceCache.SpaceKey())
+		logger.Infof("刷新缓存空间 PlaybackInfo 信息, space: %s, spaceKey: %s", spaceCache.Space(), spaceCache.SpaceKey())
 	}
 
 	// findMediaSourceAndReturn 从全量 PlaybackInfo 信息中查询指定 MediaSourceId 信息
@@ -306,7 +311,7 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 	findMediaSourceAndReturn := func(spaceCache cache.RespCache) bool {
 		jsonBody, err := spaceCache.JsonBody()
 		if err != nil {
-			log.Printf(colors.ToRed("解析缓存响应体失败: %v"), err)
+			logger.Errorf("解析缓存响应体失败: %v", err)
 			return false
 		}
 
@@ -340,7 +345,7 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 	if ok {
 		// 未传递 MediaSourceId, 返回整个缓存数据
 		if itemInfo.MsInfo.Empty {
-			log.Printf(colors.ToBlue("复用缓存空间中的 PlaybackInfo 信息, itemId: %s"), itemInfo.Id)
+			logger.Infof("复用缓存空间中的 PlaybackInfo 信息, itemId: %s", itemInfo.Id)
 			c.Status(spaceCache.Code())
 			https.CloneHeader(c.Writer, spaceCache.Headers())
 			// 避免缓存的请求头中出现脏数据
@@ -362,7 +367,7 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 
 	// 如果是单个查询, 则手动请求一次全量
 	if _, err := fetchFullPlaybackInfo(c, itemInfo); err != nil {
-		log.Printf(colors.ToRed("更新缓存空间 PlaybackInfo 信息异常: %v"), err)
+		logger.Errorf("更新缓存空间 PlaybackInfo 信息异常: %v", err)
 		c.String(http.StatusInternalServerError, "查无缓存, 请稍后尝试重新播放")
 		return true
 	}
@@ -394,7 +399,7 @@ func LoadCacheItems(c *gin.Context) {
 	}()
 
 	// 未开启转码资源获取功能
-	if !config.C.VideoPreview.Enable {
+	if !config.C().VideoPreview.Enable {
 		return
 	}
 
@@ -414,7 +419,7 @@ func LoadCacheItems(c *gin.Context) {
 	if err != nil {
 		return
 	}
-	log.Printf(colors.ToBlue("itemInfo 解析结果: %s"), itemInfo)
+	logger.Infof("itemInfo 解析结果: %s", itemInfo)
 
 	// coverMediaSources 解析 PlaybackInfo 中的 MediaSources 属性
 	// 并覆盖到当前请求的响应中
@@ -424,7 +429,7 @@ func LoadCacheItems(c *gin.Context) {
 		if !ok || cacheMs.Type() != jsons.JsonTypeArr {
 			return false
 		}
-		log.Printf(colors.ToBlue("使用 PlaybackInfo 的 MediaSources 覆盖 Items 接口响应, itemId: %s"), itemInfo.Id)
+		logger.Infof("使用 PlaybackInfo 的 MediaSources 覆盖 Items 接口响应, itemId: %s", itemInfo.Id)
 		resJson.Put("MediaSources", cacheMs)
 		c.Writer.Header().Del("Content-Length")
 		return true
@@ -442,7 +447,7 @@ func LoadCacheItems(c *gin.Context) {
 	// 缓存空间中没有当前 Item 的 PlaybackInfo 数据, 手动请求
 	bodyJson, err := fetchFullPlaybackInfo(c, itemInfo)
 	if err != nil {
-		log.Printf(colors.ToYellow("更新 Items 缓存异常: %v"), err)
+		logger.Warnf("更新 Items 缓存异常: %v", err)
 		return
 	}
 	coverMediaSources(bodyJson)
@@ -450,7 +455,7 @@ func LoadCacheItems(c *gin.Context) {
 
 // fetchFullPlaybackInfo 请求全量的 PlaybackInfo 信息
 func fetchFullPlaybackInfo(c *gin.Context, itemInfo ItemInfo) (*jsons.Item, error) {
-	u, err := url.Parse(https.ClientRequestHost(c.Request) + itemInfo.PlaybackInfoUri)
+	u, err := url.Parse(upstream.BaseUrl(c) + itemInfo.PlaybackInfoUri)
 	if err != nil {
 		return nil, fmt.Errorf("PlaybackInfo 地址异常: %v, uri: %s", err, itemInfo.PlaybackInfoUri)
 	}
@@ -482,7 +487,7 @@ func fetchFullPlaybackInfo(c *gin.Context, itemInfo ItemInfo) (*jsons.Item, erro
 
 // calcPlaybackInfoSpaceCacheKey 根据请求的 item 信息计算 PlaybackInfo 在缓存空间中的 key
 func calcPlaybackInfoSpaceCacheKey(itemInfo ItemInfo) string {
-	return itemInfo.Id + "_" + itemInfo.ApiKey
+	return itemInfo.Id + "_" + itemInfo.ApiKey + "_" + itemInfo.Upstream.Name
 }
 
 // getPlaybackInfoByCacheSpace 从缓存空间中获取 PlaybackInfo 信息
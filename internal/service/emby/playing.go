@@ -4,16 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/jsons"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/randoms"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 	"github.com/gin-gonic/gin"
 )
 
@@ -44,10 +43,7 @@ func PlayingStoppedHelper(c *gin.Context) {
 	}
 
 	// 发送辅助请求记录播放进度
-	itemId, _ := bodyJson.Attr("ItemId").String()
-	if itemIdNum, ok := bodyJson.Attr("ItemId").Int(); ok {
-		itemId = strconv.Itoa(itemIdNum)
-	}
+	itemId := parseItemId(bodyJson)
 	if strs.AnyEmpty(itemId) {
 		return
 	}
@@ -55,7 +51,7 @@ func PlayingStoppedHelper(c *gin.Context) {
 	body.Put("ItemId", jsons.FromValue(itemId))
 	body.Put("PlaySessionId", jsons.FromValue(randoms.RandomHex(32)))
 	body.Put("PositionTicks", jsons.FromValue(bodyJson.Attr("PositionTicks").Val()))
-	go sendPlayingProgress(kType, kName, apiKey, body)
+	go sendPlayingProgress(upstream.Of(c), kType, kName, apiKey, body)
 }
 
 // PlayingProgressHelper 拦截 Progress 请求, 如果进度报告为 0, 认为是无效请求
@@ -71,15 +67,39 @@ func PlayingProgressHelper(c *gin.Context) {
 		return
 	}
 
-	if pt, ok := bodyJson.Attr("PositionTicks").Int64(); ok && pt <= 10_000_000 {
+	pt, ok := bodyJson.Attr("PositionTicks").Int64()
+	if ok && pt <= 10_000_000 {
 		c.Status(http.StatusNoContent)
 		return
 	}
+
+	// 播放进度达到配置的百分比时, 预取下一集
+	if itemId := parseItemId(bodyJson); ok && config.C().Prefetch.Enable && strs.AllNotEmpty(itemId) {
+		kType, kName, apiKey := getApiKey(c)
+		go prefetchNextEpisode(prefetchRequest{
+			up:            upstream.Of(c),
+			header:        c.Request.Header.Clone(),
+			kType:         kType,
+			kName:         kName,
+			apiKey:        apiKey,
+			itemId:        itemId,
+			positionTicks: pt,
+		})
+	}
 	ProxyOrigin(c)
 }
 
+// parseItemId 从播放进度报告中解析 ItemId, 兼容数字和字符串两种格式
+func parseItemId(bodyJson *jsons.Item) string {
+	itemId, _ := bodyJson.Attr("ItemId").String()
+	if itemIdNum, ok := bodyJson.Attr("ItemId").Int(); ok {
+		itemId = strconv.Itoa(itemIdNum)
+	}
+	return itemId
+}
+
 // sendPlayingProgress 发送辅助播放进度请求
-func sendPlayingProgress(kType ApiKeyType, kName, apiKey string, body *jsons.Item) {
+func sendPlayingProgress(up *config.EmbyUpstream, kType ApiKeyType, kName, apiKey string, body *jsons.Item) {
 	if body == nil {
 		return
 	}
@@ -103,14 +123,14 @@ func sendPlayingProgress(kType ApiKeyType, kName, apiKey string, body *jsons.Ite
 		return nil
 	}
 
-	log.Printf(colors.ToGray("开始发送辅助 Progress 进度记录, 内容: %v"), body)
-	if err := inner(config.C.Emby.Host + "/emby/Sessions/Playing/Progress"); err != nil {
-		log.Printf(colors.ToYellow("辅助发送 Progress 进度记录失败: %v"), err)
+	logger.Debugf("开始发送辅助 Progress 进度记录, 内容: %v", body)
+	if err := inner(up.Host + apiPrefix(up) + "/Sessions/Playing/Progress"); err != nil {
+		logger.Warnf("辅助发送 Progress 进度记录失败: %v", err)
 		return
 	}
-	if err := inner(config.C.Emby.Host + "/emby/Sessions/Playing/Stopped"); err != nil {
-		log.Printf(colors.ToYellow("辅助发送 Progress 进度记录失败: %v"), err)
+	if err := inner(up.Host + apiPrefix(up) + "/Sessions/Playing/Stopped"); err != nil {
+		logger.Warnf("辅助发送 Progress 进度记录失败: %v", err)
 		return
 	}
-	log.Println(colors.ToGreen("辅助发送 Progress 进度记录成功"))
+	logger.Info("辅助发送 Progress 进度记录成功")
 }
@@ -0,0 +1,401 @@
+package emby
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/strm"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/maps"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/webport"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prefetchTask 正在播放的剧集的预取状态, 每个剧集只预取一次下一集
+type prefetchTask struct {
+	mu sync.Mutex
+
+	// loaded 是否已经获取到剧集信息
+	loaded bool
+
+	// seriesId 剧集所属的剧集 id, 为空表示不是剧集, 不需要预取
+	seriesId string
+
+	// runTimeTicks 剧集时长
+	runTimeTicks int64
+
+	// done 是否已经预取过下一集
+	done bool
+}
+
+// playbackInfoRequest 客户端请求 PlaybackInfo 时的原始请求, 预取下一集的 PlaybackInfo 时复用
+type playbackInfoRequest struct {
+	port   string // 客户端请求的端口
+	method string
+	host   string
+	uri    string // 包含上游路径前缀的请求地址
+	header http.Header
+	body   []byte
+	itemId string
+	msId   string // 请求携带的 MediaSourceId, 为空表示未携带
+}
+
+const (
+	// maxPrefetchEntries 预取状态, 预取资源路径以及 PlaybackInfo 原始请求各自最多保留的数量
+	maxPrefetchEntries = 1000
+
+	// playbackInfoRequestTTL PlaybackInfo 原始请求的保留时间, 需要覆盖单集的播放时长
+	playbackInfoRequestTTL = time.Hour * 12
+)
+
+var (
+	// prefetchTasks 所有正在播放的剧集的预取状态, key 为: 上游名称|itemId|apiKey
+	prefetchTasks = maps.NewExpiring[string, *prefetchTask](maxPrefetchEntries)
+
+	// prefetchedFiles 预取的资源路径, key 为: 上游名称|itemId|MediaSourceId|apiKey
+	prefetchedFiles = maps.NewExpiring[string, embyFile](maxPrefetchEntries)
+
+	// playbackInfoRequests 客户端最近一次请求 PlaybackInfo 的原始请求, key 为: 上游名称|itemId|apiKey
+	playbackInfoRequests = maps.NewExpiring[string, *playbackInfoRequest](maxPrefetchEntries)
+
+	// prefetchHandlers 各个端口的请求处理器, 用于模拟客户端请求 PlaybackInfo
+	prefetchHandlers sync.Map
+)
+
+func init() {
+	// 配置变更后, 路径映射等规则可能已经改变, 丢弃所有的预取结果
+	config.OnReload(func(_, _ *config.Config) {
+		prefetchTasks.Clear()
+		prefetchedFiles.Clear()
+		playbackInfoRequests.Clear()
+	})
+}
+
+// SetPrefetchHandler 设置指定端口的请求处理器
+//
+// 预取下一集的 PlaybackInfo 时, 会通过客户端请求的端口对应的处理器模拟请求,
+// 使响应经过完整的处理器链并写入请求缓存
+func SetPrefetchHandler(port string, h http.Handler) {
+	prefetchHandlers.Store(port, h)
+}
+
+// prefetchRequest 触发预取的播放进度报告信息
+type prefetchRequest struct {
+	up            *config.EmbyUpstream
+	header        http.Header // 客户端的请求头, 预取直链时需要与客户端保持一致
+	kType         ApiKeyType
+	kName         string
+	apiKey        string
+	itemId        string
+	positionTicks int64
+}
+
+// prefetchNextEpisode 根据播放进度报告, 在当前剧集的播放进度达到配置的百分比时,
+// 查找下一集并提前获取资源路径和网盘直链
+func prefetchNextEpisode(req prefetchRequest) {
+	cfg := config.C().Prefetch
+	key := strings.Join([]string{req.up.Name, req.itemId, req.apiKey}, "|")
+	task, _ := prefetchTasks.LoadOrStore(key, &prefetchTask{}, cfg.ExpiredDuration())
+
+	// 上一次进度报告还在处理中, 直接跳过
+	if !task.mu.TryLock() {
+		return
+	}
+	defer task.mu.Unlock()
+	if task.done {
+		return
+	}
+
+	if !task.loaded {
+		seriesId, runTimeTicks, err := fetchEpisodeInfo(req)
+		if err != nil {
+			logger.Warnf("预取下一集失败, 获取剧集信息异常: %v", err)
+			return
+		}
+		task.loaded, task.seriesId, task.runTimeTicks = true, seriesId, runTimeTicks
+	}
+	if task.seriesId == "" || task.runTimeTicks <= 0 {
+		task.done = true
+		return
+	}
+	if req.positionTicks*100 < task.runTimeTicks*int64(cfg.Percent) {
+		return
+	}
+	task.done = true
+	prefetchTasks.Store(key, task, cfg.ExpiredDuration())
+
+	nextId, err := fetchNextEpisodeId(req, task.seriesId)
+	if err != nil {
+		prefetchTotal.Inc("error")
+		logger.Warnf("预取下一集失败, 查找下一集异常: %v", err)
+		return
+	}
+	if nextId == "" {
+		return
+	}
+
+	if err := prefetchItem(req, nextId); err != nil {
+		prefetchTotal.Inc("error")
+		logger.Warnf("预取下一集失败, itemId: %s, err: %v", nextId, err)
+		return
+	}
+	prefetchTotal.Inc("success")
+}
+
+// prefetchItem 预取资源的路径和网盘直链
+func prefetchItem(req prefetchRequest, itemId string) error {
+	itemInfo := ItemInfo{
+		Id:         itemId,
+		MsInfo:     MsInfo{Empty: true},
+		ApiKey:     req.apiKey,
+		ApiKeyType: req.kType,
+		ApiKeyName: req.kName,
+		Upstream:   req.up,
+	}
+	itemInfo.PlaybackInfoUri = buildPlaybackInfoUri(itemInfo)
+	sources, err := fetchEmbyMediaSources(itemInfo)
+	if err != nil {
+		return err
+	}
+
+	ttl := config.C().Prefetch.ExpiredDuration()
+	for i, source := range sources {
+		prefetchedFiles.Store(prefetchedFileKey(req.up, itemId, source.Id, req.apiKey), source.embyFile, ttl)
+		if i == 0 {
+			// 没有携带 MediaSourceId 的请求, 默认使用第一个资源
+			prefetchedFiles.Store(prefetchedFileKey(req.up, itemId, "", req.apiKey), source.embyFile, ttl)
+		}
+	}
+
+	var errs []error
+	for _, source := range sources {
+		if err := prefetchLink(req, source.embyFile, ttl); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		logger.Infof("已预取下一集直链, itemId: %s, path: %s", itemId, source.Path)
+	}
+
+	// 直链预取完成后再请求 PlaybackInfo, 处理器可以直接使用预取结果
+	if err := prefetchPlaybackInfo(req, itemId, sources[0].Id); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// prefetchPlaybackInfo 模拟客户端请求下一集的 PlaybackInfo, 使响应写入请求缓存
+//
+// 缓存 key 由请求方法, 地址, 请求头以及请求体计算得出, 因此需要复用客户端请求当前剧集时的原始请求,
+// 只替换其中的 itemId 和 MediaSourceId, msId 为下一集默认使用的 MediaSourceId
+func prefetchPlaybackInfo(req prefetchRequest, itemId, msId string) error {
+	if !config.C().Cache.Enable {
+		return nil
+	}
+	pr, ok := playbackInfoRequests.Load(playbackInfoRequestKey(req.up, req.itemId, req.apiKey))
+	if !ok {
+		// 客户端没有经过本程序请求当前剧集的 PlaybackInfo
+		return nil
+	}
+	h, ok := prefetchHandlers.Load(pr.port)
+	if !ok {
+		return nil
+	}
+
+	uri, body := strings.Replace(pr.uri, "/"+pr.itemId+"/", "/"+itemId+"/", 1), pr.body
+	if pr.msId != "" {
+		uri = strings.ReplaceAll(uri, pr.msId, msId)
+		body = bytes.ReplaceAll(body, []byte(pr.msId), []byte(msId))
+	}
+	r, err := http.NewRequest(pr.method, uri, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("构造 PlaybackInfo 请求异常: %v", err)
+	}
+	r.RequestURI, r.Host, r.Header = uri, pr.host, pr.header.Clone()
+	if r.Header.Get("Content-Length") != "" {
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	w := &discardWriter{header: make(http.Header)}
+	h.(http.Handler).ServeHTTP(w, r)
+	if https.IsErrorStatus(w.code) {
+		return fmt.Errorf("预取 PlaybackInfo 异常, itemId: %s, 响应码: %d", itemId, w.code)
+	}
+	logger.Infof("已预取下一集 PlaybackInfo, itemId: %s", itemId)
+	return nil
+}
+
+// recordPlaybackInfoRequest 记录客户端请求 PlaybackInfo 的原始请求, 预取下一集时复用
+//
+// 请求转码版本时, 无法推断出下一集对应的 MediaSourceId, 不记录
+func recordPlaybackInfoRequest(c *gin.Context, itemInfo ItemInfo) {
+	cfg := config.C()
+	if !cfg.Prefetch.Enable || !cfg.Cache.Enable || itemInfo.MsInfo.Transcode {
+		return
+	}
+	bodyBytes, newBody, err := https.ExtractReqBody(c.Request.Body)
+	if err != nil {
+		logger.Warnf("记录 PlaybackInfo 请求失败, 读取请求体异常: %v", err)
+		return
+	}
+	c.Request.Body = newBody
+
+	playbackInfoRequests.Store(playbackInfoRequestKey(itemInfo.Upstream, itemInfo.Id, itemInfo.ApiKey), &playbackInfoRequest{
+		port:   c.GetString(webport.GinKey),
+		method: c.Request.Method,
+		host:   c.Request.Host,
+		uri:    upstream.Prefix(c) + c.Request.RequestURI,
+		header: c.Request.Header.Clone(),
+		body:   bodyBytes,
+		itemId: itemInfo.Id,
+		msId:   itemInfo.MsInfo.RawId,
+	}, playbackInfoRequestTTL)
+}
+
+// playbackInfoRequestKey 计算 PlaybackInfo 原始请求的 key
+func playbackInfoRequestKey(up *config.EmbyUpstream, itemId, apiKey string) string {
+	return strings.Join([]string{up.Name, itemId, apiKey}, "|")
+}
+
+// discardWriter 丢弃响应体的 ResponseWriter, 只记录响应码
+type discardWriter struct {
+	header http.Header
+	code   int
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+// prefetchLink 预取资源的网盘直链, 本地媒体和远程 strm 不需要预取
+func prefetchLink(req prefetchRequest, file embyFile, ttl time.Duration) error {
+	if _, ok := strm.ParseLink(file.Path); urls.IsRemote(file.Path) && !ok {
+		return nil
+	}
+	if strings.HasPrefix(file.Path, req.up.LocalMediaRoot) {
+		return nil
+	}
+
+	openlistPathRes := resolveOpenlistPath(req.up, file.Path, file.Size)
+	fi := openlist.FetchInfo{Header: req.header.Clone()}
+	if openlistPathRes.Success {
+		fi.Path = openlistPathRes.Path
+		if res := openlist.PrefetchResource(fi, ttl); res.Code == http.StatusOK {
+			return nil
+		}
+	}
+
+	paths, err := openlistPathRes.Range()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fi.Path = path
+		if res := openlist.PrefetchResource(fi, ttl); res.Code == http.StatusOK {
+			return nil
+		}
+	}
+	return fmt.Errorf("获取直链失败: %s", file.Path)
+}
+
+// loadPrefetchedFile 获取未过期的预取资源路径
+func loadPrefetchedFile(itemInfo ItemInfo) (embyFile, bool) {
+	return prefetchedFiles.Load(prefetchedFileKey(itemInfo.Upstream, itemInfo.Id, itemInfo.MsInfo.OriginId, itemInfo.ApiKey))
+}
+
+// prefetchedFileKey 计算预取资源路径的 key
+func prefetchedFileKey(up *config.EmbyUpstream, itemId, msId, apiKey string) string {
+	return strings.Join([]string{up.Name, itemId, msId, apiKey}, "|")
+}
+
+// fetchEpisodeInfo 获取 item 所属的剧集 id 和时长, 不是剧集时 seriesId 为空
+func fetchEpisodeInfo(req prefetchRequest) (seriesId string, runTimeTicks int64, err error) {
+	var holder struct {
+		Items []struct {
+			Type         string
+			SeriesId     string
+			RunTimeTicks int64
+		}
+	}
+	q := url.Values{"Ids": []string{req.itemId}}
+	if err = fetchEmbyApi(req, "/Items", q, &holder); err != nil {
+		return
+	}
+	if len(holder.Items) == 0 || holder.Items[0].Type != "Episode" {
+		return
+	}
+	return holder.Items[0].SeriesId, holder.Items[0].RunTimeTicks, nil
+}
+
+// fetchNextEpisodeId 通过 /Shows/{seriesId}/Episodes 接口查找下一集的 id, 没有下一集时返回空字符串
+func fetchNextEpisodeId(req prefetchRequest, seriesId string) (string, error) {
+	var holder struct {
+		Items []struct {
+			Id string
+		}
+	}
+	q := url.Values{
+		"StartItemId": []string{req.itemId},
+		"Limit":       []string{"2"},
+	}
+	if err := fetchEmbyApi(req, "/Shows/"+seriesId+"/Episodes", q, &holder); err != nil {
+		return "", err
+	}
+	for i, item := range holder.Items {
+		if item.Id == req.itemId && i+1 < len(holder.Items) {
+			return holder.Items[i+1].Id, nil
+		}
+	}
+	return "", nil
+}
+
+// fetchEmbyApi 使用客户端的 api_key 请求 Emby 的 GET 接口, 将 json 响应解析到 v 中
+func fetchEmbyApi(req prefetchRequest, uri string, q url.Values, v any) error {
+	header := make(http.Header)
+	if req.kType == Query {
+		q.Set(req.kName, req.apiKey)
+	} else {
+		header.Set(req.kName, req.apiKey)
+	}
+	remote := req.up.Host + apiPrefix(req.up) + uri + "?" + q.Encode()
+	resp, err := https.Get(remote).Header(header).Do()
+	if err != nil {
+		return fmt.Errorf("请求 Emby 接口异常: %s, err: %v", uri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("请求 Emby 接口异常: %s, err: %s", uri, resp.Status)
+	}
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取 Emby 响应异常: %v", err)
+	}
+	if err := json.Unmarshal(bodyBytes, v); err != nil {
+		return fmt.Errorf("解析 Emby 响应异常: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package emby
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPrefetchNextEpisode(t *testing.T) {
+	var fsGetCnt, playbackInfoCnt atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/emby/Items":
+			w.Write([]byte(`{"Items":[{"Id":"101","Type":"Episode","SeriesId":"100","RunTimeTicks":1000}]}`))
+		case "/emby/Shows/100/Episodes":
+			if r.URL.Query().Get("StartItemId") != "101" || r.URL.Query().Get("api_key") != "key" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"Items":[{"Id":"101"},{"Id":"102"}]}`))
+		case "/Items/101/PlaybackInfo":
+			w.Write([]byte(`{"MediaSources":[{"Id":"ms101","Name":"S01E01","Path":"/mnt/show/S01E01.mkv","Size":41}]}`))
+		case "/Items/102/PlaybackInfo":
+			playbackInfoCnt.Add(1)
+			w.Write([]byte(`{"MediaSources":[{"Id":"ms102","Name":"S01E02","Path":"/mnt/show/S01E02.mkv","Size":42}]}`))
+		case "/api/fs/get":
+			fsGetCnt.Add(1)
+			w.Write([]byte(`{"code":200,"data":{"raw_url":"https://drive/S01E02.mkv"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+	config.Set(&config.Config{
+		Emby:         &config.Emby{Host: srv.URL, MountPath: "/mnt", LocalMediaRoot: "/local"},
+		Openlist:     &config.Openlist{Host: srv.URL, Token: "token"},
+		VideoPreview: &config.VideoPreview{},
+		Path:         &config.Path{},
+		Cache:        &config.Cache{Enable: true},
+		StrmSync:     &config.StrmSync{},
+		Prefetch:     &config.Prefetch{Enable: true},
+	})
+	for _, i := range []config.Initializer{config.C().Emby, config.C().Cache, config.C().Prefetch} {
+		if err := i.Init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cache.Init(); err != nil {
+		t.Fatal(err)
+	}
+	up := config.C().Emby.DefaultUpstream()
+	header := http.Header{"User-Agent": []string{"test"}}
+	req := prefetchRequest{up: up, header: header, kType: Query, kName: "api_key", apiKey: "key", itemId: "101"}
+
+	// 客户端通过本程序请求 PlaybackInfo, 预取时复用其请求模拟请求下一集
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(cache.CacheableRouteMarker(), cache.RequestCacher())
+	r.POST("/emby/Items/:id/PlaybackInfo", TransferPlaybackInfo)
+	SetPrefetchHandler("", r)
+	requestPlaybackInfo := func(itemId string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		hr := httptest.NewRequest(http.MethodPost, "/emby/Items/"+itemId+"/PlaybackInfo?api_key=key", strings.NewReader(`{"DeviceProfile":{}}`))
+		hr.Header = header.Clone()
+		r.ServeHTTP(w, hr)
+		return w
+	}
+	if w := requestPlaybackInfo("101"); w.Code != http.StatusOK {
+		t.Fatalf("请求 PlaybackInfo 失败: %d, %s", w.Code, w.Body.String())
+	}
+
+	// 播放进度未达到 70%, 不预取
+	req.positionTicks = 500
+	prefetchNextEpisode(req)
+	if fsGetCnt.Load() != 0 {
+		t.Fatal("播放进度未达到时不应预取")
+	}
+
+	req.positionTicks = 800
+	prefetchNextEpisode(req)
+	prefetchNextEpisode(req)
+	if fsGetCnt.Load() != 1 {
+		t.Fatalf("请求直链次数: %d, 期望: 1", fsGetCnt.Load())
+	}
+
+	for _, msId := range []string{"", "ms102"} {
+		itemInfo := ItemInfo{Id: "102", MsInfo: MsInfo{Empty: msId == "", OriginId: msId}, ApiKey: "key", Upstream: up}
+		file, ok := loadPrefetchedFile(itemInfo)
+		if !ok || file.Path != "/mnt/show/S01E02.mkv" || file.Size != 42 {
+			t.Fatalf("预取的资源路径: %v, %v", file, ok)
+		}
+	}
+
+	res := openlist.FetchResource(openlist.FetchInfo{Path: "/show/S01E02.mkv", Header: header})
+	if res.Code != http.StatusOK || res.Data.Url != "https://drive/S01E02.mkv" || fsGetCnt.Load() != 1 {
+		t.Fatalf("直链未命中预取结果: %v, 请求次数: %d", res, fsGetCnt.Load())
+	}
+
+	// 下一集的 PlaybackInfo 直接从请求缓存中响应, 不再请求 Emby, 响应是异步写入缓存的
+	time.Sleep(time.Millisecond * 100)
+	cache.WaitingForHandleChan()
+	cnt := playbackInfoCnt.Load()
+	w := requestPlaybackInfo("102")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ms102") {
+		t.Fatalf("请求 PlaybackInfo 失败: %d, %s", w.Code, w.Body.String())
+	}
+	if got := playbackInfoCnt.Load(); got != cnt {
+		t.Fatalf("下一集 PlaybackInfo 未命中预取的缓存, 请求 Emby 次数: %d, 期望: %d", got, cnt)
+	}
+}
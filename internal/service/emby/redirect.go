@@ -3,7 +3,6 @@ package emby
 import (
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"slices"
@@ -13,11 +12,12 @@ import (
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/path"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/strm"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 
 	"github.com/gin-gonic/gin"
 )
@@ -32,8 +32,13 @@ func Redirect2Transcode(c *gin.Context) {
 		ProxyOrigin(c)
 		return
 	}
-	log.Println(colors.ToBlue("检测到自定义的转码 m3u8 请求, 重定向到本地代理接口"))
-	tu, _ := url.Parse("/videos/proxy_playlist")
+	logger.Info("检测到自定义的转码 m3u8 请求, 重定向到本地代理接口")
+	route := "/videos/proxy_playlist"
+	if templateId == AdaptiveTemplateId {
+		// 自适应清晰度, 返回包含所有清晰度的 master 播放列表
+		route = "/videos/proxy_master"
+	}
+	tu, _ := url.Parse(upstream.Prefix(c) + route)
 	q := tu.Query()
 	q.Set("openlist_path", openlistPath)
 	q.Set(QueryApiKeyName, apiKey)
@@ -49,42 +54,47 @@ func Redirect2OpenlistLink(c *gin.Context) {
 	if checkErr(c, err) {
 		return
 	}
-	log.Printf(colors.ToBlue("解析到的 itemInfo: %v"), itemInfo)
+	logger.Infof("解析到的 itemInfo: %v", itemInfo)
 
 	// 2 如果请求的是转码资源, 重定向到本地的 m3u8 代理服务
 	msInfo := itemInfo.MsInfo
 	useTranscode := !msInfo.Empty && msInfo.Transcode
 	if useTranscode && msInfo.OpenlistPath != "" {
-		u, _ := url.Parse(strings.ReplaceAll(MasterM3U8UrlTemplate, "${itemId}", itemInfo.Id))
+		u, _ := url.Parse(upstream.Prefix(c) + strings.ReplaceAll(MasterM3U8UrlTemplate, "${itemId}", itemInfo.Id))
 		q := u.Query()
 		q.Set("template_id", itemInfo.MsInfo.TemplateId)
 		q.Set(QueryApiKeyName, itemInfo.ApiKey)
 		q.Set("openlist_path", itemInfo.MsInfo.OpenlistPath)
 		u.RawQuery = q.Encode()
-		log.Printf(colors.ToGreen("重定向 playlist: %s"), u.String())
+		logger.Infof("重定向 playlist: %s", u.String())
 		c.Redirect(http.StatusTemporaryRedirect, u.String())
 		return
 	}
 
 	// 3 请求资源在 Emby 中的 Path 参数
-	embyPath, err := getEmbyFileLocalPath(itemInfo)
+	embyFile, err := getEmbyFileLocalPath(itemInfo)
 	if checkErr(c, err) {
 		return
 	}
+	embyPath := embyFile.Path
 
-	// 4 如果是远程地址 (strm), 重定向处理
-	if urls.IsRemote(embyPath) {
-		finalPath := config.C.Emby.Strm.MapPath(embyPath)
+	// 4 如果是远程地址 (strm), 重定向处理, strm 同步生成的链接直接请求 openlist
+	_, isSyncedStrm := strm.ParseLink(embyPath)
+	if urls.IsRemote(embyPath) && !isSyncedStrm {
+		finalPath := itemInfo.Upstream.Strm.MapPath(embyPath)
 		finalPath = getFinalRedirectLink(finalPath, c.Request.Header.Clone())
-		log.Printf(colors.ToGreen("重定向 strm: %s"), finalPath)
+		if tryProxyStream(c, finalPath, embyPath) {
+			return
+		}
+		logger.Infof("重定向 strm: %s", finalPath)
 		c.Header(cache.HeaderKeyExpired, cache.Duration(time.Minute*10))
 		c.Redirect(http.StatusTemporaryRedirect, finalPath)
 		return
 	}
 
 	// 5 如果是本地地址, 回源处理
-	if strings.HasPrefix(embyPath, config.C.Emby.LocalMediaRoot) {
-		log.Printf(colors.ToBlue("本地媒体: %s, 回源处理"), embyPath)
+	if strings.HasPrefix(embyPath, itemInfo.Upstream.LocalMediaRoot) {
+		logger.Infof("本地媒体: %s, 回源处理", embyPath)
 		ProxyOrigin(c)
 		return
 	}
@@ -95,12 +105,12 @@ func Redirect2OpenlistLink(c *gin.Context) {
 		UseTranscode: useTranscode,
 		Format:       msInfo.TemplateId,
 	}
-	openlistPathRes := path.Emby2Openlist(embyPath)
+	openlistPathRes := resolveOpenlistPath(itemInfo.Upstream, embyPath, embyFile.Size)
 
 	allErrors := strings.Builder{}
 	// handleOpenlistResource 根据传递的 path 请求 openlist 资源
 	handleOpenlistResource := func(path string) bool {
-		log.Printf(colors.ToBlue("尝试请求 Openlist 资源: %s"), path)
+		logger.Infof("尝试请求 Openlist 资源: %s", path)
 		fi.Path = path
 		res := openlist.FetchResource(fi)
 
@@ -111,14 +121,17 @@ func Redirect2OpenlistLink(c *gin.Context) {
 
 		// 处理直链
 		if !fi.UseTranscode {
-			log.Printf(colors.ToGreen("请求成功, 重定向到: %s"), res.Data.Url)
+			if tryProxyStream(c, res.Data.Url, path) {
+				return true
+			}
+			logger.Infof("请求成功, 重定向到: %s", res.Data.Url)
 			c.Header(cache.HeaderKeyExpired, cache.Duration(time.Minute*10))
 			c.Redirect(http.StatusTemporaryRedirect, res.Data.Url)
 			return true
 		}
 
 		// 代理转码 m3u
-		u, _ := url.Parse(strings.ReplaceAll(https.ClientRequestHost(c.Request)+MasterM3U8UrlTemplate, "${itemId}", itemInfo.Id))
+		u, _ := url.Parse(strings.ReplaceAll(upstream.BaseUrl(c)+MasterM3U8UrlTemplate, "${itemId}", itemInfo.Id))
 		q := u.Query()
 		q.Set("template_id", itemInfo.MsInfo.TemplateId)
 		q.Set(QueryApiKeyName, itemInfo.ApiKey)
@@ -152,6 +165,22 @@ func Redirect2OpenlistLink(c *gin.Context) {
 	checkErr(c, fmt.Errorf("获取直链失败: %s", allErrors.String()))
 }
 
+// resolveOpenlistPath 将 Emby 资源路径转换为 openlist 资源路径
+//
+// strm 同步生成的链接直接解析出 openlist 路径, 其余路径按照配置的映射规则转换
+func resolveOpenlistPath(up *config.EmbyUpstream, embyPath string, size int64) path.OpenlistPathRes {
+	if openlistPath, ok := strm.ParseLink(embyPath); ok {
+		return path.OpenlistPathRes{
+			Success: true,
+			Path:    openlistPath,
+			Range: func() ([]string, error) {
+				return nil, fmt.Errorf("strm 链接对应的 openlist 资源不存在: %s", openlistPath)
+			},
+		}
+	}
+	return path.Emby2Openlist(up, embyPath, size)
+}
+
 // checkErr 检查 err 是否为空
 // 不为空则根据错误处理策略返回响应
 //
@@ -165,13 +194,13 @@ func checkErr(c *gin.Context, err error) bool {
 	c.Header(cache.HeaderKeyExpired, "-1")
 
 	// 采用拒绝策略, 直接返回错误
-	if config.C.Emby.ProxyErrorStrategy == config.PeStrategyReject {
-		log.Printf(colors.ToRed("代理接口失败: %v"), err)
+	if config.C().Emby.ProxyErrorStrategy == config.PeStrategyReject {
+		logger.Errorf("代理接口失败: %v", err)
 		c.String(http.StatusInternalServerError, "代理接口失败, 请检查日志")
 		return true
 	}
 
-	log.Printf(colors.ToRed("代理接口失败: %v, 回源处理"), err)
+	logger.Errorf("代理接口失败: %v, 回源处理", err)
 	ProxyOrigin(c)
 	return true
 }
@@ -182,7 +211,7 @@ func checkErr(c *gin.Context, err error) bool {
 func getFinalRedirectLink(originLink string, header http.Header) string {
 	finalLink, resp, err := https.Get(originLink).Header(header).DoRedirect()
 	if err != nil {
-		log.Printf(colors.ToYellow("内部重定向失败: %v"), err)
+		logger.Warnf("内部重定向失败: %v", err)
 		return originLink
 	}
 	defer resp.Body.Close()
@@ -0,0 +1,65 @@
+package emby
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderClientName 客户端名称请求头, 也可以通过同名 query 参数传递
+const HeaderClientName = "X-Emby-Client"
+
+// mediaBrowserClientRegex 匹配 MediaBrowser 格式认证头中的 Client 字段
+var mediaBrowserClientRegex = regexp.MustCompile(`(?i)(?:^|[\s,])Client="([^"]*)"`)
+
+// clientName 获取发起请求的客户端名称
+//
+// 依次从 query 参数, 请求头, MediaBrowser 格式的认证头中获取
+func clientName(c *gin.Context) string {
+	if name := c.Query(HeaderClientName); name != "" {
+		return name
+	}
+	if name := c.GetHeader(HeaderClientName); name != "" {
+		return name
+	}
+	for _, name := range []string{HeaderAuthName, HeaderFullAuthName} {
+		if matches := mediaBrowserClientRegex.FindStringSubmatch(c.GetHeader(name)); len(matches) > 1 {
+			return matches[1]
+		}
+	}
+	return ""
+}
+
+// tryProxyStream 如果请求匹配代理传输规则, 则代理传输远程资源
+//
+// resPath 为用于匹配规则的 openlist 资源路径或远程 strm 链接,
+// 请求没有匹配规则时 handled 返回 false, 由调用方继续重定向;
+// 开始传输之前出现异常时 handled 同样返回 false, 调用方可以继续尝试其他资源
+func tryProxyStream(c *gin.Context, remote, resPath string) (handled bool) {
+	rule, ok := config.C().ProxyStream.Match(clientName(c), c.GetHeader("User-Agent"), resPath)
+	if !ok {
+		return false
+	}
+
+	logger.Infof("代理传输: %s, range: %s", resPath, c.GetHeader("Range"))
+	c.Header(cache.HeaderKeyExpired, "-1")
+	err := https.ProxyStream(c.Writer, c.Request, remote, rule.Header())
+	if errors.Is(err, https.ErrStreamAborted) {
+		// 已经开始传输, 通常是客户端拖动进度条等主动断开, 无法再修改响应
+		proxyStreamTotal.Inc("aborted")
+		logger.Debugf("代理传输中断: %s, err: %v", resPath, err)
+		return true
+	}
+	if err != nil {
+		proxyStreamTotal.Inc("error")
+		logger.Warnf("代理传输失败: %s, err: %v", resPath, err)
+		return false
+	}
+	proxyStreamTotal.Inc("success")
+	return true
+}
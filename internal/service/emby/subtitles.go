@@ -7,6 +7,7 @@ import (
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,7 +23,7 @@ func ProxySubtitles(c *gin.Context) {
 	subName := c.Query("sub_name")
 	apiKey := c.Query(QueryApiKeyName)
 	if strs.AllNotEmpty(openlistPath, templateId, subName, apiKey) {
-		u, _ := url.Parse("/videos/proxy_subtitle")
+		u, _ := url.Parse(upstream.Prefix(c) + "/videos/proxy_subtitle")
 		u.RawQuery = c.Request.URL.RawQuery
 		c.Redirect(http.StatusTemporaryRedirect, u.String())
 		return
@@ -3,6 +3,8 @@ package emby
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 )
 
 // MsInfo MediaSourceId 解析信息
@@ -31,12 +33,18 @@ type ItemInfo struct {
 	ApiKeyType      ApiKeyType // emby 接口密钥类型
 	ApiKeyName      string     // emby 接口密钥名称
 	PlaybackInfoUri string     // item 信息查询接口 uri, 通过源服务器查询
+
+	Upstream *config.EmbyUpstream // 请求所属的上游服务器
 }
 
 // String 序列化输出
 func (ii ItemInfo) String() string {
-	return fmt.Sprintf("ItemInfo{Id: [%s], MsInfo: [%v], ApiKey: [%s], ApiKeyType: [%s], ApiKeyName: [%s], PlaybackInfoUri: [%s]}",
-		ii.Id, ii.MsInfo, ii.ApiKey, ii.ApiKeyType, ii.ApiKeyName, ii.PlaybackInfoUri)
+	upName := ""
+	if ii.Upstream != nil {
+		upName = ii.Upstream.Name
+	}
+	return fmt.Sprintf("ItemInfo{Id: [%s], MsInfo: [%v], ApiKey: [%s], ApiKeyType: [%s], ApiKeyName: [%s], PlaybackInfoUri: [%s], Upstream: [%s]}",
+		ii.Id, ii.MsInfo, ii.ApiKey, ii.ApiKeyType, ii.ApiKeyName, ii.PlaybackInfoUri, upName)
 }
 
 // ItemsHolder Emby Items 接口响应接收结构
@@ -0,0 +1,241 @@
+package m3u8
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
+)
+
+const (
+	// mpdTimescale MPD 清单中分片时长的时间单位 (每秒 1000 个单位, 即毫秒)
+	mpdTimescale = 1000
+
+	// subtitleBandwidth 字幕轨道的码率, MPD 规范要求 Representation 必须携带 bandwidth
+	subtitleBandwidth = 256
+)
+
+// MPD 清单使用的 profile 和 scheme
+const (
+	mpdProfileMp2t  = "urn:mpeg:dash:profile:mp2t-main:2011"
+	mpdProfileIsoff = "urn:mpeg:dash:profile:isoff-main:2011"
+	mpdRoleScheme   = "urn:mpeg:dash:role:2011"
+)
+
+// mpd MPEG-DASH 清单 (ISO/IEC 23009-1)
+type mpd struct {
+	XMLName                   xml.Name    `xml:"MPD"`
+	Xmlns                     string      `xml:"xmlns,attr"`
+	Profiles                  string      `xml:"profiles,attr"`
+	Type                      string      `xml:"type,attr"`
+	MediaPresentationDuration string      `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime             string      `xml:"minBufferTime,attr"`
+	Periods                   []mpdPeriod `xml:"Period"`
+}
+
+// mpdPeriod 清单中的一个时间段, 初始化片段发生变化时切换到新的时间段
+type mpdPeriod struct {
+	Id             string             `xml:"id,attr"`
+	Start          string             `xml:"start,attr"`
+	Duration       string             `xml:"duration,attr"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+// mpdAdaptationSet 一组可以互相切换的轨道
+type mpdAdaptationSet struct {
+	Id               int                 `xml:"id,attr"`
+	ContentType      string              `xml:"contentType,attr"`
+	MimeType         string              `xml:"mimeType,attr"`
+	Lang             string              `xml:"lang,attr,omitempty"`
+	SegmentAlignment bool                `xml:"segmentAlignment,attr,omitempty"`
+	Role             *mpdDescriptor      `xml:"Role,omitempty"`
+	Representations  []mpdRepresentation `xml:"Representation"`
+}
+
+// mpdDescriptor 描述符, 如: Role
+type mpdDescriptor struct {
+	SchemeIdUri string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+// mpdRepresentation 一个具体的轨道
+type mpdRepresentation struct {
+	Id          string          `xml:"id,attr"`
+	Bandwidth   int             `xml:"bandwidth,attr"`
+	BaseURL     string          `xml:"BaseURL,omitempty"`
+	SegmentList *mpdSegmentList `xml:"SegmentList,omitempty"`
+}
+
+// mpdSegmentList 按照列表描述的分片
+type mpdSegmentList struct {
+	Timescale      int             `xml:"timescale,attr"`
+	Initialization *mpdUrl         `xml:"Initialization,omitempty"`
+	Timeline       []mpdTimelineS  `xml:"SegmentTimeline>S"`
+	SegmentURLs    []mpdSegmentURL `xml:"SegmentURL"`
+}
+
+// mpdUrl 初始化片段地址
+type mpdUrl struct {
+	SourceURL string `xml:"sourceURL,attr"`
+	Range     string `xml:"range,attr,omitempty"`
+}
+
+// mpdTimelineS 分片时间线中连续 R+1 个时长相同的分片
+type mpdTimelineS struct {
+	T *int64 `xml:"t,attr,omitempty"`
+	D int64  `xml:"d,attr"`
+	R int    `xml:"r,attr,omitempty"`
+}
+
+// mpdSegmentURL 分片地址
+type mpdSegmentURL struct {
+	Media      string `xml:"media,attr"`
+	MediaRange string `xml:"mediaRange,attr,omitempty"`
+}
+
+// MpdContent 将 i 转换为 DASH (MPD) 清单
+//
+// 分片地址与 ProxyContent 一致, 指向本地的 proxy_ts 代理接口, 分片时长取自 #EXTINF;
+// #EXT-X-MAP 初始化片段发生变化时切换到新的 Period, 每个 Period 中附带所有的字幕轨道;
+// 加密的播放列表 (#EXT-X-KEY) 无法使用 DASH 描述, 返回错误
+func (i *Info) MpdContent(routePrefix, clientApiKey string) (string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.Playlist == nil {
+		return "", errors.New("播放列表为空")
+	}
+	if i.Playlist.Master {
+		return "", errors.New("远程播放列表是 master 播放列表, 无法转换为 DASH")
+	}
+	for _, line := range i.Playlist.Lines {
+		if line.Tag == nil || line.Tag.Name != "#EXT-X-KEY" {
+			continue
+		}
+		if method, _ := line.Tag.Attr("METHOD"); method != "NONE" {
+			return "", fmt.Errorf("加密的播放列表无法转换为 DASH, METHOD: %s", method)
+		}
+	}
+
+	segs, err := i.Playlist.Segments()
+	if err != nil {
+		return "", err
+	}
+	if len(segs) == 0 {
+		return "", errors.New("播放列表中没有媒体片段")
+	}
+
+	profile, mimeType := mpdProfileMp2t, "video/mp2t"
+	if segs[0].Map != nil {
+		profile, mimeType = mpdProfileIsoff, "video/mp4"
+	}
+
+	// 字幕轨道, 每个 Period 共用
+	subSets := make([]mpdAdaptationSet, 0, len(i.Subtitles))
+	for idx, subInfo := range i.Subtitles {
+		subSets = append(subSets, mpdAdaptationSet{
+			Id:          idx + 1,
+			ContentType: "text",
+			MimeType:    "text/vtt",
+			Lang:        subInfo.Lang,
+			Role:        &mpdDescriptor{SchemeIdUri: mpdRoleScheme, Value: "subtitle"},
+			Representations: []mpdRepresentation{{
+				Id:        "sub-" + strconv.Itoa(idx),
+				Bandwidth: subtitleBandwidth,
+				BaseURL: i.proxyLink(routePrefix, "proxy_subtitle", clientApiKey, map[string]string{
+					"sub_name": urls.ResolveResourceName(subInfo.Url),
+				}),
+			}},
+		})
+	}
+
+	m := mpd{
+		Xmlns:    "urn:mpeg:dash:schema:mpd:2011",
+		Profiles: profile,
+		Type:     "static",
+	}
+	var total, maxDur float64
+	for start := 0; start < len(segs); {
+		// 初始化片段相同的连续分片组成一个 Period
+		end := start + 1
+		for end < len(segs) && segs[end].MapIndex == segs[start].MapIndex {
+			end++
+		}
+
+		list := mpdSegmentList{Timescale: mpdTimescale}
+		if seg := segs[start]; seg.Map != nil && seg.MapIndex >= 0 {
+			init := mpdUrl{SourceURL: i.proxyUri(routePrefix, UriRef{Type: UriMap, Index: seg.MapIndex}, clientApiKey)}
+			if brStr, ok := seg.Map.Attr("BYTERANGE"); ok {
+				br, err := ParseByteRange(brStr)
+				if err != nil {
+					return "", err
+				}
+				br.Offset = max(br.Offset, 0)
+				init.Range = fmt.Sprintf("%d-%d", br.Offset, br.End())
+			}
+			list.Initialization = &init
+		}
+
+		var periodDur float64
+		for _, seg := range segs[start:end] {
+			segUrl := mpdSegmentURL{Media: i.proxyUri(routePrefix, UriRef{Type: UriSegment, Index: seg.Index}, clientApiKey)}
+			if br := seg.ByteRange; br != nil {
+				segUrl.MediaRange = fmt.Sprintf("%d-%d", br.Offset, br.End())
+			}
+			list.SegmentURLs = append(list.SegmentURLs, segUrl)
+			list.Timeline = appendTimeline(list.Timeline, int64(math.Round(seg.Duration*mpdTimescale)))
+			periodDur += seg.Duration
+			maxDur = max(maxDur, seg.Duration)
+		}
+
+		sets := append([]mpdAdaptationSet{{
+			ContentType:      "video",
+			MimeType:         mimeType,
+			SegmentAlignment: true,
+			Representations: []mpdRepresentation{{
+				Id:          i.TemplateId,
+				Bandwidth:   DefaultVariantBandwidth,
+				SegmentList: &list,
+			}},
+		}}, subSets...)
+		m.Periods = append(m.Periods, mpdPeriod{
+			Id:             strconv.Itoa(len(m.Periods)),
+			Start:          mpdDuration(total),
+			Duration:       mpdDuration(periodDur),
+			AdaptationSets: sets,
+		})
+		total += periodDur
+		start = end
+	}
+	m.MediaPresentationDuration = mpdDuration(total)
+	m.MinBufferTime = mpdDuration(max(maxDur, 2))
+
+	bytes, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("生成 MPD 清单失败: %v", err)
+	}
+	return xml.Header + string(bytes), nil
+}
+
+// appendTimeline 将分片时长追加到时间线中, 与上一个分片时长相同时合并
+func appendTimeline(timeline []mpdTimelineS, d int64) []mpdTimelineS {
+	if len(timeline) == 0 {
+		t := int64(0)
+		return append(timeline, mpdTimelineS{T: &t, D: d})
+	}
+	if last := &timeline[len(timeline)-1]; last.D == d {
+		last.R++
+		return timeline
+	}
+	return append(timeline, mpdTimelineS{D: d})
+}
+
+// mpdDuration 将秒数转换为 MPD 使用的 xs:duration 格式, 如: PT12.345S
+func mpdDuration(seconds float64) string {
+	s := strconv.FormatFloat(seconds, 'f', 3, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return "PT" + s + "S"
+}
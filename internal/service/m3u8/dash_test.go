@@ -0,0 +1,183 @@
+package m3u8_test
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/m3u8"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+)
+
+// mpdDoc 测试中用于解析 MPD 清单的结构
+type mpdDoc struct {
+	Type     string `xml:"type,attr"`
+	Duration string `xml:"mediaPresentationDuration,attr"`
+	Periods  []struct {
+		Start string `xml:"start,attr"`
+		Sets  []struct {
+			ContentType string `xml:"contentType,attr"`
+			MimeType    string `xml:"mimeType,attr"`
+			Lang        string `xml:"lang,attr"`
+			Reps        []struct {
+				BaseURL string `xml:"BaseURL"`
+				List    *struct {
+					Init *struct {
+						SourceURL string `xml:"sourceURL,attr"`
+						Range     string `xml:"range,attr"`
+					} `xml:"Initialization"`
+					Timeline []struct {
+						D int64 `xml:"d,attr"`
+						R int   `xml:"r,attr"`
+					} `xml:"SegmentTimeline>S"`
+					Urls []struct {
+						Media      string `xml:"media,attr"`
+						MediaRange string `xml:"mediaRange,attr"`
+					} `xml:"SegmentURL"`
+				} `xml:"SegmentList"`
+			} `xml:"Representation"`
+		} `xml:"AdaptationSet"`
+	} `xml:"Period"`
+}
+
+func TestSegments(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "fmp4_byterange.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := m3u8.Parse(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	segs, err := p.Segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		uri      string
+		duration float64
+		br       *m3u8.ByteRange
+		mapIdx   int
+	}{
+		{uri: "video.mp4", duration: 4, br: &m3u8.ByteRange{Offset: 720, Length: 1048576}, mapIdx: 0},
+		{uri: "video.mp4", duration: 4, br: &m3u8.ByteRange{Offset: 720 + 1048576, Length: 1032192}, mapIdx: 0},
+		{uri: "video-2.mp4", duration: 4, mapIdx: 1},
+		{uri: "video-3.mp4", duration: 2.5, mapIdx: 1},
+	}
+	if len(segs) != len(tests) {
+		t.Fatalf("分片个数错误, 期望: %d, 实际: %d", len(tests), len(segs))
+	}
+	for idx, tt := range tests {
+		seg := segs[idx]
+		if seg.Index != idx || seg.Uri != tt.uri || seg.Duration != tt.duration || seg.MapIndex != tt.mapIdx {
+			t.Fatalf("分片 %d 解析错误: %+v", idx, seg)
+		}
+		if (seg.ByteRange == nil) != (tt.br == nil) || (tt.br != nil && *seg.ByteRange != *tt.br) {
+			t.Fatalf("分片 %d 字节范围错误: %+v", idx, seg.ByteRange)
+		}
+	}
+}
+
+func TestMpdContent(t *testing.T) {
+	tests := []struct {
+		file      string
+		subtitles []openlist.TranscodingSubtitleInfo
+		wantErr   bool
+		mimeType  string
+		periods   int
+		segments  int
+		duration  string
+	}{
+		{
+			file:      "aliyun_media.m3u8",
+			subtitles: []openlist.TranscodingSubtitleInfo{{Lang: "chi", Url: "https://ccp.example.com/sub/chi.vtt?x-oss-expires=1"}},
+			mimeType:  "video/mp2t",
+			periods:   1,
+			segments:  4,
+		},
+		{file: "fmp4_byterange.m3u8", mimeType: "video/mp4", periods: 2, segments: 4, duration: "PT14.5S"},
+		{file: "crlf_bom.m3u8", mimeType: "video/mp2t", periods: 1, segments: 2},
+		{file: "aes_key.m3u8", wantErr: true},
+		{file: "master.m3u8", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := m3u8.NewByContent("https://ccp.example.com/lt/FHD/", string(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			info.OpenlistPath, info.TemplateId, info.Subtitles = "/电影/a.mkv", "FHD", tt.subtitles
+
+			mpd, err := info.MpdContent("http://localhost:8095/videos", "key")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("期望错误: %v, 实际: %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var doc mpdDoc
+			if err := xml.Unmarshal([]byte(mpd), &doc); err != nil {
+				t.Fatalf("解析 MPD 失败: %v\n%s", err, mpd)
+			}
+			if doc.Type != "static" || len(doc.Periods) != tt.periods {
+				t.Fatalf("MPD 结构错误:\n%s", mpd)
+			}
+			if tt.duration != "" && doc.Duration != tt.duration {
+				t.Fatalf("总时长错误, 期望: %s, 实际: %s", tt.duration, doc.Duration)
+			}
+
+			segments := 0
+			for _, period := range doc.Periods {
+				if len(period.Sets) != 1+len(tt.subtitles) {
+					t.Fatalf("AdaptationSet 个数错误:\n%s", mpd)
+				}
+				video := period.Sets[0]
+				if video.MimeType != tt.mimeType {
+					t.Fatalf("mimeType 错误, 期望: %s, 实际: %s", tt.mimeType, video.MimeType)
+				}
+				list := video.Reps[0].List
+				timelineNum := 0
+				for _, s := range list.Timeline {
+					timelineNum += s.R + 1
+				}
+				if timelineNum != len(list.Urls) {
+					t.Fatalf("时间线与分片个数不一致:\n%s", mpd)
+				}
+				for _, u := range list.Urls {
+					if !strings.HasPrefix(u.Media, "http://localhost:8095/videos/proxy_ts?") {
+						t.Fatalf("分片地址没有被代理: %s", u.Media)
+					}
+				}
+				if tt.mimeType == "video/mp4" && (list.Init == nil || !strings.Contains(list.Init.SourceURL, "type=map")) {
+					t.Fatalf("缺少初始化片段:\n%s", mpd)
+				}
+				segments += len(list.Urls)
+
+				for _, sub := range period.Sets[1:] {
+					if sub.ContentType != "text" || !strings.Contains(sub.Reps[0].BaseURL, "proxy_subtitle?") {
+						t.Fatalf("字幕轨道错误:\n%s", mpd)
+					}
+				}
+			}
+			if segments != tt.segments {
+				t.Fatalf("分片个数错误, 期望: %d, 实际: %d", tt.segments, segments)
+			}
+
+			if tt.file == "fmp4_byterange.m3u8" {
+				first := doc.Periods[0].Sets[0].Reps[0].List
+				if first.Init.Range != "0-719" || first.Urls[1].MediaRange != "1049296-2081487" {
+					t.Fatalf("字节范围错误:\n%s", mpd)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package m3u8
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+const (
+	// maxExpireAhead 解析出的过期时间距离当前时间超过这个值时, 认为不是有效的过期时间
+	maxExpireAhead = time.Hour * 24 * 30
+
+	// minRefreshInterval 播放列表两次刷新之间的最短间隔, 避免直链有效期过短时频繁请求 openlist
+	minRefreshInterval = time.Second * 30
+)
+
+// expireQueryKeys 签名直链中表示过期时间戳的 query 参数 (小写)
+//
+// 如: 阿里云 OSS 的 x-oss-expires, CloudFront 的 Expires, 115 的 t
+var expireQueryKeys = []string{"x-oss-expires", "expires", "expire", "x-expires", "e", "t"}
+
+// ParseExpire 从签名直链中解析过期时间
+//
+// 支持秒级和毫秒级时间戳, 阿里云 CDN 的 auth_key, 以及 S3 的 X-Amz-Date + X-Amz-Expires;
+// 解析出的时间不在 (now, now + 30 天] 范围内时, 认为不是过期时间
+func ParseExpire(link string, now time.Time) (time.Time, bool) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return time.Time{}, false
+	}
+	query := make(map[string]string)
+	for key, values := range u.Query() {
+		if len(values) > 0 {
+			query[strings.ToLower(key)] = values[0]
+		}
+	}
+
+	valid := func(t time.Time) bool {
+		return t.After(now) && !t.After(now.Add(maxExpireAhead))
+	}
+
+	if date, ok := query["x-amz-date"]; ok {
+		signed, err1 := time.Parse("20060102T150405Z", date)
+		seconds, err2 := strconv.ParseInt(query["x-amz-expires"], 10, 64)
+		if err1 == nil && err2 == nil {
+			if t := signed.Add(time.Duration(seconds) * time.Second); valid(t) {
+				return t, true
+			}
+		}
+	}
+
+	candidates := make([]string, 0, len(expireQueryKeys)+1)
+	for _, key := range expireQueryKeys {
+		if value, ok := query[key]; ok {
+			candidates = append(candidates, value)
+		}
+	}
+	// auth_key 格式: {timestamp}-{rand}-{uid}-{hash}
+	if authKey, ok := query["auth_key"]; ok {
+		ts, _, _ := strings.Cut(authKey, "-")
+		candidates = append(candidates, ts)
+	}
+
+	for _, value := range candidates {
+		ts, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || ts <= 0 {
+			continue
+		}
+		t := time.Unix(ts, 0)
+		if len(value) >= 13 {
+			t = time.UnixMilli(ts)
+		}
+		if valid(t) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// earliestExpire 解析播放列表中所有地址最早的过期时间戳 (毫秒), 无法解析时返回 0, 调用方需要持有锁
+func (i *Info) earliestExpire(now time.Time) int64 {
+	if i.Playlist == nil {
+		return 0
+	}
+	var res int64
+	for _, ref := range i.Playlist.Uris() {
+		t, ok := ParseExpire(i.resolve(ref.Uri), now)
+		if !ok {
+			continue
+		}
+		if millis := t.UnixMilli(); res == 0 || millis < res {
+			res = millis
+		}
+	}
+	return res
+}
+
+// nextRefresh 计算播放列表下一次需要刷新的时间戳 (毫秒)
+//
+// 取固定刷新间隔和最早过期时间 (提前 RefreshAhead) 中较早的一个,
+// 但距离上次刷新不会短于 minRefreshInterval
+func (i *Info) nextRefresh(cfg *config.PlaylistPool) int64 {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	next := i.LastUpdate + cfg.RefreshDuration().Milliseconds()
+	if i.Expire > 0 {
+		next = min(next, i.Expire-cfg.RefreshAheadDuration().Milliseconds())
+	}
+	return max(next, i.LastUpdate+minRefreshInterval.Milliseconds())
+}
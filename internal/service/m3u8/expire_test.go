@@ -0,0 +1,42 @@
+package m3u8_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/m3u8"
+)
+
+func TestParseExpire(t *testing.T) {
+	now := time.Unix(1725500000, 0)
+	tests := []struct {
+		name string
+		link string
+		want int64 // 期望的过期时间戳 (秒), 0 表示无法解析
+	}{
+		{name: "oss", link: "https://ccp.example.com/a.ts?x-oss-expires=1725500900&x-oss-signature=abc", want: 1725500900},
+		{name: "upper case", link: "https://cdn.example.com/a.ts?Expires=1725501800&Signature=abc", want: 1725501800},
+		{name: "millis", link: "https://cdn.example.com/a.ts?e=1725500600000", want: 1725500600},
+		{name: "auth_key", link: "https://cdn.example.com/a.ts?auth_key=1725503600-0-0-9f8e", want: 1725503600},
+		{name: "s3", link: "https://s3.example.com/a.ts?X-Amz-Date=20240905T013320Z&X-Amz-Expires=900", want: 1725500000 + 900},
+		{name: "expired", link: "https://cdn.example.com/a.ts?t=1725499000", want: 0},
+		{name: "too far", link: "https://cdn.example.com/a.ts?t=1825500000", want: 0},
+		{name: "not timestamp", link: "https://cdn.example.com/a.ts?t=abc&sign=1", want: 0},
+		{name: "no query", link: "https://cdn.example.com/a.ts", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := m3u8.ParseExpire(tt.link, now)
+			if tt.want == 0 {
+				if ok {
+					t.Fatalf("期望无法解析, 实际: %v", got)
+				}
+				return
+			}
+			if !ok || got.Unix() != tt.want {
+				t.Fatalf("期望: %d, 实际: %d, ok: %v", tt.want, got.Unix(), ok)
+			}
+		})
+	}
+}
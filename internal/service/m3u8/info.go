@@ -1,11 +1,9 @@
 package m3u8
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -14,59 +12,19 @@ import (
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/emby"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
 )
 
 // NewByContent 根据 m3u8 文本初始化一个 info 对象
 //
-// 如果文本中的 ts 地址是相对地址, 可通过 baseUrl 指定请求前缀
+// 如果文本中的地址是相对地址, 可通过 baseUrl 指定请求前缀
 func NewByContent(baseUrl, content string) (*Info, error) {
-	info := Info{RemoteBase: baseUrl}
-
-	// 逐行遍历文本
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	lineComments := make([]string, 0)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strs.AnyEmpty(line) {
-			continue
-		}
-
-		// 1 扫描到一行 ts
-		if !strings.HasPrefix(line, "#") {
-			if strings.HasPrefix(line, baseUrl) {
-				line = strings.Replace(line, baseUrl, "", 1)
-				for strings.HasPrefix(line, "/") {
-					line = line[1:]
-				}
-			}
-			tsInfo := TsInfo{Url: line, Comments: lineComments}
-			info.RemoteTsInfos = append(info.RemoteTsInfos, &tsInfo)
-			lineComments = make([]string, 0)
-			continue
-		}
-
-		// 2 扫描到注释
-		prefix := strings.Split(line, ":")[0]
-		if _, ok := ParentHeadComments[prefix]; ok {
-			info.HeadComments = append(info.HeadComments, line)
-			continue
-		}
-		if _, ok := ParentTailComments[prefix]; ok {
-			info.TailComments = append(info.TailComments, line)
-			continue
-		}
-		lineComments = append(lineComments, line)
-	}
-
-	if scanner.Err() != nil {
-		return nil, scanner.Err()
-	}
-
-	return &info, nil
+	playlist, err := Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	return &Info{RemoteBase: baseUrl, Playlist: playlist}, nil
 }
 
 // NewByRemote 从一个远程的 m3u8 地址中初始化 info 对象
@@ -105,30 +63,56 @@ func NewByRemote(url string, header http.Header) (*Info, error) {
 
 // GetTsLink 获取 ts 流的直链地址
 func (i *Info) GetTsLink(idx int) (string, bool) {
-	size := len(i.RemoteTsInfos)
-	if idx < 0 || idx >= size {
+	return i.GetLink(UriSegment, idx)
+}
+
+// GetLink 获取播放列表中指定类型和序号的地址, 相对地址会转换为远程绝对地址
+func (i *Info) GetLink(typ UriType, idx int) (string, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.Playlist == nil {
+		return "", false
+	}
+	uri, ok := i.Playlist.Uri(typ, idx)
+	if !ok {
 		return "", false
 	}
-	return i.RemoteBase + i.RemoteTsInfos[idx].Url, true
+	return i.resolve(uri), true
+}
+
+// resolve 将相对地址转换为远程绝对地址, 调用方需要持有锁
+func (i *Info) resolve(uri string) string {
+	ref, err := url.Parse(uri)
+	if err != nil || ref.IsAbs() {
+		return uri
+	}
+	base, err := url.Parse(i.RemoteBase)
+	if err != nil || i.RemoteBase == "" {
+		return i.RemoteBase + uri
+	}
+	return base.ResolveReference(ref).String()
 }
 
 // Deprecated: MasterFunc 获取变体 m3u8
 //
 // 当 info 包含有字幕时, 需要调用这个方法返回
 func (i *Info) MasterFunc(cntMapper func() string, clientApiKey string) string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.masterContent(cntMapper, clientApiKey)
+}
+
+// masterContent 生成包含字幕信息的变体 m3u8, 调用方需要持有锁
+func (i *Info) masterContent(cntMapper func() string, clientApiKey string) string {
 	sb := strings.Builder{}
 	sb.WriteString("#EXTM3U\n")
 	sb.WriteString("#EXT-X-VERSION:3\n")
 	// 写入字幕信息
 	for _, subInfo := range i.Subtitles {
-		u, _ := url.Parse("proxy_subtitle")
-		q := u.Query()
-		q.Set("openlist_path", openlist.PathEncode(i.OpenlistPath))
-		q.Set("template_id", i.TemplateId)
-		q.Set("sub_name", urls.ResolveResourceName(subInfo.Url))
-		q.Set(emby.QueryApiKeyName, clientApiKey)
-		u.RawQuery = q.Encode()
-		cmt := fmt.Sprintf(`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="%s",LANGUAGE="%s",URI="%s"`, subInfo.Lang, subInfo.Lang, u.String())
+		subUrl := i.proxyLink("", "proxy_subtitle", clientApiKey, map[string]string{
+			"sub_name": urls.ResolveResourceName(subInfo.Url),
+		})
+		cmt := fmt.Sprintf(`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="%s",LANGUAGE="%s",URI="%s"`, subInfo.Lang, subInfo.Lang, subUrl)
 		sb.WriteString(cmt + "\n")
 	}
 	sb.WriteString(`#EXT-X-STREAM-INF:SUBTITLES="subs"` + "\n")
@@ -136,87 +120,76 @@ func (i *Info) MasterFunc(cntMapper func() string, clientApiKey string) string {
 	return sb.String()
 }
 
-// ContentFunc 将 i 对象转换成 m3u8 文本
+// ProxyContent 将 i 转换为 m3u8 本地代理文本
 //
-// tsMapper 函数可以将当前 info 中的 ts 地址映射为自定义地址
-// 两个参数分别是 ts 的索引和地址值
-func (i *Info) ContentFunc(tsMapper func(int, string) string) string {
-	sb := strings.Builder{}
+// 所有的地址 (包括密钥, 初始化片段等标签中的 URI 属性) 都会被替换为本地的 proxy_ts 代理地址,
+// 媒体片段通过 idx 参数定位, 其他类型的地址额外携带 type 参数
+func (i *Info) ProxyContent(main bool, routePrefix, clientApiKey string) string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 
-	// 1 写头注释
-	for _, cmt := range i.HeadComments {
-		sb.WriteString(cmt + "\n")
+	// 有内封字幕的资源, 切换为变体 m3u8
+	if !main && len(i.Subtitles) > 0 {
+		return i.masterContent(func() string {
+			return i.proxyLink(routePrefix, "proxy_playlist", clientApiKey, map[string]string{"type": "main"})
+		}, clientApiKey)
 	}
 
-	// 2 写 ts
-	for idx, ti := range i.RemoteTsInfos {
-		for _, cmt := range ti.Comments {
-			sb.WriteString(cmt + "\n")
-		}
-		sb.WriteString(tsMapper(idx, ti.Url) + "\n")
+	if i.Playlist == nil {
+		return ""
 	}
+	return i.Playlist.Encode(func(ref UriRef) string {
+		return i.proxyUri(routePrefix, ref, clientApiKey)
+	})
+}
 
-	// 3 写尾注释
-	for _, cmt := range i.TailComments {
-		sb.WriteString(cmt + "\n")
+// proxyUri 生成播放列表中某个地址对应的本地 proxy_ts 代理地址, 调用方需要持有锁
+func (i *Info) proxyUri(routePrefix string, ref UriRef, clientApiKey string) string {
+	extra := map[string]string{"idx": strconv.Itoa(ref.Index)}
+	if ref.Type != UriSegment {
+		extra["type"] = string(ref.Type)
 	}
-
-	res := strings.TrimSuffix(sb.String(), "\n")
-
-	return res
+	return i.proxyLink(routePrefix, "proxy_ts", clientApiKey, extra)
 }
 
-// ProxyContent 将 i 转换为 m3u8 本地代理文本
-func (i *Info) ProxyContent(main bool, routePrefix, clientApiKey string) string {
-	baseRoute := strings.Builder{}
+// proxyLink 生成指向本地代理接口的地址, 携带定位播放列表所需的参数
+func (i *Info) proxyLink(routePrefix, route, clientApiKey string, extra map[string]string) string {
 	if routePrefix != "" {
-		baseRoute.WriteString(routePrefix)
-		baseRoute.WriteString("/")
-	}
-
-	// 有内封字幕的资源, 切换为变体 m3u8
-	if !main && len(i.Subtitles) > 0 {
-		baseRoute.WriteString("proxy_playlist")
-		return i.MasterFunc(func() string {
-			u, _ := url.Parse(baseRoute.String())
-			q := u.Query()
-			q.Set("openlist_path", openlist.PathEncode(i.OpenlistPath))
-			q.Set("template_id", i.TemplateId)
-			q.Set(emby.QueryApiKeyName, clientApiKey)
-			q.Set("type", "main")
-			u.RawQuery = q.Encode()
-			return u.String()
-		}, clientApiKey)
-	}
-
-	baseRoute.WriteString("proxy_ts")
-	return i.ContentFunc(func(idx int, _ string) string {
-		u, _ := url.Parse(baseRoute.String())
-		q := u.Query()
-		q.Set("idx", strconv.Itoa(idx))
-		q.Set("openlist_path", openlist.PathEncode(i.OpenlistPath))
-		q.Set("template_id", i.TemplateId)
-		q.Set(emby.QueryApiKeyName, clientApiKey)
-		u.RawQuery = q.Encode()
-		return u.String()
-	})
+		route = routePrefix + "/" + route
+	}
+	u, _ := url.Parse(route)
+	q := u.Query()
+	for k, v := range extra {
+		q.Set(k, v)
+	}
+	q.Set("openlist_path", openlist.PathEncode(i.OpenlistPath))
+	q.Set("template_id", i.TemplateId)
+	q.Set(emby.QueryApiKeyName, clientApiKey)
+	u.RawQuery = q.Encode()
+	return u.String()
 }
 
-// Content 将 i 转换为 m3u8 文本
+// Content 将 i 转换为 m3u8 文本, 相对地址会转换为远程绝对地址
 func (i *Info) Content() string {
-	return i.ContentFunc(func(_ int, url string) string {
-		return i.RemoteBase + url
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.Playlist == nil {
+		return ""
+	}
+	return i.Playlist.Encode(func(ref UriRef) string {
+		return i.resolve(ref.Uri)
 	})
 }
 
 // UpdateContent 从 openlist 获取最新的 m3u8 并更新对象
 //
-// 通过 OpenlistPath 和 TemplateId 定位到唯一一个转码资源地址
+// 通过 OpenlistPath 和 TemplateId 定位到唯一一个转码资源地址;
+// 请求远程地址时不持有锁, 获取到最新数据后再整体替换, 不会阻塞并发的读取
 func (i *Info) UpdateContent() error {
 	if i.OpenlistPath == "" || i.TemplateId == "" {
 		return errors.New("参数为设置, 无法更新")
 	}
-	log.Printf(colors.ToPurple("更新 playlist, openlistPath: %s, templateId: %s"), i.OpenlistPath, i.TemplateId)
+	logger.Infof("更新 playlist, openlistPath: %s, templateId: %s", i.OpenlistPath, i.TemplateId)
 
 	// 请求 openlist 资源
 	res := openlist.FetchResource(openlist.FetchInfo{
@@ -235,11 +208,18 @@ func (i *Info) UpdateContent() error {
 	}
 
 	// 拷贝最新数据
-	i.RemoteBase = newInfo.RemoteBase
-	i.HeadComments = append(([]string)(nil), newInfo.HeadComments...)
-	i.TailComments = append(([]string)(nil), newInfo.TailComments...)
-	i.RemoteTsInfos = append(([]*TsInfo)(nil), newInfo.RemoteTsInfos...)
-	i.Subtitles = append(([]openlist.TranscodingSubtitleInfo)(nil), res.Data.Subtitles...)
-	i.LastUpdate = time.Now().UnixMilli()
+	i.setContent(newInfo, res.Data.Subtitles, time.Now())
 	return nil
 }
+
+// setContent 使用最新获取到的播放列表替换 i 中的数据
+func (i *Info) setContent(newInfo *Info, subtitles []openlist.TranscodingSubtitleInfo, now time.Time) {
+	expire := newInfo.earliestExpire(now)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.RemoteBase = newInfo.RemoteBase
+	i.Playlist = newInfo.Playlist
+	i.Subtitles = append(([]openlist.TranscodingSubtitleInfo)(nil), subtitles...)
+	i.Expire = expire
+	i.LastUpdate = now.UnixMilli()
+}
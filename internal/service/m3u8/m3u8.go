@@ -1,23 +1,26 @@
 package m3u8
 
 import (
-	"log"
+	"errors"
 	"sort"
 	"sync"
 	"time"
 
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
 )
 
-const (
+// logger m3u8 模块日志记录器
+var logger = logs.Module("m3u8")
 
-	// MaxPlaylistNum 在内存中最多维护的 m3u8 列表个数
-	// 超出则淘汰最久没有读取的一个
-	MaxPlaylistNum = 10
+const (
 
 	// PreChanSize 预处理通道大小, 塞满时从头部开始淘汰
 	PreChanSize = 1000
+
+	// maxMaintainWait 维护协程两次检查播放列表之间的最长间隔
+	maxMaintainWait = time.Minute
 )
 
 func init() {
@@ -27,16 +30,61 @@ func init() {
 // GetPlaylist 获取 m3u 播放列表, 返回 m3u 文本
 var GetPlaylist func(openlistPath, templateId string, proxy, main bool, routePrefix, clientApiKey string) (string, bool)
 
+// ErrPlaylistNotFound 内存中没有维护对应的 m3u 播放列表
+var ErrPlaylistNotFound = errors.New("播放列表不存在")
+
+// GetMpd 获取 m3u 播放列表对应的 DASH 清单, 返回 mpd 文本
+//
+// 内存中没有对应的播放列表时, 返回 ErrPlaylistNotFound
+var GetMpd func(openlistPath, templateId, routePrefix, clientApiKey string) (string, error)
+
 // GetTsLink 获取 m3u 播放列表中的某个 ts 链接
 var GetTsLink func(openlistPath, templateId string, idx int) (string, bool)
 
+// GetLink 获取 m3u 播放列表中指定类型和序号的链接, 如: 密钥, 初始化片段
+var GetLink func(openlistPath, templateId string, typ UriType, idx int) (string, bool)
+
+// RefreshPlaylist 从 openlist 重新获取内存中的 m3u8 播放列表, 用于直链提前失效的场景
+//
+// 播放列表在 staleBefore (毫秒时间戳) 之后已经刷新过时不会重复请求 openlist, 直接返回 true
+var RefreshPlaylist func(openlistPath, templateId string, staleBefore int64) bool
+
 // GetSubtitleLink 获取字幕链接
 var GetSubtitleLink func(openlistPath, templateId, subName string) (string, bool)
 
+// ListPlaylists 列出内存中正在维护的所有 m3u8 播放列表
+var ListPlaylists func() []PlaylistInfo
+
+// RemovePlaylists 移除内存中所有符合条件的 m3u8 播放列表, 返回移除的个数
+//
+// filter 为 nil 时移除所有播放列表
+var RemovePlaylists func(filter func(PlaylistInfo) bool) int
+
+// LoadPlaylists 从磁盘中加载持久化的 m3u8 播放列表, 返回加载的个数
+//
+// 已经过期或长时间未更新的播放列表会被忽略
+var LoadPlaylists func() (int, error)
+
+// SavePlaylists 将内存中的 m3u8 播放列表持久化到磁盘
+var SavePlaylists func() error
+
+// maintainOpChan 需要在维护协程中执行的操作
+var maintainOpChan = make(chan func())
+
+// runInLoop 在维护协程中执行操作, 并等待执行完毕
+func runInLoop(op func()) {
+	done := make(chan struct{})
+	maintainOpChan <- func() {
+		defer close(done)
+		op()
+	}
+	<-done
+}
+
 // preMaintainInfoChan 预处理通道
 //
 // 外界将需要维护的信息放到这个通道中, 由 goroutine 单线程维护内存
-var preMaintainInfoChan = make(chan Info, PreChanSize)
+var preMaintainInfoChan = make(chan *Info, PreChanSize)
 
 // preChanHandlingGroup 维护预处理通道的处理状态
 //
@@ -45,11 +93,11 @@ var preMaintainInfoChan = make(chan Info, PreChanSize)
 var preChanHandlingGroup = sync.WaitGroup{}
 
 // PushPlaylistAsync 将一个 openlist 转码资源异步缓存到内存中
-func PushPlaylistAsync(info Info) {
-	if info.OpenlistPath == "" || info.TemplateId == "" {
+func PushPlaylistAsync(openlistPath, templateId string) {
+	if openlistPath == "" || templateId == "" {
 		return
 	}
-	info = Info{OpenlistPath: info.OpenlistPath, TemplateId: info.TemplateId}
+	info := &Info{OpenlistPath: openlistPath, TemplateId: templateId}
 	preChanHandlingGroup.Add(1)
 	doneOnce := sync.OnceFunc(preChanHandlingGroup.Done)
 	go func() {
@@ -71,16 +119,20 @@ func PushPlaylistAsync(info Info) {
 // 维护内存中的 m3u8 播放列表
 func loopMaintainPlaylist() {
 	// map 记录播放列表, 用于快速响应客户端
+	//
+	// 只在维护协程中修改, 客户端请求的协程中读取, 通过 infoMapMutex 保护
 	infoMap := map[string]*Info{}
+	infoMapMutex := sync.RWMutex{}
 	// arr 记录播放列表, 便于实现淘汰机制
 	infoArr := make([]*Info, 0)
 
-	// maintainDuration goroutine 维护 playlist 的间隔
-	maintainDuration := time.Minute * 10
-	// stopUpdateTimeMillis 超过这个时间未读, playlist 停止更新
-	stopUpdateTimeMillis := (maintainDuration + time.Minute).Milliseconds()
-	// removeTimeMillis 超过这个时间未读, playlist 被移除
-	removeTimeMillis := time.Hour.Milliseconds()
+	// dirty 内存中的播放列表是否有未持久化的变更
+	dirty := false
+
+	// poolCfg 播放列表维护配置, 每次使用时读取, 支持热重载
+	poolCfg := func() *config.PlaylistPool {
+		return config.C().VideoPreview.Playlist
+	}
 
 	// publicApiUpdateMutex 对外部暴露的 api 的内部实现中
 	// 如果涉及到更新的操作, 需要获取这个锁, 避免频繁请求 openlist
@@ -88,12 +140,20 @@ func loopMaintainPlaylist() {
 
 	// printErr 打印错误日志
 	printErr := func(info *Info, err error) {
-		log.Printf(colors.ToRed("playlist 更新失败, path: %s, template: %s, err: %v"), info.OpenlistPath, info.TemplateId, err)
+		logger.Errorf("playlist 更新失败, path: %s, template: %s, err: %v", info.OpenlistPath, info.TemplateId, err)
 	}
 
 	// calcMapKey 计算 info 在 map 中的 key
-	calcMapKey := func(info Info) string {
-		return info.OpenlistPath + info.TemplateId
+	calcMapKey := func(openlistPath, templateId string) string {
+		return openlistPath + templateId
+	}
+
+	// loadInfo 从 map 中查询 info
+	loadInfo := func(key string) (*Info, bool) {
+		infoMapMutex.RLock()
+		defer infoMapMutex.RUnlock()
+		info, ok := infoMap[key]
+		return info, ok
 	}
 
 	// beforeNow 判断一个时间是不是在当前时间之前
@@ -101,32 +161,50 @@ func loopMaintainPlaylist() {
 		return millis < time.Now().UnixMilli()
 	}
 
+	// idle 判断 info 是否已经长时间未读, 停止更新
+	idle := func(pi PlaylistInfo, cfg *config.PlaylistPool) bool {
+		return beforeNow(pi.LastRead + cfg.StopUpdateDuration().Milliseconds())
+	}
+
+	// expiring 判断 info 中的直链是否即将过期
+	expiring := func(pi PlaylistInfo, cfg *config.PlaylistPool) bool {
+		return pi.Expire > 0 && beforeNow(pi.Expire-cfg.RefreshAheadDuration().Milliseconds())
+	}
+
+	// needUpdate 判断客户端读取时是否需要手动触发更新
+	needUpdate := func(info *Info, cfg *config.PlaylistPool) bool {
+		pi := info.PlaylistInfo()
+		return idle(pi, cfg) || expiring(pi, cfg)
+	}
+
 	// queryInfo 查询内存中的 info 信息
 	//
 	// 如果内存中 map 已经能查询到 info 信息, 直接返回
 	// 否则会等待预处理通道处理完毕后再次判断
 	queryInfo := func(openlistPath, templateId string) (info *Info) {
-		key := calcMapKey(Info{OpenlistPath: openlistPath, TemplateId: templateId})
+		key := calcMapKey(openlistPath, templateId)
 		var ok bool
-		info, ok = infoMap[key]
+		info, ok = loadInfo(key)
 
 		defer func() {
 			if info == nil {
 				return
 			}
-			// 如果当前 info 已经停止更新, 则手动触发更新
-			if beforeNow(info.LastRead + stopUpdateTimeMillis) {
+			// 如果当前 info 已经停止更新或直链即将过期, 则手动触发更新
+			cfg := poolCfg()
+			if needUpdate(info, cfg) {
 				publicApiUpdateMutex.Lock()
 				defer publicApiUpdateMutex.Unlock()
-				if beforeNow(info.LastRead + stopUpdateTimeMillis) {
+				if needUpdate(info, cfg) {
 					if err := info.UpdateContent(); err != nil {
 						printErr(info, err)
 						info = nil
+						return
 					}
 				}
 			}
 			// 更新最后读取时间
-			info.LastRead = time.Now().UnixMilli()
+			info.touch()
 		}()
 
 		if ok {
@@ -136,7 +214,7 @@ func loopMaintainPlaylist() {
 		// 等待预处理通道处理完毕
 		preChanHandlingGroup.Wait()
 
-		info, ok = infoMap[key]
+		info, ok = loadInfo(key)
 		if ok {
 			return
 		}
@@ -154,12 +232,41 @@ func loopMaintainPlaylist() {
 		return info.Content(), true
 	}
 
+	GetMpd = func(openlistPath, templateId, routePrefix, clientApiKey string) (string, error) {
+		info := queryInfo(openlistPath, templateId)
+		if info == nil {
+			return "", ErrPlaylistNotFound
+		}
+		return info.MpdContent(routePrefix, clientApiKey)
+	}
+
 	GetTsLink = func(openlistPath, templateId string, idx int) (string, bool) {
+		return GetLink(openlistPath, templateId, UriSegment, idx)
+	}
+
+	GetLink = func(openlistPath, templateId string, typ UriType, idx int) (string, bool) {
 		info := queryInfo(openlistPath, templateId)
 		if info == nil {
 			return "", false
 		}
-		return info.GetTsLink(idx)
+		return info.GetLink(typ, idx)
+	}
+
+	RefreshPlaylist = func(openlistPath, templateId string, staleBefore int64) bool {
+		info := queryInfo(openlistPath, templateId)
+		if info == nil {
+			return false
+		}
+		publicApiUpdateMutex.Lock()
+		defer publicApiUpdateMutex.Unlock()
+		if info.PlaylistInfo().LastUpdate > staleBefore {
+			return true
+		}
+		if err := info.UpdateContent(); err != nil {
+			printErr(info, err)
+			return false
+		}
+		return true
 	}
 
 	GetSubtitleLink = func(openlistPath, templateId, subName string) (string, bool) {
@@ -167,6 +274,8 @@ func loopMaintainPlaylist() {
 		if info == nil {
 			return "", false
 		}
+		info.mu.RLock()
+		defer info.mu.RUnlock()
 		for _, subInfo := range info.Subtitles {
 			curSubName := urls.ResolveResourceName(subInfo.Url)
 			if curSubName == subName {
@@ -176,71 +285,207 @@ func loopMaintainPlaylist() {
 		return "", false
 	}
 
+	ListPlaylists = func() []PlaylistInfo {
+		res := make([]PlaylistInfo, 0)
+		runInLoop(func() {
+			for _, info := range infoArr {
+				res = append(res, info.PlaylistInfo())
+			}
+		})
+		return res
+	}
+
 	// removeInfo 删除内存中的 info 信息
 	removeInfo := func(key string) {
 		info, ok := infoMap[key]
 		if !ok {
 			return
 		}
+		infoMapMutex.Lock()
 		delete(infoMap, key)
+		infoMapMutex.Unlock()
 		for i, arrInfo := range infoArr {
 			if arrInfo == info {
 				infoArr = append(infoArr[:i], infoArr[i+1:]...)
 				break
 			}
 		}
+		dirty = true
+		playlistGauge.Set(float64(len(infoArr)), "maintained")
 	}
 
-	// updateAll 更新内存中的 info 信息
+	RemovePlaylists = func(filter func(PlaylistInfo) bool) int {
+		cnt := 0
+		runInLoop(func() {
+			cpArr := append(([]*Info)(nil), infoArr...)
+			for _, info := range cpArr {
+				if filter != nil && !filter(info.PlaylistInfo()) {
+					continue
+				}
+				removeInfo(calcMapKey(info.OpenlistPath, info.TemplateId))
+				cnt++
+			}
+		})
+		return cnt
+	}
+
+	// evict 内存满时, 淘汰最久没有读取的 info
+	evict := func() {
+		maxNum := poolCfg().MaxNum
+		if len(infoArr) <= maxNum {
+			return
+		}
+		lastReads := make(map[*Info]int64, len(infoArr))
+		for _, info := range infoArr {
+			lastReads[info] = info.PlaylistInfo().LastRead
+		}
+		sort.Slice(infoArr, func(i, j int) bool {
+			return lastReads[infoArr[i]] < lastReads[infoArr[j]]
+		})
+		toDeletes := make([]*Info, len(infoArr)-maxNum)
+		copy(toDeletes, infoArr)
+		for _, toDel := range toDeletes {
+			removeInfo(calcMapKey(toDel.OpenlistPath, toDel.TemplateId))
+			logger.Debugf("playlist 被淘汰并从内存中移除, openlistPath: %s, templateId: %s", toDel.OpenlistPath, toDel.TemplateId)
+		}
+	}
+
+	// putInfo 将 info 维护到内存中
+	putInfo := func(info *Info) {
+		infoMapMutex.Lock()
+		infoMap[calcMapKey(info.OpenlistPath, info.TemplateId)] = info
+		infoMapMutex.Unlock()
+		infoArr = append(infoArr, info)
+		dirty = true
+		playlistGauge.Set(float64(len(infoArr)), "maintained")
+	}
+
+	LoadPlaylists = func() (int, error) {
+		cfg := poolCfg()
+		pis, err := loadPersistData(cfg.FilePath())
+		if err != nil {
+			return 0, err
+		}
+		cnt := 0
+		runInLoop(func() {
+			for _, pi := range pis {
+				info, err := pi.toInfo()
+				if err != nil {
+					logger.Warnf("忽略无法解析的 playlist, openlistPath: %s, templateId: %s, err: %v", pi.OpenlistPath, pi.TemplateId, err)
+					continue
+				}
+				if _, exist := infoMap[calcMapKey(info.OpenlistPath, info.TemplateId)]; exist {
+					continue
+				}
+				// 直链已经过期或长时间未更新, 加载也无法使用
+				if (info.Expire > 0 && beforeNow(info.Expire)) ||
+					beforeNow(info.LastUpdate+cfg.RemoveDuration().Milliseconds()) {
+					continue
+				}
+				putInfo(info)
+				cnt++
+			}
+			evict()
+			dirty = false
+		})
+		return cnt, nil
+	}
+
+	// save 持久化内存中的播放列表, 需要在维护协程中调用
+	save := func() error {
+		if err := savePersistData(poolCfg().FilePath(), infoArr); err != nil {
+			return err
+		}
+		dirty = false
+		return nil
+	}
+
+	SavePlaylists = func() (err error) {
+		runInLoop(func() {
+			err = save()
+		})
+		return
+	}
+
+	// updateDue 更新内存中到期的 info 信息
 	//
-	// 如果 lastRead 不满足条件, 被淘汰
-	updateAll := func() {
+	// 长时间未更新的 info 被移除, 长时间未读的 info 停止更新
+	updateDue := func() {
+		cfg := poolCfg()
 		// 复制一份 arr
 		cpArr := append(([]*Info)(nil), infoArr...)
-		tot, active := len(cpArr), 0
+		tot, active, updated := len(cpArr), 0, 0
 
 		for _, info := range cpArr {
-			key := calcMapKey(Info{OpenlistPath: info.OpenlistPath, TemplateId: info.TemplateId})
+			key := calcMapKey(info.OpenlistPath, info.TemplateId)
+			pi := info.PlaylistInfo()
 
-			// 长时间未读, 移除
-			if beforeNow(info.LastUpdate + removeTimeMillis) {
+			// 长时间未更新, 移除
+			if beforeNow(pi.LastUpdate + cfg.RemoveDuration().Milliseconds()) {
 				removeInfo(key)
-				log.Printf(colors.ToGray("playlist 长时间未被更新, 已移除, openlistPath: %s, templateId: %s"), info.OpenlistPath, info.TemplateId)
+				logger.Debugf("playlist 长时间未被更新, 已移除, openlistPath: %s, templateId: %s", info.OpenlistPath, info.TemplateId)
 				tot--
 				continue
 			}
 
 			// 超过指定时间未读, 不更新
-			if beforeNow(info.LastRead + stopUpdateTimeMillis) {
+			if idle(pi, cfg) {
 				continue
 			}
 
-			// 如果更新失败, 移除
 			active++
+			if !beforeNow(info.nextRefresh(cfg)) {
+				continue
+			}
+
+			// 如果更新失败, 移除
+			updated++
 			if err := info.UpdateContent(); err != nil {
 				printErr(info, err)
 				removeInfo(key)
 				tot--
 				active--
+				continue
 			}
+			dirty = true
+		}
+
+		if updated > 0 {
+			logger.Infof("当前正在维护的 playlist 个数: %d, 活跃个数: %d, 本次更新个数: %d", tot, active, updated)
 		}
+		playlistGauge.Set(float64(active), "active")
+	}
 
-		if len(cpArr) > 0 {
-			log.Printf(colors.ToPurple("当前正在维护的 playlist 个数: %d, 活跃个数: %d"), tot, active)
+	// nextWait 计算距离下一个 info 需要刷新或移除的时间
+	nextWait := func() time.Duration {
+		wait := maxMaintainWait
+		if len(infoArr) == 0 {
+			return wait
+		}
+		cfg := poolCfg()
+		now := time.Now().UnixMilli()
+		for _, info := range infoArr {
+			pi := info.PlaylistInfo()
+			due := pi.LastUpdate + cfg.RemoveDuration().Milliseconds()
+			if !idle(pi, cfg) {
+				due = min(due, info.nextRefresh(cfg))
+			}
+			wait = min(wait, time.Duration(due-now)*time.Millisecond)
 		}
+		return max(wait, time.Second)
 	}
 
 	// addInfo 添加 info 到内存中
-	addInfo := func(preInfo Info) {
+	addInfo := func(preInfo *Info) {
 		if preInfo.OpenlistPath == "" || preInfo.TemplateId == "" {
 			return
 		}
-		key := calcMapKey(preInfo)
+		key := calcMapKey(preInfo.OpenlistPath, preInfo.TemplateId)
 
 		// 如果内存已存在 key, 复用
 		info, exist := infoMap[key]
 		if !exist {
-			info = &preInfo
+			info = preInfo
 		}
 
 		// 初始化 Info 信息, 并更新
@@ -249,41 +494,40 @@ func loopMaintainPlaylist() {
 			removeInfo(key)
 			return
 		}
-		info.LastRead = time.Now().UnixMilli()
+		info.touch()
+		dirty = true
 
 		// 维护到内存中
 		if !exist {
-			infoMap[key] = info
-			infoArr = append(infoArr, info)
-		}
-
-		if len(infoArr) <= MaxPlaylistNum {
-			return
-		}
-		// 内存满, 淘汰旧内存
-		sort.Slice(infoArr, func(i, j int) bool {
-			return infoArr[i].LastRead < infoArr[j].LastRead
-		})
-		toDeletes := make([]*Info, len(infoArr)-MaxPlaylistNum)
-		copy(toDeletes, infoArr)
-		for _, toDel := range toDeletes {
-			removeInfo(calcMapKey(Info{OpenlistPath: toDel.OpenlistPath, TemplateId: toDel.TemplateId}))
-			log.Printf(colors.ToGray("playlist 被淘汰并从内存中移除, openlistPath: %s, templateId: %s"), toDel.OpenlistPath, toDel.TemplateId)
+			putInfo(info)
 		}
+		evict()
 	}
 
-	// 定时维护一次内存中的数据
-	t := time.NewTicker(maintainDuration)
+	// 按照每个 info 的刷新时间维护内存中的数据
+	t := time.NewTimer(maxMaintainWait)
 	defer t.Stop()
 
 	for {
 		select {
 		case <-t.C:
-			updateAll()
+			// 内存中没有数据时无需维护, 此时配置也可能尚未加载
+			if len(infoArr) == 0 && !dirty {
+				break
+			}
+			updateDue()
+			if dirty && poolCfg().Persist {
+				if err := save(); err != nil {
+					logger.Warnf("playlist 持久化失败: %v", err)
+				}
+			}
+		case op := <-maintainOpChan:
+			op()
 		case preInfo := <-preMaintainInfoChan:
 			addInfo(preInfo)
 			preChanHandlingGroup.Done()
 		}
+		t.Reset(nextWait())
 	}
 
 }
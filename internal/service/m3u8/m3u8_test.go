@@ -16,7 +16,7 @@ func TestPlaylistCache(t *testing.T) {
 	}
 
 	// 注册 playlist
-	m3u8.PushPlaylistAsync(info)
+	m3u8.PushPlaylistAsync(info.OpenlistPath, info.TemplateId)
 
 	// 获取 playlist
 	m3uContent, ok := m3u8.GetPlaylist(info.OpenlistPath, info.TemplateId, true, true, "", "")
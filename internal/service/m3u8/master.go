@@ -0,0 +1,136 @@
+package m3u8
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
+)
+
+const (
+	// DefaultVariantBandwidth 无法获取转码分辨率时, 变体流使用的默认码率
+	DefaultVariantBandwidth = 2_000_000
+
+	// bitsPerPixel 估算变体流码率时, 每秒每像素使用的比特数 (按 25 帧, 每帧 0.1 bit 计算)
+	bitsPerPixel = 2.5
+)
+
+// Variant 自适应码率播放列表中的一个清晰度
+type Variant struct {
+	TemplateId string // 转码资源模板 id
+	Width      int    // 转码模板宽度
+	Height     int    // 转码模板高度
+}
+
+// Bandwidth 根据分辨率估算变体流的峰值码率
+//
+// openlist 没有返回转码资源的真实码率, 只能根据分辨率估算,
+// 只要各个清晰度之间的大小关系正确, 播放器就能正常切换
+func (v Variant) Bandwidth() int {
+	if v.Width <= 0 || v.Height <= 0 {
+		return DefaultVariantBandwidth
+	}
+	return int(float64(v.Width*v.Height) * bitsPerPixel)
+}
+
+// Resolution 变体流的分辨率, 如: 1920x1080, 无法获取时返回空字符串
+func (v Variant) Resolution() string {
+	if v.Width <= 0 || v.Height <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", v.Width, v.Height)
+}
+
+// FetchVariants 获取 openlist 资源所有未被忽略的转码清晰度, 按照码率从低到高排序
+//
+// 同时返回资源的转码字幕信息
+func FetchVariants(openlistPath string) ([]Variant, []openlist.TranscodingSubtitleInfo, error) {
+	res := openlist.FetchFsOther(openlistPath, nil)
+	if res.Code != http.StatusOK {
+		return nil, nil, fmt.Errorf("请求 openlist 转码信息失败: %s", res.Msg)
+	}
+
+	playInfo := res.Data.VideoPreviewPlayInfo
+	variants := make([]Variant, 0, len(playInfo.LiveTranscodingTaskList))
+	for _, transcode := range playInfo.LiveTranscodingTaskList {
+		if config.C().VideoPreview.IsTemplateIgnore(transcode.TemplateId) {
+			continue
+		}
+		variants = append(variants, Variant{
+			TemplateId: transcode.TemplateId,
+			Width:      transcode.TemplateWidth,
+			Height:     transcode.TemplateHeight,
+		})
+	}
+	if len(variants) == 0 {
+		return nil, nil, fmt.Errorf("资源没有可用的转码清晰度: %s", openlistPath)
+	}
+	slices.SortStableFunc(variants, func(a, b Variant) int {
+		return cmp.Compare(a.Bandwidth(), b.Bandwidth())
+	})
+	return variants, playInfo.LiveTranscodingSubtitleTaskList, nil
+}
+
+// MasterContent 生成包含所有清晰度的 master 播放列表
+//
+// 每个清晰度对应一个 #EXT-X-STREAM-INF 变体流, 指向本地的 proxy_playlist 代理接口;
+// 有转码字幕时, 所有变体流共用一个字幕组, 字幕通过第一个变体流的模板获取
+func MasterContent(variants []Variant, subtitles []openlist.TranscodingSubtitleInfo, routePrefix, openlistPath, clientApiKey string) string {
+	baseRoute := ""
+	if routePrefix != "" {
+		baseRoute = routePrefix + "/"
+	}
+
+	// buildUrl 生成指向本地代理接口的地址
+	buildUrl := func(route, templateId string, extra map[string]string) string {
+		u, _ := url.Parse(baseRoute + route)
+		q := u.Query()
+		q.Set("openlist_path", openlist.PathEncode(openlistPath))
+		q.Set("template_id", templateId)
+		q.Set(emby.QueryApiKeyName, clientApiKey)
+		for k, v := range extra {
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+
+	p := Playlist{Master: true}
+	p.Lines = append(p.Lines, &Line{Tag: &Tag{Name: "#EXT-X-VERSION", Value: "3"}})
+
+	withSubs := len(subtitles) > 0 && len(variants) > 0
+	if withSubs {
+		for _, subInfo := range subtitles {
+			subUrl := buildUrl("proxy_subtitle", variants[0].TemplateId, map[string]string{
+				"sub_name": urls.ResolveResourceName(subInfo.Url),
+			})
+			p.Lines = append(p.Lines, &Line{Tag: NewAttrTag("#EXT-X-MEDIA",
+				Attr{Key: "TYPE", Value: "SUBTITLES"},
+				Attr{Key: "GROUP-ID", Value: "subs", Quoted: true},
+				Attr{Key: "NAME", Value: subInfo.Lang, Quoted: true},
+				Attr{Key: "LANGUAGE", Value: subInfo.Lang, Quoted: true},
+				Attr{Key: "URI", Value: subUrl, Quoted: true},
+			)})
+		}
+	}
+
+	for _, v := range variants {
+		tag := NewAttrTag("#EXT-X-STREAM-INF", Attr{Key: "BANDWIDTH", Value: strconv.Itoa(v.Bandwidth())})
+		if resolution := v.Resolution(); resolution != "" {
+			tag.SetAttr("RESOLUTION", resolution, false)
+		}
+		if withSubs {
+			tag.SetAttr("SUBTITLES", "subs", true)
+		}
+		p.Lines = append(p.Lines, &Line{Tag: tag}, &Line{Uri: buildUrl("proxy_playlist", v.TemplateId, nil)})
+	}
+
+	return p.String()
+}
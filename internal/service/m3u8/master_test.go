@@ -0,0 +1,49 @@
+package m3u8_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/m3u8"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+)
+
+func TestMasterContent(t *testing.T) {
+	variants := []m3u8.Variant{
+		{TemplateId: "HD", Width: 1280, Height: 720},
+		{TemplateId: "FHD", Width: 1920, Height: 1080},
+		{TemplateId: "QHD"},
+	}
+	subtitles := []openlist.TranscodingSubtitleInfo{
+		{Lang: "chi", Url: "https://example.com/sub/chi.vtt?sign=1"},
+	}
+
+	content := m3u8.MasterContent(variants, subtitles, "http://localhost:8095/videos", "/电影/a.mkv", "key")
+	lines := strings.Split(content, "\n")
+
+	want := []string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:3",
+		`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="chi",LANGUAGE="chi",URI="http://localhost:8095/videos/proxy_subtitle?`,
+		`#EXT-X-STREAM-INF:BANDWIDTH=2304000,RESOLUTION=1280x720,SUBTITLES="subs"`,
+		"http://localhost:8095/videos/proxy_playlist?",
+		`#EXT-X-STREAM-INF:BANDWIDTH=5184000,RESOLUTION=1920x1080,SUBTITLES="subs"`,
+		"http://localhost:8095/videos/proxy_playlist?",
+		`#EXT-X-STREAM-INF:BANDWIDTH=2000000,SUBTITLES="subs"`,
+		"http://localhost:8095/videos/proxy_playlist?",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("行数错误, 期望: %d, 实际: %d\n%s", len(want), len(lines), content)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Fatalf("第 %d 行错误, 期望前缀: %s, 实际: %s", i+1, prefix, lines[i])
+		}
+	}
+	if !strings.Contains(lines[4], "template_id=HD") || !strings.Contains(lines[6], "template_id=FHD") {
+		t.Fatalf("变体流模板错误:\n%s", content)
+	}
+	if !strings.Contains(lines[2], "template_id=HD") || !strings.Contains(lines[2], "sub_name=chi.vtt") {
+		t.Fatalf("字幕地址错误: %s", lines[2])
+	}
+}
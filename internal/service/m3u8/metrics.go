@@ -0,0 +1,12 @@
+package m3u8
+
+import "github.com/AmbitiousJun/go-emby2openlist/v2/internal/metrics"
+
+// playlistGauge 内存中维护的播放列表个数, state 取值: maintained, active
+var playlistGauge = metrics.NewGaugeVec("m3u8_playlists", "内存中维护的 m3u8 播放列表个数", "state")
+
+// segmentTotal 分片代理结果统计, result 取值: hit, fetched, stream, error
+var segmentTotal = metrics.NewCounterVec("m3u8_segments_total", "分片代理模式下请求转码分片的结果", "result")
+
+// segmentBufferGauge 分片缓冲区当前占用的字节数
+var segmentBufferGauge = metrics.NewGaugeVec("m3u8_segment_buffer_bytes", "分片缓冲区占用的字节数")
@@ -0,0 +1,105 @@
+package m3u8
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+)
+
+// persistVersion 持久化文件格式版本, 版本不一致时忽略文件
+const persistVersion = 1
+
+// persistData 持久化到磁盘的播放列表数据
+type persistData struct {
+	Version   int             `json:"version"`
+	Playlists []persistedInfo `json:"playlists"`
+}
+
+// persistedInfo 持久化到磁盘的单个播放列表
+type persistedInfo struct {
+	OpenlistPath string                             `json:"openlistPath"`
+	TemplateId   string                             `json:"templateId"`
+	Subtitles    []openlist.TranscodingSubtitleInfo `json:"subtitles,omitempty"`
+	RemoteBase   string                             `json:"remoteBase"`
+	Content      string                             `json:"content"` // 远程播放列表原始地址序列化后的文本
+	Expire       int64                              `json:"expire"`
+	LastRead     int64                              `json:"lastRead"`
+	LastUpdate   int64                              `json:"lastUpdate"`
+}
+
+// toPersisted 将 info 转换为持久化结构
+func (i *Info) toPersisted() persistedInfo {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	pi := persistedInfo{
+		OpenlistPath: i.OpenlistPath,
+		TemplateId:   i.TemplateId,
+		Subtitles:    i.Subtitles,
+		RemoteBase:   i.RemoteBase,
+		Expire:       i.Expire,
+		LastRead:     i.LastRead,
+		LastUpdate:   i.LastUpdate,
+	}
+	if i.Playlist != nil {
+		pi.Content = i.Playlist.String()
+	}
+	return pi
+}
+
+// toInfo 将持久化结构还原为 info
+func (pi persistedInfo) toInfo() (*Info, error) {
+	info, err := NewByContent(pi.RemoteBase, pi.Content)
+	if err != nil {
+		return nil, err
+	}
+	info.OpenlistPath = pi.OpenlistPath
+	info.TemplateId = pi.TemplateId
+	info.Subtitles = pi.Subtitles
+	info.Expire = pi.Expire
+	info.LastRead = pi.LastRead
+	info.LastUpdate = pi.LastUpdate
+	return info, nil
+}
+
+// loadPersistData 从磁盘读取持久化的播放列表, 文件不存在时返回空
+func loadPersistData(file string) ([]persistedInfo, error) {
+	bytes, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data persistData
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		return nil, fmt.Errorf("解析播放列表文件失败: %v", err)
+	}
+	if data.Version != persistVersion {
+		return nil, fmt.Errorf("播放列表文件版本不一致: %d", data.Version)
+	}
+	return data.Playlists, nil
+}
+
+// savePersistData 将播放列表保存到磁盘, 先写入临时文件再重命名, 避免写入中断导致文件损坏
+func savePersistData(file string, infos []*Info) error {
+	data := persistData{Version: persistVersion, Playlists: make([]persistedInfo, 0, len(infos))}
+	for _, info := range infos {
+		data.Playlists = append(data.Playlists, info.toPersisted())
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
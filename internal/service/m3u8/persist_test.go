@@ -0,0 +1,51 @@
+package m3u8
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPersistRoundTrip(t *testing.T) {
+	content := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:10.0,
+seg-0.ts?t=1725500900
+#EXT-X-ENDLIST`
+	info, err := NewByContent("https://ccp.example.com/lt/FHD/", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.OpenlistPath, info.TemplateId = "/电影/a.mkv", "FHD"
+	info.Expire, info.LastRead, info.LastUpdate = 1725500900000, 1725500100000, 1725500000000
+
+	file := filepath.Join(t.TempDir(), "playlists", "m3u8.json")
+	if err := savePersistData(file, []*Info{info}); err != nil {
+		t.Fatal(err)
+	}
+	pis, err := loadPersistData(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pis) != 1 {
+		t.Fatalf("期望加载 1 个播放列表, 实际: %d", len(pis))
+	}
+	loaded, err := pis[0].toInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Playlist.String() != content {
+		t.Fatalf("播放列表内容不一致:\n%s", loaded.Playlist.String())
+	}
+	if loaded.PlaylistInfo() != info.PlaylistInfo() {
+		t.Fatalf("播放列表信息不一致, 期望: %+v, 实际: %+v", info.PlaylistInfo(), loaded.PlaylistInfo())
+	}
+	if link, _ := loaded.GetLink(UriKey, 0); link != "https://ccp.example.com/lt/FHD/key.bin" {
+		t.Fatalf("密钥地址错误: %s", link)
+	}
+
+	if pis, err := loadPersistData(filepath.Join(t.TempDir(), "not-exist.json")); err != nil || pis != nil {
+		t.Fatalf("文件不存在时应返回空, pis: %v, err: %v", pis, err)
+	}
+}
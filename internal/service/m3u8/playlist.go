@@ -0,0 +1,447 @@
+package m3u8
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UriType 播放列表中地址的类型
+type UriType string
+
+const (
+	UriSegment UriType = "segment" // 媒体片段
+	UriVariant UriType = "variant" // master 播放列表中 #EXT-X-STREAM-INF 的变体流
+	UriKey     UriType = "key"     // #EXT-X-KEY, #EXT-X-SESSION-KEY 的密钥
+	UriMap     UriType = "map"     // #EXT-X-MAP 的初始化片段
+	UriMedia   UriType = "media"   // #EXT-X-MEDIA 的音轨, 字幕等其他版本
+	UriIFrame  UriType = "iframe"  // #EXT-X-I-FRAME-STREAM-INF 的关键帧播放列表
+	UriOther   UriType = "other"   // 其他标签中的地址
+)
+
+// ValidUriTypes 所有的地址类型
+var ValidUriTypes = map[UriType]struct{}{
+	UriSegment: {}, UriVariant: {}, UriKey: {}, UriMap: {},
+	UriMedia: {}, UriIFrame: {}, UriOther: {},
+}
+
+// uriAttrTags 带有 URI 属性的标签, 以及属性中地址的类型
+var uriAttrTags = map[string]UriType{
+	"#EXT-X-KEY":                UriKey,
+	"#EXT-X-SESSION-KEY":        UriKey,
+	"#EXT-X-MAP":                UriMap,
+	"#EXT-X-MEDIA":              UriMedia,
+	"#EXT-X-I-FRAME-STREAM-INF": UriIFrame,
+	"#EXT-X-SESSION-DATA":       UriOther,
+	"#EXT-X-PART":               UriOther,
+	"#EXT-X-PRELOAD-HINT":       UriOther,
+	"#EXT-X-RENDITION-REPORT":   UriOther,
+}
+
+// attrListTags 值为属性列表 (AttributeList) 的标签
+var attrListTags = map[string]struct{}{
+	"#EXT-X-KEY": {}, "#EXT-X-SESSION-KEY": {}, "#EXT-X-MAP": {}, "#EXT-X-MEDIA": {},
+	"#EXT-X-STREAM-INF": {}, "#EXT-X-I-FRAME-STREAM-INF": {}, "#EXT-X-SESSION-DATA": {},
+	"#EXT-X-DATERANGE": {}, "#EXT-X-START": {}, "#EXT-X-PART": {}, "#EXT-X-PART-INF": {},
+	"#EXT-X-PRELOAD-HINT": {}, "#EXT-X-RENDITION-REPORT": {}, "#EXT-X-SKIP": {},
+	"#EXT-X-SERVER-CONTROL": {}, "#EXT-X-DEFINE": {}, "#EXT-X-CONTENT-STEERING": {},
+}
+
+// masterTags 只会出现在 master 播放列表中的标签
+var masterTags = map[string]struct{}{
+	"#EXT-X-MEDIA": {}, "#EXT-X-STREAM-INF": {}, "#EXT-X-I-FRAME-STREAM-INF": {},
+	"#EXT-X-SESSION-DATA": {}, "#EXT-X-SESSION-KEY": {}, "#EXT-X-CONTENT-STEERING": {},
+}
+
+// Attr 属性列表中的一个属性
+type Attr struct {
+	Key    string // 属性名
+	Value  string // 属性值, 带引号的字符串会去除引号
+	Quoted bool   // 属性值是否为带引号的字符串
+}
+
+// Tag 播放列表中的一个标签
+type Tag struct {
+	Name  string // 标签名称, 包含 # 号, 如: #EXT-X-KEY
+	Value string // 标签冒号后的原始值, 值为属性列表时使用 Attrs
+	Attrs []Attr // 解析后的属性列表, 只有值为属性列表的标签才会解析
+}
+
+// NewAttrTag 创建一个值为属性列表的标签
+func NewAttrTag(name string, attrs ...Attr) *Tag {
+	return &Tag{Name: name, Attrs: attrs}
+}
+
+// Attr 获取属性值
+func (t *Tag) Attr(key string) (string, bool) {
+	for _, attr := range t.Attrs {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetAttr 设置属性值, 属性不存在时追加到末尾
+func (t *Tag) SetAttr(key, value string, quoted bool) {
+	for i := range t.Attrs {
+		if t.Attrs[i].Key == key {
+			t.Attrs[i].Value, t.Attrs[i].Quoted = value, quoted
+			return
+		}
+	}
+	t.Attrs = append(t.Attrs, Attr{Key: key, Value: value, Quoted: quoted})
+}
+
+// String 将标签转换为文本
+func (t *Tag) String() string {
+	if len(t.Attrs) == 0 {
+		if t.Value == "" {
+			return t.Name
+		}
+		return t.Name + ":" + t.Value
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(t.Name + ":")
+	for i, attr := range t.Attrs {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(attr.Key + "=")
+		if attr.Quoted {
+			sb.WriteString(`"` + attr.Value + `"`)
+		} else {
+			sb.WriteString(attr.Value)
+		}
+	}
+	return sb.String()
+}
+
+// Line 播放列表中的一行, 标签和地址二选一
+type Line struct {
+	Tag *Tag   // 标签行
+	Uri string // 地址行, Tag 为 nil 时有效
+}
+
+// UriRef 播放列表中一个地址的引用
+type UriRef struct {
+	Type  UriType // 地址类型
+	Index int     // 地址在同类型地址中的序号, 从 0 开始
+	Uri   string  // 原始地址
+}
+
+// Playlist HLS 播放列表 (RFC 8216)
+//
+// 按原始顺序保存所有的标签和地址, 序列化时除了被替换的地址之外, 与原始文本保持一致
+type Playlist struct {
+	Master bool    // 是否为 master 播放列表
+	Lines  []*Line // 播放列表中的所有行, 不包含 #EXTM3U, 空行和注释
+}
+
+// Parse 解析播放列表文本
+//
+// 以 # 开头但不是 #EXT 开头的行是注释, 会被忽略
+func Parse(content string) (*Playlist, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	p := Playlist{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	lineNo, headerFound := 0, false
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !headerFound {
+			if line != "#EXTM3U" {
+				return nil, fmt.Errorf("不是有效的 m3u8 文本, 第一行必须是 #EXTM3U: %s", line)
+			}
+			headerFound = true
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") {
+			p.Lines = append(p.Lines, &Line{Uri: line})
+			continue
+		}
+		if !strings.HasPrefix(line, "#EXT") {
+			continue
+		}
+
+		tag, err := parseTag(line)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行解析失败: %v", lineNo, err)
+		}
+		if tag.Name == "#EXTM3U" {
+			continue
+		}
+		if _, ok := masterTags[tag.Name]; ok {
+			p.Master = true
+		}
+		p.Lines = append(p.Lines, &Line{Tag: tag})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !headerFound {
+		return nil, fmt.Errorf("不是有效的 m3u8 文本, 内容为空")
+	}
+	return &p, nil
+}
+
+// parseTag 解析标签行
+func parseTag(line string) (*Tag, error) {
+	name, value, found := strings.Cut(line, ":")
+	tag := Tag{Name: name}
+	if !found {
+		return &tag, nil
+	}
+	if _, ok := attrListTags[name]; !ok {
+		tag.Value = value
+		return &tag, nil
+	}
+
+	attrs, err := parseAttrs(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s %v", name, err)
+	}
+	tag.Attrs = attrs
+	return &tag, nil
+}
+
+// parseAttrs 解析属性列表, 格式: KEY=VALUE,KEY="VALUE"
+//
+// 带引号的字符串中可以包含逗号和等号
+func parseAttrs(s string) ([]Attr, error) {
+	attrs := make([]Attr, 0)
+	for s = strings.TrimSpace(s); s != ""; {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("属性格式错误: %s", s)
+		}
+		attr := Attr{Key: strings.TrimSpace(s[:eq])}
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end == -1 {
+				return nil, fmt.Errorf("属性 %s 的引号没有闭合", attr.Key)
+			}
+			attr.Value, attr.Quoted = s[1:end+1], true
+			s = strings.TrimLeft(s[end+2:], " ")
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end == -1 {
+				end = len(s)
+			}
+			attr.Value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		attrs = append(attrs, attr)
+
+		if s == "" {
+			break
+		}
+		if s[0] != ',' {
+			return nil, fmt.Errorf("属性 %s 之后缺少逗号分隔", attr.Key)
+		}
+		s = strings.TrimLeft(s[1:], " ")
+	}
+	return attrs, nil
+}
+
+// Uris 按照出现顺序返回播放列表中的所有地址
+func (p *Playlist) Uris() []UriRef {
+	res := make([]UriRef, 0)
+	p.rangeUris(func(ref UriRef, _ *Line) {
+		res = append(res, ref)
+	})
+	return res
+}
+
+// Uri 获取指定类型和序号的地址
+func (p *Playlist) Uri(typ UriType, idx int) (string, bool) {
+	var res string
+	found := false
+	p.rangeUris(func(ref UriRef, _ *Line) {
+		if !found && ref.Type == typ && ref.Index == idx {
+			res, found = ref.Uri, true
+		}
+	})
+	return res, found
+}
+
+// SegmentNum 媒体片段个数
+func (p *Playlist) SegmentNum() int {
+	if p.Master {
+		return 0
+	}
+	cnt := 0
+	for _, line := range p.Lines {
+		if line.Tag == nil {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// ByteRange 资源中的一个字节范围
+type ByteRange struct {
+	Offset int64 // 起始字节
+	Length int64 // 字节长度
+}
+
+// End 范围最后一个字节的位置
+func (br ByteRange) End() int64 {
+	return br.Offset + br.Length - 1
+}
+
+// Segment 媒体播放列表中的一个媒体片段
+type Segment struct {
+	Index     int        // 片段序号, 与 UriSegment 类型地址的序号一致
+	Uri       string     // 原始地址
+	Duration  float64    // #EXTINF 时长 (秒)
+	ByteRange *ByteRange // #EXT-X-BYTERANGE 子范围, 为空表示整个资源
+	Map       *Tag       // 片段生效的 #EXT-X-MAP 标签, 为空表示没有初始化片段
+	MapIndex  int        // Map 对应的 UriMap 类型地址的序号
+}
+
+// Segments 按照顺序返回媒体播放列表中的所有媒体片段
+//
+// #EXT-X-BYTERANGE 省略起始字节时, 从同一个资源的上一个子范围之后开始
+func (p *Playlist) Segments() ([]Segment, error) {
+	res := make([]Segment, 0)
+	if p.Master {
+		return res, nil
+	}
+
+	cur := Segment{MapIndex: -1}
+	prevEnds := make(map[string]int64)
+	for _, line := range p.Lines {
+		if line.Tag == nil {
+			cur.Index, cur.Uri = len(res), line.Uri
+			if br := cur.ByteRange; br != nil && br.Offset < 0 {
+				br.Offset = prevEnds[line.Uri]
+			}
+			if cur.ByteRange != nil {
+				prevEnds[line.Uri] = cur.ByteRange.Offset + cur.ByteRange.Length
+			}
+			res = append(res, cur)
+			cur = Segment{Map: cur.Map, MapIndex: cur.MapIndex}
+			continue
+		}
+
+		switch line.Tag.Name {
+		case "#EXTINF":
+			durStr, _, _ := strings.Cut(line.Tag.Value, ",")
+			dur, err := strconv.ParseFloat(strings.TrimSpace(durStr), 64)
+			if err != nil {
+				return nil, fmt.Errorf("#EXTINF 时长格式错误: %s", line.Tag.Value)
+			}
+			cur.Duration = dur
+		case "#EXT-X-BYTERANGE":
+			br, err := ParseByteRange(line.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			cur.ByteRange = &br
+		case "#EXT-X-MAP":
+			cur.Map = line.Tag
+			if uri, ok := line.Tag.Attr("URI"); ok && uri != "" {
+				cur.MapIndex++
+			}
+		}
+	}
+	return res, nil
+}
+
+// ParseByteRange 解析字节范围, 格式: <n>[@<o>]
+//
+// 省略起始字节时, 返回的 Offset 为 -1
+func ParseByteRange(s string) (ByteRange, error) {
+	lenStr, offStr, hasOff := strings.Cut(strings.TrimSpace(s), "@")
+	length, err := strconv.ParseInt(lenStr, 10, 64)
+	if err != nil || length <= 0 {
+		return ByteRange{}, fmt.Errorf("字节范围格式错误: %s", s)
+	}
+	br := ByteRange{Offset: -1, Length: length}
+	if hasOff {
+		if br.Offset, err = strconv.ParseInt(offStr, 10, 64); err != nil || br.Offset < 0 {
+			return ByteRange{}, fmt.Errorf("字节范围格式错误: %s", s)
+		}
+	}
+	return br, nil
+}
+
+// Encode 将播放列表序列化为文本
+//
+// mapper 不为空时, 所有地址 (包括标签中的 URI 属性) 都会被替换为 mapper 的返回值
+func (p *Playlist) Encode(mapper func(UriRef) string) string {
+	mapped := make(map[*Line]string)
+	if mapper != nil {
+		p.rangeUris(func(ref UriRef, line *Line) {
+			mapped[line] = mapper(ref)
+		})
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("#EXTM3U")
+	for _, line := range p.Lines {
+		sb.WriteString("\n")
+		if line.Tag == nil {
+			if uri, ok := mapped[line]; ok {
+				sb.WriteString(uri)
+			} else {
+				sb.WriteString(line.Uri)
+			}
+			continue
+		}
+
+		if uri, ok := mapped[line]; ok {
+			tag := *line.Tag
+			tag.Attrs = append([]Attr(nil), line.Tag.Attrs...)
+			tag.SetAttr("URI", uri, true)
+			sb.WriteString(tag.String())
+			continue
+		}
+		sb.WriteString(line.Tag.String())
+	}
+	return sb.String()
+}
+
+// String 将播放列表序列化为文本, 不替换地址
+func (p *Playlist) String() string {
+	return p.Encode(nil)
+}
+
+// rangeUris 按照出现顺序遍历播放列表中的所有地址
+func (p *Playlist) rangeUris(fn func(ref UriRef, line *Line)) {
+	counts := make(map[UriType]int)
+	next := func(typ UriType, uri string, line *Line) {
+		fn(UriRef{Type: typ, Index: counts[typ], Uri: uri}, line)
+		counts[typ]++
+	}
+
+	for _, line := range p.Lines {
+		if line.Tag == nil {
+			if p.Master {
+				next(UriVariant, line.Uri, line)
+			} else {
+				next(UriSegment, line.Uri, line)
+			}
+			continue
+		}
+		typ, ok := uriAttrTags[line.Tag.Name]
+		if !ok {
+			continue
+		}
+		if uri, ok := line.Tag.Attr("URI"); ok && uri != "" {
+			next(typ, uri, line)
+		}
+	}
+}
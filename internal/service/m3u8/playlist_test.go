@@ -0,0 +1,182 @@
+package m3u8_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/m3u8"
+)
+
+func TestParseCorpus(t *testing.T) {
+	tests := []struct {
+		file   string
+		master bool
+		exact  bool // 序列化结果是否与原始文本完全一致
+		uris   map[m3u8.UriType]int
+	}{
+		{file: "aliyun_media.m3u8", exact: true, uris: map[m3u8.UriType]int{m3u8.UriSegment: 4}},
+		{file: "aes_key.m3u8", exact: true, uris: map[m3u8.UriType]int{m3u8.UriSegment: 4, m3u8.UriKey: 2}},
+		{file: "fmp4_byterange.m3u8", exact: true, uris: map[m3u8.UriType]int{m3u8.UriSegment: 4, m3u8.UriMap: 2}},
+		{file: "master.m3u8", master: true, exact: true, uris: map[m3u8.UriType]int{m3u8.UriVariant: 2, m3u8.UriMedia: 3, m3u8.UriIFrame: 1, m3u8.UriKey: 1}},
+		{file: "crlf_bom.m3u8", uris: map[m3u8.UriType]int{m3u8.UriSegment: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := m3u8.Parse(string(content))
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			if p.Master != tt.master {
+				t.Fatalf("master 判断错误, 期望: %v, 实际: %v", tt.master, p.Master)
+			}
+
+			counts := make(map[m3u8.UriType]int)
+			for _, ref := range p.Uris() {
+				counts[ref.Type]++
+			}
+			for typ, want := range tt.uris {
+				if counts[typ] != want {
+					t.Fatalf("%s 地址个数错误, 期望: %d, 实际: %d", typ, want, counts[typ])
+				}
+			}
+			if len(counts) != len(tt.uris) {
+				t.Fatalf("地址类型错误, 期望: %v, 实际: %v", tt.uris, counts)
+			}
+
+			encoded := p.String()
+			if tt.exact && encoded != strings.TrimSpace(string(content)) {
+				t.Fatalf("序列化结果与原始文本不一致:\n%s", encoded)
+			}
+
+			// 序列化之后重新解析, 结果应该保持不变
+			p2, err := m3u8.Parse(encoded)
+			if err != nil {
+				t.Fatalf("重新解析失败: %v", err)
+			}
+			if p2.String() != encoded {
+				t.Fatalf("重新序列化结果不一致:\n%s", p2.String())
+			}
+		})
+	}
+}
+
+func TestParseAttrs(t *testing.T) {
+	p, err := m3u8.Parse(`#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=5120000,CODECS="hvc1.1.6.L120.90,mp4a.40.2",RESOLUTION=1920x1080
+media.m3u8`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := p.Lines[0].Tag
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "BANDWIDTH", want: "5120000"},
+		{key: "CODECS", want: "hvc1.1.6.L120.90,mp4a.40.2"},
+		{key: "RESOLUTION", want: "1920x1080"},
+	}
+	for _, tt := range tests {
+		if got, _ := tag.Attr(tt.key); got != tt.want {
+			t.Fatalf("属性 %s 解析错误, 期望: %s, 实际: %s", tt.key, tt.want, got)
+		}
+	}
+
+	invalids := []string{
+		"",
+		"#EXT-X-VERSION:3\n#EXTM3U",
+		"#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin",
+		"#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"BYTERANGE=\"720@0\"",
+	}
+	for _, content := range invalids {
+		if _, err := m3u8.Parse(content); err == nil {
+			t.Fatalf("期望解析失败: %q", content)
+		}
+	}
+}
+
+func TestProxyContentRewritesAllUris(t *testing.T) {
+	tests := []struct {
+		file  string
+		links map[m3u8.UriType][]string // 各类型地址转换后的远程绝对地址
+	}{
+		{
+			file: "aes_key.m3u8",
+			links: map[m3u8.UriType][]string{
+				m3u8.UriKey: {
+					"https://ccp.example.com/lt/keys/key-0.bin?token=a1b2c3",
+					"https://keys.115.example.com/hls/key-1.bin?t=1725500000",
+				},
+				m3u8.UriSegment: {
+					"https://ccp.example.com/lt/FHD/seg-120.ts?t=1725500000&sign=7f3a",
+					"https://ccp.example.com/lt/FHD/seg-121.ts?t=1725500000&sign=9c1e",
+					"https://cdnfhnfile.115.example.com/hls/seg-122.ts?t=1725500000&sign=2b6d",
+					"https://ccp.example.com/hls/seg-123.ts?t=1725500000&sign=44aa",
+				},
+			},
+		},
+		{
+			file: "fmp4_byterange.m3u8",
+			links: map[m3u8.UriType][]string{
+				m3u8.UriMap:     {"https://ccp.example.com/lt/FHD/init.mp4", "https://ccp.example.com/lt/FHD/init-2.mp4"},
+				m3u8.UriSegment: {"https://ccp.example.com/lt/FHD/video.mp4", "https://ccp.example.com/lt/FHD/video.mp4"},
+			},
+		},
+		{
+			file: "master.m3u8",
+			links: map[m3u8.UriType][]string{
+				m3u8.UriMedia:   {"https://ccp.example.com/lt/FHD/audio/zh/index.m3u8", "https://ccp.example.com/lt/FHD/audio/en/index.m3u8", "https://ccp.example.com/lt/FHD/subtitles/chi.m3u8"},
+				m3u8.UriVariant: {"https://ccp.example.com/lt/FHD/HD/media.m3u8?auth_key=1725537244-0-0-9f8e", "https://cdn.example.com/FHD/media.m3u8?auth_key=1725537244-0-0-7d6c"},
+				m3u8.UriIFrame:  {"https://ccp.example.com/lt/FHD/HD/iframe.m3u8"},
+				m3u8.UriKey:     {"skd://key-id-1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := m3u8.NewByContent("https://ccp.example.com/lt/FHD/", string(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			info.OpenlistPath, info.TemplateId = "/电影/a.mkv", "FHD"
+
+			for typ, links := range tt.links {
+				for idx, want := range links {
+					if got, ok := info.GetLink(typ, idx); !ok || got != want {
+						t.Fatalf("%s[%d] 地址错误, 期望: %s, 实际: %s", typ, idx, want, got)
+					}
+				}
+			}
+
+			// 代理之后的播放列表中不应该出现任何远程地址
+			proxied, err := m3u8.Parse(info.ProxyContent(true, "http://localhost:8095/videos", "key"))
+			if err != nil {
+				t.Fatalf("解析代理播放列表失败: %v", err)
+			}
+			refs := proxied.Uris()
+			if len(refs) != len(info.Playlist.Uris()) {
+				t.Fatalf("代理前后地址个数不一致, 期望: %d, 实际: %d", len(info.Playlist.Uris()), len(refs))
+			}
+			for _, ref := range refs {
+				if !strings.HasPrefix(ref.Uri, "http://localhost:8095/videos/proxy_ts?") {
+					t.Fatalf("%s 地址没有被代理: %s", ref.Type, ref.Uri)
+				}
+				if ref.Type != m3u8.UriSegment && !strings.Contains(ref.Uri, "type="+string(ref.Type)) {
+					t.Fatalf("%s 地址缺少 type 参数: %s", ref.Type, ref.Uri)
+				}
+			}
+		})
+	}
+}
@@ -3,14 +3,14 @@ package m3u8
 import (
 	"errors"
 	"io"
-	"log"
 	"net/http"
 	"strconv"
 
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 
 	"github.com/gin-gonic/gin"
 )
@@ -39,7 +39,7 @@ func baseCheck(c *gin.Context) (ProxyParams, error) {
 func ProxyPlaylist(c *gin.Context) {
 	params, err := baseCheck(c)
 	if err != nil {
-		log.Printf(colors.ToRed("代理 m3u8 失败: %v"), err.Error())
+		logger.Errorf("代理 m3u8 失败: %v", err.Error())
 		c.String(http.StatusBadRequest, "代理 m3u8 失败, 请检查日志")
 		return
 	}
@@ -50,7 +50,7 @@ func ProxyPlaylist(c *gin.Context) {
 	}
 
 	// ts 切片使用绝对路径
-	routePrefix := https.ClientRequestHost(c.Request) + "/videos"
+	routePrefix := upstream.BaseUrl(c) + "/videos"
 
 	m3uContent, ok := GetPlaylist(params.OpenlistPath, params.TemplateId, true, true, routePrefix, params.ApiKey)
 	if ok {
@@ -59,7 +59,7 @@ func ProxyPlaylist(c *gin.Context) {
 	}
 
 	// 获取失败, 将当前请求的地址加入到预处理通道
-	PushPlaylistAsync(Info{OpenlistPath: params.OpenlistPath, TemplateId: params.TemplateId})
+	PushPlaylistAsync(params.OpenlistPath, params.TemplateId)
 
 	// 重新获取一次
 	m3uContent, ok = GetPlaylist(params.OpenlistPath, params.TemplateId, true, true, routePrefix, params.ApiKey)
@@ -70,11 +70,70 @@ func ProxyPlaylist(c *gin.Context) {
 	c.String(http.StatusBadRequest, "获取不到播放列表, 请检查日志")
 }
 
+// ProxyDash 将 m3u8 转码播放列表转换为 DASH (MPD) 清单
+//
+// 参数与 ProxyPlaylist 一致, 分片和字幕同样通过本地代理接口获取
+func ProxyDash(c *gin.Context) {
+	params, err := baseCheck(c)
+	if err != nil {
+		logger.Errorf("代理 mpd 失败: %v", err)
+		c.String(http.StatusBadRequest, "代理 mpd 失败, 请检查日志")
+		return
+	}
+
+	// 分片使用绝对路径
+	routePrefix := upstream.BaseUrl(c) + "/videos"
+
+	content, err := GetMpd(params.OpenlistPath, params.TemplateId, routePrefix, params.ApiKey)
+	if errors.Is(err, ErrPlaylistNotFound) {
+		// 获取失败, 将当前请求的地址加入到预处理通道后重新获取一次
+		PushPlaylistAsync(params.OpenlistPath, params.TemplateId)
+		content, err = GetMpd(params.OpenlistPath, params.TemplateId, routePrefix, params.ApiKey)
+	}
+	if err != nil {
+		logger.Errorf("代理 mpd 失败: %v", err)
+		c.String(http.StatusBadRequest, "获取不到 mpd 清单, 请检查日志")
+		return
+	}
+	c.Header("Content-Type", "application/dash+xml")
+	c.String(http.StatusOK, content)
+}
+
+// ProxyMaster 代理自适应清晰度的 m3u8 播放列表
+//
+// 返回包含所有未被忽略的转码清晰度的 master 播放列表, 由播放器根据网络状况自动切换
+func ProxyMaster(c *gin.Context) {
+	params, err := baseCheck(c)
+	if err != nil {
+		logger.Errorf("代理 master 失败: %v", err)
+		c.String(http.StatusBadRequest, "代理 master 失败, 请检查日志")
+		return
+	}
+
+	variants, subtitles, err := FetchVariants(params.OpenlistPath)
+	if err != nil {
+		logger.Errorf("代理 master 失败: %v", err)
+		c.String(http.StatusBadRequest, "获取不到转码清晰度, 请检查日志")
+		return
+	}
+
+	// 提前缓存第一个清晰度的播放列表, 播放器通常从第一个变体流开始播放
+	PushPlaylistAsync(params.OpenlistPath, variants[0].TemplateId)
+
+	// 变体流使用绝对路径
+	routePrefix := upstream.BaseUrl(c) + "/videos"
+	c.Header("Content-Type", "application/vnd.apple.mpegurl")
+	c.String(http.StatusOK, MasterContent(variants, subtitles, routePrefix, params.OpenlistPath, params.ApiKey))
+}
+
 // ProxyTsLink 代理 ts 直链地址
+//
+// 携带 type 参数时, 代理播放列表中其他类型的地址, 如: 密钥, 初始化片段;
+// 开启分片代理时, 由程序请求分片后返回, 否则重定向到远程地址
 func ProxyTsLink(c *gin.Context) {
 	params, err := baseCheck(c)
 	if err != nil {
-		log.Printf(colors.ToRed("代理 ts 失败: %v"), err)
+		logger.Errorf("代理 ts 失败: %v", err)
 		c.String(http.StatusBadRequest, "代理 ts 失败, 请检查日志")
 		return
 	}
@@ -85,23 +144,38 @@ func ProxyTsLink(c *gin.Context) {
 		return
 	}
 
+	typ := UriSegment
+	if params.Type != "" {
+		typ = UriType(params.Type)
+	}
+	if _, ok := ValidUriTypes[typ]; !ok {
+		c.String(http.StatusBadRequest, "无效 type")
+		return
+	}
+
+	// 分片代理模式, 由程序请求远程地址
+	if config.C().VideoPreview.SegmentProxy.Enable {
+		serveSegment(c, params, typ, idx)
+		return
+	}
+
 	okRedirect := func(link string) {
-		log.Printf(colors.ToGreen("重定向 ts: %s"), link)
+		logger.Infof("重定向 %s: %s", typ, link)
 		c.Redirect(http.StatusTemporaryRedirect, link)
 	}
 
-	tsLink, ok := GetTsLink(params.OpenlistPath, params.TemplateId, idx)
+	link, ok := GetLink(params.OpenlistPath, params.TemplateId, typ, idx)
 	if ok {
-		okRedirect(tsLink)
+		okRedirect(link)
 		return
 	}
 
 	// 获取失败, 将当前请求的地址加入到预处理通道
-	PushPlaylistAsync(Info{OpenlistPath: params.OpenlistPath, TemplateId: params.TemplateId})
+	PushPlaylistAsync(params.OpenlistPath, params.TemplateId)
 
-	tsLink, ok = GetTsLink(params.OpenlistPath, params.TemplateId, idx)
+	link, ok = GetLink(params.OpenlistPath, params.TemplateId, typ, idx)
 	if ok {
-		okRedirect(tsLink)
+		okRedirect(link)
 		return
 	}
 	c.String(http.StatusBadRequest, "获取不到 ts, 请检查日志")
@@ -111,7 +185,7 @@ func ProxyTsLink(c *gin.Context) {
 func ProxySubtitle(c *gin.Context) {
 	params, err := baseCheck(c)
 	if err != nil {
-		log.Printf(colors.ToRed("代理字幕失败: %v"), err)
+		logger.Errorf("代理字幕失败: %v", err)
 		c.String(http.StatusBadRequest, "代理字幕失败, 请检查日志")
 		return
 	}
@@ -123,10 +197,10 @@ func ProxySubtitle(c *gin.Context) {
 	}
 
 	proxySubtitle := func(link string) {
-		log.Printf(colors.ToGreen("代理字幕: %s"), link)
+		logger.Infof("代理字幕: %s", link)
 		resp, err := https.Get(link).Do()
 		if err != nil {
-			log.Printf(colors.ToRed("代理字幕失败: %v"), err)
+			logger.Errorf("代理字幕失败: %v", err)
 			c.String(http.StatusInternalServerError, "代理字幕失败, 请检查日志")
 			return
 		}
@@ -134,7 +208,7 @@ func ProxySubtitle(c *gin.Context) {
 		https.CloneHeader(c.Writer, resp.Header)
 		c.Status(resp.StatusCode)
 		if _, err = io.Copy(c.Writer, resp.Body); err != nil {
-			log.Printf(colors.ToRed("代理字幕失败: %v"), err)
+			logger.Errorf("代理字幕失败: %v", err)
 			c.String(http.StatusInternalServerError, "代理字幕失败, 请检查日志")
 			return
 		}
@@ -147,7 +221,7 @@ func ProxySubtitle(c *gin.Context) {
 	}
 
 	// 获取失败, 将当前请求的地址加入到预处理通道
-	PushPlaylistAsync(Info{OpenlistPath: params.OpenlistPath, TemplateId: params.TemplateId})
+	PushPlaylistAsync(params.OpenlistPath, params.TemplateId)
 
 	subtitleLink, ok = GetSubtitleLink(params.OpenlistPath, params.TemplateId, subName)
 	if ok {
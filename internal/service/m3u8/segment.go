@@ -0,0 +1,263 @@
+package m3u8
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// segmentFetchTimeout 下载单个分片到缓冲区的超时时间
+	segmentFetchTimeout = time.Minute * 2
+
+	// maxSegmentRatio 单个分片最多占用缓冲区的比例 (1 / n), 超出则不经过缓冲区直接传输
+	maxSegmentRatio = 4
+)
+
+// errSegmentTooLarge 分片过大, 不适合放入缓冲区
+var errSegmentTooLarge = errors.New("分片过大, 不适合放入缓冲区")
+
+// segmentRespHeaders 直接传输分片时返回给客户端的远程响应头
+var segmentRespHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges"}
+
+// segmentData 缓冲区中的一个分片
+type segmentData struct {
+	key         string
+	contentType string
+	data        []byte
+}
+
+// segmentBuffer 分片缓冲区, 总大小超出限制时淘汰最久没有读取的分片
+type segmentBuffer struct {
+	mu      sync.Mutex
+	size    int64                    // 当前缓冲的分片总大小
+	lru     *list.List               // 头部为最近读取的分片
+	entries map[string]*list.Element // key 为分片标识
+}
+
+// newSegmentBuffer 创建一个空的分片缓冲区
+func newSegmentBuffer() *segmentBuffer {
+	return &segmentBuffer{lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+var (
+	// segments 全局分片缓冲区
+	segments = newSegmentBuffer()
+
+	// segmentGroup 合并同一个分片的并发请求
+	segmentGroup singleflight.Group
+)
+
+// get 从缓冲区中获取分片
+func (b *segmentBuffer) get(key string) (*segmentData, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	elm, ok := b.entries[key]
+	if !ok {
+		return nil, false
+	}
+	b.lru.MoveToFront(elm)
+	return elm.Value.(*segmentData), true
+}
+
+// has 判断缓冲区中是否存在分片, 不影响淘汰顺序
+func (b *segmentBuffer) has(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.entries[key]
+	return ok
+}
+
+// put 将分片放入缓冲区, 并淘汰旧分片直到总大小不超过 maxBytes
+func (b *segmentBuffer) put(seg *segmentData, maxBytes int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if int64(len(seg.data)) > maxBytes {
+		return
+	}
+	if elm, ok := b.entries[seg.key]; ok {
+		b.size -= int64(len(elm.Value.(*segmentData).data))
+		b.lru.Remove(elm)
+	}
+	b.entries[seg.key] = b.lru.PushFront(seg)
+	b.size += int64(len(seg.data))
+
+	for b.size > maxBytes {
+		oldest := b.lru.Back()
+		old := b.lru.Remove(oldest).(*segmentData)
+		delete(b.entries, old.key)
+		b.size -= int64(len(old.data))
+	}
+	segmentBufferGauge.Set(float64(b.size))
+}
+
+// segmentKey 计算分片在缓冲区中的标识
+func segmentKey(openlistPath, templateId string, typ UriType, idx int) string {
+	return openlistPath + "|" + templateId + "|" + string(typ) + "|" + strconv.Itoa(idx)
+}
+
+// openSegment 请求分片的远程地址
+//
+// 远程服务器响应 403, 410 时, 认为直链已经失效, 刷新播放列表后使用新的直链重试一次
+func openSegment(ctx context.Context, openlistPath, templateId string, typ UriType, idx int, header http.Header) (*http.Response, error) {
+	for retry := 0; ; retry++ {
+		since := time.Now().UnixMilli()
+		link, ok := GetLink(openlistPath, templateId, typ, idx)
+		if !ok {
+			PushPlaylistAsync(openlistPath, templateId)
+			if link, ok = GetLink(openlistPath, templateId, typ, idx); !ok {
+				return nil, fmt.Errorf("获取不到 %s 地址, idx: %d", typ, idx)
+			}
+		}
+
+		resp, err := https.Get(link).Header(header).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("请求远程地址失败: %v", err)
+		}
+
+		expired := resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusGone
+		if expired && retry == 0 {
+			resp.Body.Close()
+			logger.Warnf("%s 直链已失效 (%s), 刷新播放列表后重试, openlistPath: %s, templateId: %s, idx: %d", typ, resp.Status, openlistPath, templateId, idx)
+			if !RefreshPlaylist(openlistPath, templateId, since) {
+				return nil, errors.New("刷新播放列表失败")
+			}
+			continue
+		}
+
+		if https.IsErrorCode(resp.StatusCode) && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+			resp.Body.Close()
+			return nil, fmt.Errorf("远程服务器响应异常: %s", resp.Status)
+		}
+		return resp, nil
+	}
+}
+
+// fetchSegment 获取分片数据, 优先从缓冲区中读取
+//
+// 同一个分片的并发请求只会请求一次远程地址, 请求成功后放入缓冲区
+func fetchSegment(openlistPath, templateId string, typ UriType, idx int) (*segmentData, error) {
+	key := segmentKey(openlistPath, templateId, typ, idx)
+	if seg, ok := segments.get(key); ok {
+		segmentTotal.Inc("hit")
+		return seg, nil
+	}
+
+	v, err, _ := segmentGroup.Do(key, func() (any, error) {
+		if seg, ok := segments.get(key); ok {
+			return seg, nil
+		}
+
+		cfg := config.C().VideoPreview.SegmentProxy
+		limit := cfg.BufferBytes() / maxSegmentRatio
+		ctx, cancel := context.WithTimeout(context.Background(), segmentFetchTimeout)
+		defer cancel()
+
+		resp, err := openSegment(ctx, openlistPath, templateId, typ, idx, cfg.Header())
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("远程服务器响应异常: %s", resp.Status)
+		}
+		if resp.ContentLength > limit {
+			return nil, errSegmentTooLarge
+		}
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+		if err != nil {
+			return nil, fmt.Errorf("读取分片失败: %v", err)
+		}
+		if int64(len(data)) > limit {
+			return nil, errSegmentTooLarge
+		}
+
+		seg := segmentData{key: key, contentType: resp.Header.Get("Content-Type"), data: data}
+		segments.put(&seg, cfg.BufferBytes())
+		segmentTotal.Inc("fetched")
+		return &seg, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*segmentData), nil
+}
+
+// readAhead 预读 idx 之后的分片到缓冲区中, 到达播放列表末尾时停止
+func readAhead(openlistPath, templateId string, idx int) {
+	num := config.C().VideoPreview.SegmentProxy.ReadAhead
+	for next := idx + 1; next <= idx+num; next++ {
+		if segments.has(segmentKey(openlistPath, templateId, UriSegment, next)) {
+			continue
+		}
+		if _, ok := GetLink(openlistPath, templateId, UriSegment, next); !ok {
+			return
+		}
+		if _, err := fetchSegment(openlistPath, templateId, UriSegment, next); err != nil {
+			logger.Debugf("预读分片失败, openlistPath: %s, templateId: %s, idx: %d, err: %v", openlistPath, templateId, next, err)
+			return
+		}
+	}
+}
+
+// serveSegment 由程序请求分片并返回给客户端
+//
+// 携带 Range 请求头 (如 fMP4 的 BYTERANGE 分片) 或分片过大时, 不经过缓冲区直接传输;
+// 请求媒体片段时, 会在后台预读后续的分片
+func serveSegment(c *gin.Context, params ProxyParams, typ UriType, idx int) {
+	if c.GetHeader("Range") == "" {
+		seg, err := fetchSegment(params.OpenlistPath, params.TemplateId, typ, idx)
+		if err == nil {
+			if typ == UriSegment {
+				go readAhead(params.OpenlistPath, params.TemplateId, idx)
+			}
+			c.Data(http.StatusOK, seg.contentType, seg.data)
+			return
+		}
+		if !errors.Is(err, errSegmentTooLarge) {
+			segmentTotal.Inc("error")
+			logger.Errorf("代理 %s 失败, idx: %d, err: %v", typ, idx, err)
+			c.String(http.StatusBadGateway, "代理分片失败, 请检查日志")
+			return
+		}
+	}
+
+	header := config.C().VideoPreview.SegmentProxy.Header()
+	if r := c.GetHeader("Range"); r != "" {
+		header.Set("Range", r)
+	}
+	resp, err := openSegment(c.Request.Context(), params.OpenlistPath, params.TemplateId, typ, idx, header)
+	if err != nil {
+		segmentTotal.Inc("error")
+		logger.Errorf("代理 %s 失败, idx: %d, err: %v", typ, idx, err)
+		c.String(http.StatusBadGateway, "代理分片失败, 请检查日志")
+		return
+	}
+	defer resp.Body.Close()
+
+	segmentTotal.Inc("stream")
+	c.Header(cache.HeaderKeyExpired, "-1")
+	for _, key := range segmentRespHeaders {
+		if values := resp.Header.Values(key); len(values) > 0 {
+			c.Writer.Header()[key] = values
+		}
+	}
+	c.Status(resp.StatusCode)
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		logger.Debugf("传输 %s 中断, idx: %d, err: %v", typ, idx, err)
+	}
+}
@@ -0,0 +1,89 @@
+package m3u8
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSegmentBufferEvict(t *testing.T) {
+	b := newSegmentBuffer()
+	put := func(key string, size int) {
+		b.put(&segmentData{key: key, data: bytes.Repeat([]byte{'a'}, size)}, 10)
+	}
+
+	put("0", 4)
+	put("1", 4)
+	// 读取 0 之后, 1 成为最久没有读取的分片
+	if _, ok := b.get("0"); !ok {
+		t.Fatal("分片 0 应该存在")
+	}
+	put("2", 4)
+
+	tests := []struct {
+		key   string
+		exist bool
+	}{
+		{key: "0", exist: true},
+		{key: "1", exist: false},
+		{key: "2", exist: true},
+	}
+	for _, tt := range tests {
+		if b.has(tt.key) != tt.exist {
+			t.Fatalf("分片 %s 存在状态错误, 期望: %v", tt.key, tt.exist)
+		}
+	}
+	if b.size != 8 {
+		t.Fatalf("缓冲区大小错误, 期望: 8, 实际: %d", b.size)
+	}
+
+	// 超过缓冲区大小的分片不会放入
+	put("3", 11)
+	if b.has("3") || b.size != 8 {
+		t.Fatalf("过大的分片不应该放入缓冲区, size: %d", b.size)
+	}
+
+	// 重复放入同一个分片, 替换旧数据
+	put("2", 2)
+	if seg, _ := b.get("2"); len(seg.data) != 2 || b.size != 6 {
+		t.Fatalf("替换分片失败, size: %d", b.size)
+	}
+}
+
+func TestInfoConcurrentRefresh(t *testing.T) {
+	info, err := NewByContent("https://ccp.example.com/lt/FHD/", "#EXTM3U\n#EXTINF:6.0,\nseg-0.ts?x-oss-expires=1\n#EXT-X-ENDLIST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.OpenlistPath, info.TemplateId = "/电影/a.mkv", "FHD"
+
+	// 请求协程读取地址的同时, 维护协程刷新播放列表, 使用 -race 运行时不应该出现数据竞争
+	var wg sync.WaitGroup
+	for n := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if n%2 == 0 {
+					newInfo, _ := NewByContent("https://cdn.example.com/FHD/", "#EXTM3U\n#EXTINF:6.0,\nseg-0.ts\n#EXT-X-ENDLIST")
+					info.setContent(newInfo, nil, time.Now())
+					info.touch()
+					continue
+				}
+				if _, ok := info.GetLink(UriSegment, 0); !ok {
+					t.Error("获取分片地址失败")
+					return
+				}
+				info.ProxyContent(true, "", "key")
+				info.MpdContent("", "key")
+				info.PlaylistInfo()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if link, _ := info.GetLink(UriSegment, 0); link != "https://cdn.example.com/FHD/seg-0.ts" {
+		t.Errorf("刷新后的分片地址错误: %s", link)
+	}
+}
@@ -1,18 +1,11 @@
 package m3u8
 
-import "github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+import (
+	"sync"
+	"time"
 
-// ParentHeadComments 记录文件头注释
-var ParentHeadComments = map[string]struct{}{
-	"#EXTM3U": {}, "#EXT-X-VERSION": {}, "#EXT-X-MEDIA-SEQUENCE": {},
-	"#EXT-X-TARGETDURATION": {}, "#EXT-X-MEDIA": {}, "#EXT-X-INDEPENDENT-SEGMENTS": {},
-	"#EXT-X-STREAM-INF": {},
-}
-
-// ParentTailComments 记录文件尾注释
-var ParentTailComments = map[string]struct{}{
-	"#EXT-X-ENDLIST": {},
-}
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+)
 
 // 响应头中，有效的 m3u8 Content-Type 属性
 var ValidM3U8Contents = map[string]struct{}{
@@ -23,32 +16,71 @@ var ValidM3U8Contents = map[string]struct{}{
 }
 
 // Info 记录一个 m3u8 相关信息
+//
+// 维护协程和客户端请求会并发读写同一个 Info, 除 OpenlistPath 和 TemplateId 之外的字段都受 mu 保护,
+// 对外暴露的方法内部会自行加锁
 type Info struct {
-	OpenlistPath  string                             // 资源在 openlist 中的绝对路径
-	TemplateId    string                             // 转码资源模板 id
-	Subtitles     []openlist.TranscodingSubtitleInfo // 字幕信息, 如果一个资源是含有字幕的, 会返回变体 m3u8
-	RemoteBase    string                             // 远程 m3u8 地址前缀
-	HeadComments  []string                           // 头注释信息
-	TailComments  []string                           // 尾注释信息
-	RemoteTsInfos []*TsInfo                          // 远程的 ts URL 列表, 用于重定向
+	mu sync.RWMutex
+
+	OpenlistPath string                             // 资源在 openlist 中的绝对路径
+	TemplateId   string                             // 转码资源模板 id
+	Subtitles    []openlist.TranscodingSubtitleInfo // 字幕信息, 如果一个资源是含有字幕的, 会返回变体 m3u8
+	RemoteBase   string                             // 远程 m3u8 地址前缀
+	Playlist     *Playlist                          // 解析后的远程播放列表, 用于重定向
+
+	// Expire 播放列表中最早过期的签名直链的过期时间戳 (毫秒), 为 0 表示无法解析
+	Expire int64
 
 	// LastRead 客户端最后读取的时间戳 (毫秒)
 	//
-	// 超过 30 分钟未读取, 程序停止更新;
-	// 超过 12 小时未读取, m3u info 被移除
+	// 超过 video-preview.playlist.stop-update-after 未读取, 程序停止更新
 	LastRead int64
 
 	// LastUpdate 程序最后的更新时间戳 (毫秒)
 	//
-	// 客户端来读取时, 如果 m3u info 已经超过 10 分钟没有更新了
+	// 超过 video-preview.playlist.remove-after 未更新, m3u info 被移除;
+	// 客户端来读取时, 如果 m3u info 已经停止更新或直链即将过期,
 	// 触发更新机制之后, 再返回最新的地址
 	LastUpdate int64
 }
 
-// TsInfo 记录一个 ts 相关信息
-type TsInfo struct {
-	Comments []string // 注释信息
-	Url      string   // 远程流请求地址
+// PlaylistInfo m3u8 播放列表的概要信息, 用于对外展示
+type PlaylistInfo struct {
+	OpenlistPath string `json:"openlistPath"` // 资源在 openlist 中的绝对路径
+	TemplateId   string `json:"templateId"`   // 转码资源模板 id
+	TsNum        int    `json:"tsNum"`        // ts 分片个数
+	Expire       int64  `json:"expire"`       // 最早过期的直链的过期时间戳 (毫秒), 为 0 表示无法解析
+	LastRead     int64  `json:"lastRead"`     // 客户端最后读取的时间戳 (毫秒)
+	LastUpdate   int64  `json:"lastUpdate"`   // 程序最后的更新时间戳 (毫秒)
+}
+
+// PlaylistInfo 获取播放列表的概要信息
+func (i *Info) PlaylistInfo() PlaylistInfo {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return PlaylistInfo{
+		OpenlistPath: i.OpenlistPath,
+		TemplateId:   i.TemplateId,
+		TsNum:        i.tsNum(),
+		Expire:       i.Expire,
+		LastRead:     i.LastRead,
+		LastUpdate:   i.LastUpdate,
+	}
+}
+
+// touch 更新客户端最后读取的时间
+func (i *Info) touch() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.LastRead = time.Now().UnixMilli()
+}
+
+// tsNum ts 分片个数, 调用方需要持有锁
+func (i *Info) tsNum() int {
+	if i.Playlist == nil {
+		return 0
+	}
+	return i.Playlist.SegmentNum()
 }
 
 // ProxyParams 代理请求接收参数
@@ -2,27 +2,51 @@ package openlist
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/model"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
+
+	"golang.org/x/sync/singleflight"
 )
 
+// logger openlist 模块日志记录器
+var logger = logs.Module("openlist")
+
+// resourceGroup 合并 FetchResource 的并发请求
+var resourceGroup singleflight.Group
+
 // FetchResource 请求 openlist 资源 url 直链
+//
+// 相同资源的并发请求只会向 openlist 发起一次请求, 其余请求等待并共享结果
 func FetchResource(fi FetchInfo) model.HttpRes[Resource] {
 	if strs.AnyEmpty(fi.Path) {
 		return model.HttpRes[Resource]{Code: http.StatusBadRequest, Msg: "参数 path 不能为空"}
 	}
 	fi.Header = CleanHeader(fi.Header)
+	if res, ok := loadPrefetchedResource(fi.key()); ok {
+		logger.Infof("使用预取的资源直链: %s", fi.Path)
+		return res
+	}
+
+	res, _, _ := resourceGroup.Do(fi.key(), func() (any, error) {
+		return fetchResource(fi), nil
+	})
+	return res.(model.HttpRes[Resource])
+}
+
+// fetchResource 请求 openlist 资源 url 直链
+func fetchResource(fi FetchInfo) model.HttpRes[Resource] {
 
 	if !fi.UseTranscode {
 		// 请求原画资源
@@ -38,7 +62,7 @@ func FetchResource(fi FetchInfo) model.HttpRes[Resource] {
 		if !fi.TryRawIfTranscodeFail {
 			return model.HttpRes[Resource]{Code: originRes.Code, Msg: originRes.Msg}
 		}
-		log.Printf(colors.ToRed("请求转码资源失败, 尝试请求原画资源, 原始响应: %v"), jsons.FromObject(originRes))
+		logger.Errorf("请求转码资源失败, 尝试请求原画资源, 原始响应: %v", jsons.FromObject(originRes))
 		fi.UseTranscode = false
 		return FetchResource(fi)
 	}
@@ -64,7 +88,7 @@ func FetchResource(fi FetchInfo) model.HttpRes[Resource] {
 		}
 	}
 	if idx == -1 {
-		log.Printf(colors.ToRed("查找不到指定的格式: %s, 所有可用的格式: [%s]"), fi.Format, strings.Join(allFmts, ", "))
+		logger.Errorf("查找不到指定的格式: %s, 所有可用的格式: [%s]", fi.Format, strings.Join(allFmts, ", "))
 		return failedAndTryRaw(res)
 	}
 
@@ -86,13 +110,25 @@ func FetchResource(fi FetchInfo) model.HttpRes[Resource] {
 //
 // 传入 path 与接口的 path 作用一致
 func FetchFsList(path string, header http.Header) model.HttpRes[FsList] {
+	return fetchFsList(path, header, true)
+}
+
+// FetchFsListCached 请求 openlist "/api/fs/list" 接口, 不强制 openlist 刷新目录缓存
+//
+// 适用于批量遍历目录的场景, 避免频繁请求网盘
+func FetchFsListCached(path string, header http.Header) model.HttpRes[FsList] {
+	return fetchFsList(path, header, false)
+}
+
+// fetchFsList 请求 openlist "/api/fs/list" 接口, refresh 控制是否强制刷新目录缓存
+func fetchFsList(path string, header http.Header, refresh bool) model.HttpRes[FsList] {
 	if strs.AnyEmpty(path) {
 		return model.HttpRes[FsList]{Code: http.StatusBadRequest, Msg: "参数 path 不能为空"}
 	}
 
 	var res FsList
 	err := Fetch("/api/fs/list", http.MethodPost, header, map[string]any{
-		"refresh":  true,
+		"refresh":  refresh,
 		"password": "",
 		"path":     path,
 	}, &res)
@@ -143,25 +179,99 @@ func FetchFsOther(path string, header http.Header) model.HttpRes[FsOther] {
 }
 
 // Fetch 请求 openlist api, 响应封装在 v 指针指向的结构中
+//
+// 按照优先级依次尝试可用的 openlist 后端, 直到请求成功为止,
+// 请求体中包含 path 参数时, 只会选择负责该路径的后端
 func Fetch(uri, method string, header http.Header, body map[string]any, v any) error {
-	host := config.C.Openlist.Host
-	token := config.C.Openlist.Token
-	if strs.AnyEmpty(host, token) {
-		return fmt.Errorf("openlist.host 或 openlist.token 配置为空")
+	path, _ := body["path"].(string)
+	bs := candidates(path)
+	if len(bs) == 0 {
+		return fmt.Errorf("没有负责路径 [%s] 的 openlist 后端", path)
+	}
+
+	errs := make([]string, 0, len(bs))
+	for i, b := range bs {
+		err := fetchFrom(b, uri, method, header.Clone(), body, v)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("[%s] %v", b.Name, err))
+		if i < len(bs)-1 {
+			logger.Warnf("openlist 后端 [%s] 请求失败, 尝试下一个后端, api: %s, err: %v", b.Name, uri, err)
+		}
 	}
+	return errors.New(strings.Join(errs, "; "))
+}
 
+// fetchFrom 请求指定 openlist 后端的 api, 并记录后端的健康状态
+func fetchFrom(b *config.OpenlistBackend, uri, method string, header http.Header, body map[string]any, v any) error {
+	start := time.Now()
+	err := fetch(b, uri, method, header, body, v)
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	fetchTotal.Inc(b.Name, uri, result)
+	fetchDuration.Observe(time.Since(start).Seconds(), b.Name, uri)
+
+	if errors.Is(err, errUnavailable) {
+		markFailure(b)
+	} else {
+		markSuccess(b)
+	}
+	return err
+}
+
+// errUnauthorized openlist 响应 401, token 无效或已过期
+var errUnauthorized = errors.New("token 无效或已过期")
+
+// fetch 请求 openlist 后端的 api
+//
+// 使用账号密码登录时, 如果 token 失效, 会自动重新登录并重试一次
+func fetch(b *config.OpenlistBackend, uri, method string, header http.Header, body map[string]any, v any) error {
+	if strs.AnyEmpty(b.Host) {
+		return fmt.Errorf("openlist 后端 [%s] 的 host 配置为空", b.Name)
+	}
+	token, err := Token(b)
+	if err != nil {
+		return err
+	}
+
+	err = doFetch(b.Host, uri, method, header, body, token, v)
+	if !errors.Is(err, errUnauthorized) || !b.UseLogin() {
+		return err
+	}
+
+	logger.Warnf("openlist 后端 [%s] token 已失效, 重新登录后重试, api: %s", b.Name, uri)
+	invalidateToken(b, token)
+	if token, err = Token(b); err != nil {
+		return err
+	}
+	return doFetch(b.Host, uri, method, header, body, token, v)
+}
+
+// doFetch 使用指定的 token 请求 openlist api, token 为空时不携带鉴权信息
+func doFetch(host, uri, method string, header http.Header, body map[string]any, token string, v any) error {
 	// 1 发出请求
 	if header == nil {
 		header = make(http.Header)
 	}
 	header.Set("Content-Type", "application/json;charset=utf-8")
-	header.Set("Authorization", token)
+	if token != "" {
+		header.Set("Authorization", token)
+	}
 
 	resp, err := https.Request(method, host+uri).Header(header).Body(https.MapBody(body)).Do()
 	if err != nil {
-		return fmt.Errorf("Fetch 请求失败: %v", err)
+		return fmt.Errorf("Fetch 请求失败: %w: %v", errUnavailable, err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("Fetch 请求响应状态异常: %w: %s", errUnavailable, resp.Status)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("Fetch 请求响应状态异常: %w", errUnauthorized)
+	}
 
 	// 2 检测响应状态是否正常
 	resBytes, err := io.ReadAll(resp.Body)
@@ -173,6 +283,9 @@ func Fetch(uri, method string, header http.Header, body map[string]any, v any) e
 	if err = json.Unmarshal(resBytes, &res); err != nil {
 		return fmt.Errorf("Fetch 请求响应解析失败: %v, 响应内容: %v", err, string(resBytes))
 	}
+	if res.Code == http.StatusUnauthorized {
+		return fmt.Errorf("Fetch 请求响应状态异常: %w, 消息: %s", errUnauthorized, res.Message)
+	}
 	if res.Code != http.StatusOK {
 		return fmt.Errorf("Fetch 请求响应状态异常: %d, 消息: %s", res.Code, res.Message)
 	}
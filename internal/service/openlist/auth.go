@@ -0,0 +1,117 @@
+package openlist
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// LoginUri openlist 登录接口
+const LoginUri = "/api/auth/login"
+
+// loginSession 通过账号密码登录获取到的 token 缓存
+type loginSession struct {
+	mu sync.RWMutex
+
+	// credential 获取 token 时使用的账号信息, 账号信息变更后需要重新登录
+	credential string
+
+	// token 登录获取到的 jwt
+	token string
+}
+
+var (
+	// sessions 所有后端的登录会话, key 为后端名称
+	sessions sync.Map
+
+	// loginGroup 合并并发的登录请求
+	loginGroup singleflight.Group
+)
+
+// LoginResult openlist 登录接口响应数据
+type LoginResult struct {
+	Token string `json:"token"`
+}
+
+// sessionOf 获取后端的登录会话, 不存在时初始化
+func sessionOf(b *config.OpenlistBackend) *loginSession {
+	s, _ := sessions.LoadOrStore(b.Name, new(loginSession))
+	return s.(*loginSession)
+}
+
+// Token 获取访问 openlist 后端 api 的 token
+//
+// 配置了账号密码时, 使用登录获取到的 token, 首次调用或账号信息变更时自动登录;
+// 否则使用配置的静态 token
+func Token(b *config.OpenlistBackend) (string, error) {
+	if !b.UseLogin() {
+		if strs.AnyEmpty(b.Token) {
+			return "", fmt.Errorf("openlist 后端 [%s] 未配置 token, 也未配置 username 和 password", b.Name)
+		}
+		return b.Token, nil
+	}
+
+	s := sessionOf(b)
+	s.mu.RLock()
+	token, curCred := s.token, s.credential
+	s.mu.RUnlock()
+	if token != "" && curCred == credentialOf(b) {
+		return token, nil
+	}
+	return login(b)
+}
+
+// invalidateToken 使后端缓存的 token 失效, 下次调用 Token 时重新登录
+//
+// 只有当前缓存的 token 与传入的 token 一致时才会失效,
+// 避免并发请求将其他请求刚登录获取到的 token 清除
+func invalidateToken(b *config.OpenlistBackend, token string) {
+	s := sessionOf(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// login 使用账号密码登录 openlist 后端, 获取并缓存 token
+func login(b *config.OpenlistBackend) (string, error) {
+	cred := credentialOf(b)
+	res, err, _ := loginGroup.Do(b.Name+"|"+cred, func() (any, error) {
+		var lr LoginResult
+		err := doFetch(b.Host, LoginUri, http.MethodPost, nil, map[string]any{
+			"username": b.Username,
+			"password": b.Password,
+		}, "", &lr)
+		if err == nil && lr.Token == "" {
+			err = errors.New("登录响应中缺少 token")
+		}
+		if err != nil {
+			loginTotal.Inc(b.Name, "error")
+			return "", fmt.Errorf("openlist 后端 [%s] 登录失败: %w", b.Name, err)
+		}
+
+		s := sessionOf(b)
+		s.mu.Lock()
+		s.token, s.credential = lr.Token, cred
+		s.mu.Unlock()
+		loginTotal.Inc(b.Name, "success")
+		logger.Infof("openlist 后端 [%s] 登录成功, 用户: %s", b.Name, b.Username)
+		return lr.Token, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.(string), nil
+}
+
+// credentialOf 生成账号信息的唯一标识
+func credentialOf(b *config.OpenlistBackend) string {
+	return b.Host + "|" + b.Username + "|" + b.Password
+}
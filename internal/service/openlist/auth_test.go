@@ -0,0 +1,66 @@
+package openlist
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+func TestFetchReLogin(t *testing.T) {
+	var loginCnt atomic.Int32
+	var validToken atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == LoginUri {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["username"] != "admin" || body["password"] != "pwd" {
+				w.Write([]byte(`{"code":400,"message":"password is incorrect"}`))
+				return
+			}
+			token := fmt.Sprintf("jwt-%d", loginCnt.Add(1))
+			validToken.Store(token)
+			fmt.Fprintf(w, `{"code":200,"message":"success","data":{"token":"%s"}}`, token)
+			return
+		}
+		if r.Header.Get("Authorization") != validToken.Load() {
+			w.Write([]byte(`{"code":401,"message":"token is expired"}`))
+			return
+		}
+		w.Write([]byte(`{"code":200,"message":"success","data":{"content":[]}}`))
+	}))
+	defer srv.Close()
+
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+	config.Set(&config.Config{Openlist: &config.Openlist{Host: srv.URL, Username: "admin", Password: "pwd"}})
+	sessions.Clear()
+
+	// 首次请求自动登录
+	if err := Fetch("/api/fs/list", http.MethodPost, nil, nil, nil); err != nil {
+		t.Fatalf("首次请求失败: %v", err)
+	}
+	if loginCnt.Load() != 1 {
+		t.Fatalf("登录次数: %d, 期望: 1", loginCnt.Load())
+	}
+
+	// 模拟 token 在服务端被轮换, 请求应自动重新登录并成功
+	validToken.Store("rotated")
+	loginCntBefore := loginCnt.Load()
+	if err := Fetch("/api/fs/list", http.MethodPost, nil, nil, nil); err != nil {
+		t.Fatalf("token 失效后请求失败: %v", err)
+	}
+	if loginCnt.Load() != loginCntBefore+1 {
+		t.Fatalf("登录次数: %d, 期望: %d", loginCnt.Load(), loginCntBefore+1)
+	}
+
+	// 账号密码错误时返回登录失败
+	config.Set(&config.Config{Openlist: &config.Openlist{Host: srv.URL, Username: "admin", Password: "wrong"}})
+	if err := Fetch("/api/fs/list", http.MethodPost, nil, nil, nil); err == nil {
+		t.Fatal("账号密码错误时请求应失败")
+	}
+}
@@ -0,0 +1,121 @@
+package openlist
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+// errUnavailable 后端不可用, 如网络异常, 服务端 5xx 响应等
+//
+// 只有这类错误才会计入后端的失败次数, 业务错误 (如资源不存在) 说明后端本身是正常的
+var errUnavailable = errors.New("openlist 后端不可用")
+
+// backendState 后端健康状态
+type backendState struct {
+	mu sync.Mutex
+
+	// fails 连续失败次数
+	fails int
+
+	// unhealthyUntil 在此时间之前, 后端被视为不健康
+	unhealthyUntil time.Time
+}
+
+// backendStates 所有后端的健康状态, key 为后端名称
+var backendStates sync.Map
+
+// stateOf 获取后端的健康状态, 不存在时初始化
+func stateOf(b *config.OpenlistBackend) *backendState {
+	s, _ := backendStates.LoadOrStore(b.Name, new(backendState))
+	return s.(*backendState)
+}
+
+// healthy 判断后端当前是否健康
+func (s *backendState) healthy(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !now.Before(s.unhealthyUntil)
+}
+
+// markSuccess 后端请求成功, 清空失败记录
+func markSuccess(b *config.OpenlistBackend) {
+	s := stateOf(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails > 0 && !s.unhealthyUntil.IsZero() {
+		logger.Infof("openlist 后端 [%s] 已恢复", b.Name)
+	}
+	s.fails, s.unhealthyUntil = 0, time.Time{}
+}
+
+// markFailure 后端请求失败, 连续失败次数达到阈值后标记为不健康
+func markFailure(b *config.OpenlistBackend) {
+	failover := config.C().Openlist.Failover
+	s := stateOf(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fails++
+	if s.fails < failover.Threshold() {
+		return
+	}
+	cooldown := failover.CooldownDuration()
+	s.unhealthyUntil = time.Now().Add(cooldown)
+	backendUnhealthyTotal.Inc(b.Name)
+	logger.Warnf("openlist 后端 [%s] 连续失败 %d 次, 标记为不健康, %v 内优先使用其他后端", b.Name, s.fails, cooldown)
+}
+
+// candidates 获取能够处理指定路径的后端
+//
+// 健康的后端按照优先级排在前面, 不健康的后端排在最后兜底
+func candidates(path string) []*config.OpenlistBackend {
+	bs := config.C().Openlist.BackendsFor(path)
+	now := time.Now()
+	healthy := make([]*config.OpenlistBackend, 0, len(bs))
+	var unhealthy []*config.OpenlistBackend
+	for _, b := range bs {
+		if stateOf(b).healthy(now) {
+			healthy = append(healthy, b)
+		} else {
+			unhealthy = append(unhealthy, b)
+		}
+	}
+	return slices.Concat(healthy, unhealthy)
+}
+
+// BackendStatus 后端状态
+type BackendStatus struct {
+	Name           string `json:"name"`
+	Host           string `json:"host"`
+	Priority       int    `json:"priority"`
+	Healthy        bool   `json:"healthy"`
+	Fails          int    `json:"fails"`
+	UnhealthyUntil string `json:"unhealthyUntil,omitempty"`
+}
+
+// BackendStatuses 获取所有后端的状态
+func BackendStatuses() []BackendStatus {
+	now := time.Now()
+	bs := config.C().Openlist.AllBackends()
+	res := make([]BackendStatus, 0, len(bs))
+	for _, b := range bs {
+		s := stateOf(b)
+		s.mu.Lock()
+		st := BackendStatus{
+			Name:     b.Name,
+			Host:     b.Host,
+			Priority: b.Priority,
+			Healthy:  !now.Before(s.unhealthyUntil),
+			Fails:    s.fails,
+		}
+		if !st.Healthy {
+			st.UnhealthyUntil = s.unhealthyUntil.Format(time.DateTime)
+		}
+		s.mu.Unlock()
+		res = append(res, st)
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+package openlist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+func TestFetchFailover(t *testing.T) {
+	var homeCnt, vpsCnt atomic.Int32
+	home := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		homeCnt.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer home.Close()
+	vps := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vpsCnt.Add(1)
+		w.Write([]byte(`{"code":200,"message":"success","data":{"raw_url":"https://vps/a.mp4"}}`))
+	}))
+	defer vps.Close()
+
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+	cfg := &config.Openlist{
+		Backends: []*config.OpenlistBackend{
+			{Name: "vps", Host: vps.URL, Token: "t", Priority: 2},
+			{Name: "home", Host: home.URL, Token: "t", Priority: 1, Paths: []string{"/movie"}},
+		},
+		Failover: &config.OpenlistFailover{FailThreshold: 2, Cooldown: "1m"},
+	}
+	if err := cfg.Init(); err != nil {
+		t.Fatal(err)
+	}
+	config.Set(&config.Config{Openlist: cfg})
+	backendStates.Clear()
+
+	fetchGet := func(path string) {
+		t.Helper()
+		res := FetchFsGet(path, nil)
+		if res.Code != http.StatusOK || res.Data.RawUrl != "https://vps/a.mp4" {
+			t.Fatalf("FetchFsGet(%s) = %+v", path, res)
+		}
+	}
+
+	// home 优先级更高, 失败后转移到 vps
+	fetchGet("/movie/a.mp4")
+	fetchGet("/movie/a.mp4")
+	if homeCnt.Load() != 2 || vpsCnt.Load() != 2 {
+		t.Fatalf("home: %d, vps: %d, want 2, 2", homeCnt.Load(), vpsCnt.Load())
+	}
+
+	// home 连续失败达到阈值, 被标记为不健康后优先请求 vps
+	fetchGet("/movie/a.mp4")
+	if homeCnt.Load() != 2 || vpsCnt.Load() != 3 {
+		t.Fatalf("home: %d, vps: %d, want 2, 3", homeCnt.Load(), vpsCnt.Load())
+	}
+
+	// home 不负责 /tv 路径
+	fetchGet("/tv/b.mp4")
+	if homeCnt.Load() != 2 {
+		t.Fatalf("home 不应处理 /tv 路径, 请求次数: %d", homeCnt.Load())
+	}
+
+	for _, st := range BackendStatuses() {
+		if st.Name == "home" && st.Healthy {
+			t.Errorf("home 应被标记为不健康: %+v", st)
+		}
+	}
+}
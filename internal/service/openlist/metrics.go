@@ -0,0 +1,17 @@
+package openlist
+
+import "github.com/AmbitiousJun/go-emby2openlist/v2/internal/metrics"
+
+var (
+	// fetchTotal openlist api 请求统计, result 取值: success, error
+	fetchTotal = metrics.NewCounterVec("openlist_requests_total", "请求 openlist api 的次数", "backend", "api", "result")
+
+	// fetchDuration openlist api 请求耗时分布
+	fetchDuration = metrics.NewHistogramVec("openlist_request_duration_seconds", "请求 openlist api 的耗时 (秒)", nil, "backend", "api")
+
+	// loginTotal 使用账号密码登录 openlist 的次数, result 取值: success, error
+	loginTotal = metrics.NewCounterVec("openlist_logins_total", "使用账号密码登录 openlist 的次数", "backend", "result")
+
+	// backendUnhealthyTotal openlist 后端被标记为不健康的次数
+	backendUnhealthyTotal = metrics.NewCounterVec("openlist_backend_unhealthy_total", "openlist 后端被标记为不健康的次数", "backend")
+)
@@ -0,0 +1,42 @@
+package openlist
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/model"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/maps"
+)
+
+// maxPrefetchedResources 最多保留的预取直链数量
+const maxPrefetchedResources = 1000
+
+// prefetchedResources 预取的资源直链, key 为 FetchInfo.key()
+var prefetchedResources = maps.NewExpiring[string, model.HttpRes[Resource]](maxPrefetchedResources)
+
+func init() {
+	// 配置变更后, openlist 地址等信息可能已经改变, 丢弃所有的预取直链
+	config.OnReload(func(_, _ *config.Config) {
+		prefetchedResources.Clear()
+	})
+}
+
+// PrefetchResource 提前请求 openlist 资源直链并暂存
+//
+// 在 ttl 时间内, 相同参数的 FetchResource 请求会直接使用预取的直链, 预取的直链只会被使用一次
+func PrefetchResource(fi FetchInfo, ttl time.Duration) model.HttpRes[Resource] {
+	fi.Header = CleanHeader(fi.Header)
+	res := FetchResource(fi)
+	if res.Code != http.StatusOK {
+		return res
+	}
+
+	prefetchedResources.Store(fi.key(), res, ttl)
+	return res
+}
+
+// loadPrefetchedResource 获取未过期的预取直链, 获取后移除
+func loadPrefetchedResource(key string) (model.HttpRes[Resource], bool) {
+	return prefetchedResources.LoadAndDelete(key)
+}
@@ -2,7 +2,9 @@ package openlist
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 )
 
 // FetchInfo 请求 openlist 资源需要的参数信息
@@ -14,6 +16,17 @@ type FetchInfo struct {
 	Header                http.Header // 自定义的请求头
 }
 
+// key 计算请求的唯一标识, 用于合并相同资源的并发请求
+func (fi FetchInfo) key() string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("%s|%v|%s|%v", fi.Path, fi.UseTranscode, fi.Format, fi.TryRawIfTranscodeFail))
+	for _, key := range openlistHeaderKeys {
+		sb.WriteString("|")
+		sb.WriteString(fi.Header.Get(key))
+	}
+	return sb.String()
+}
+
 // Resource openlist 资源信息封装
 type Resource struct {
 	Url       string                    // 资源远程路径
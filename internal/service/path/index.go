@@ -0,0 +1,381 @@
+package path
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+)
+
+const (
+	// indexVersion 索引文件格式版本, 版本不一致时重新构建索引
+	indexVersion = 1
+
+	// indexCheckInterval 检查索引是否需要刷新的时间间隔
+	indexCheckInterval = time.Minute
+)
+
+// indexData 持久化到磁盘的索引数据
+type indexData struct {
+	Version   int                  `json:"version"`
+	Roots     []string             `json:"roots"`
+	UpdatedAt time.Time            `json:"updatedAt"` // 最近一次刷新的时间
+	FullAt    time.Time            `json:"fullAt"`    // 最近一次全量刷新的时间
+	Dirs      map[string]*indexDir `json:"dirs"`      // key 为目录的 openlist 绝对路径
+}
+
+// indexDir 单个目录的索引
+type indexDir struct {
+	Modified string        `json:"modified"` // 目录修改时间, 没有变化时增量刷新会跳过该目录
+	Files    []indexedFile `json:"files"`
+	Dirs     []string      `json:"dirs"` // 子目录名称
+}
+
+// indexedFile 被索引的文件
+type indexedFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// pathIndex 内存中的路径索引, 构建完成后只读
+type pathIndex struct {
+	data *indexData
+
+	// files 文件绝对路径 => 文件大小
+	files map[string]int64
+
+	// byName 小写文件名 => 文件绝对路径
+	byName map[string][]string
+
+	// byFuzzy 模糊文件名 => 文件绝对路径
+	byFuzzy map[string][]string
+}
+
+var (
+	// currentIndex 当前使用的索引, 为空表示索引尚未构建完成
+	currentIndex atomic.Pointer[pathIndex]
+
+	// indexMu 保证同一时间只有一个刷新任务
+	indexMu sync.Mutex
+
+	// startIndexOnce 保证索引维护协程只启动一次
+	startIndexOnce sync.Once
+)
+
+// StartIndexer 加载磁盘中的路径索引, 并启动后台协程定时刷新
+func StartIndexer() {
+	startIndexOnce.Do(func() {
+		cfg := config.C().Path.Index
+		data, err := loadIndexData(cfg.FilePath())
+		if err != nil {
+			logger.Warnf("加载路径索引失败, 将重新构建: %v", err)
+		} else if data != nil {
+			if !slices.Equal(data.Roots, cfg.Roots) {
+				logger.Info("路径索引目录发生变更, 将重新构建")
+			} else {
+				setIndex(data)
+				logger.Infof("已加载路径索引, 文件数: %d, 更新时间: %s", len(currentIndex.Load().files), data.UpdatedAt.Format(time.DateTime))
+			}
+		}
+		go loopRefreshIndex()
+	})
+}
+
+// loopRefreshIndex 定时检查索引是否需要刷新
+func loopRefreshIndex() {
+	for {
+		cfg := config.C().Path.Index
+		if cfg.Enable {
+			idx := currentIndex.Load()
+			now := time.Now()
+			switch {
+			case idx == nil || !slices.Equal(idx.data.Roots, cfg.Roots):
+				RefreshIndex(true)
+			case now.Sub(idx.data.FullAt) >= cfg.FullRefreshDuration():
+				RefreshIndex(true)
+			case now.Sub(idx.data.UpdatedAt) >= cfg.RefreshDuration():
+				RefreshIndex(false)
+			}
+		}
+		time.Sleep(indexCheckInterval)
+	}
+}
+
+// RefreshIndex 刷新路径索引
+//
+// full 为 false 时进行增量刷新, 修改时间没有变化的目录直接复用旧的索引
+func RefreshIndex(full bool) error {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
+	cfg := config.C().Path.Index
+	var old *indexData
+	if idx := currentIndex.Load(); idx != nil && !full {
+		old = idx.data
+	}
+
+	start := time.Now()
+	mode := "增量"
+	if full {
+		mode = "全量"
+	}
+	logger.Infof("开始%s刷新路径索引, 目录: %v", mode, cfg.Roots)
+
+	b := &indexBuilder{cfg: cfg, old: old, dirs: make(map[string]*indexDir)}
+	for _, root := range cfg.Roots {
+		b.walk(root, "")
+	}
+	if b.listed == 0 && b.failed > 0 {
+		indexRefreshTotal.Inc("error")
+		return fmt.Errorf("刷新路径索引失败, 所有目录都请求失败")
+	}
+
+	data := &indexData{
+		Version:   indexVersion,
+		Roots:     slices.Clone(cfg.Roots),
+		UpdatedAt: start,
+		FullAt:    start,
+		Dirs:      b.dirs,
+	}
+	if !full && old != nil {
+		data.FullAt = old.FullAt
+	}
+	setIndex(data)
+	indexRefreshTotal.Inc("success")
+	logger.Infof("路径索引刷新完成, 耗时: %v, 文件数: %d, 请求目录数: %d, 复用目录数: %d, 失败目录数: %d",
+		time.Since(start).Truncate(time.Millisecond), len(currentIndex.Load().files), b.listed, b.reused, b.failed)
+
+	if err := saveIndexData(cfg.FilePath(), data); err != nil {
+		logger.Warnf("保存路径索引失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// indexBuilder 遍历 openlist 目录构建索引
+type indexBuilder struct {
+	cfg  *config.PathIndex
+	old  *indexData
+	dirs map[string]*indexDir
+
+	// listed, reused, failed 请求, 复用, 请求失败的目录数
+	listed, reused, failed int
+}
+
+// walk 递归遍历目录, modified 为上级目录中记录的当前目录修改时间
+//
+// 目录的修改时间只会随直接子项的增删而变化, 更深层的变化需要列出目录获取子目录的修改时间才能发现,
+// 所以增量刷新时只有修改时间没有变化, 并且没有子目录的目录才会直接复用旧的索引
+func (b *indexBuilder) walk(dir, modified string) {
+	if b.old != nil && modified != "" {
+		if od, ok := b.old.Dirs[dir]; ok && od.Modified == modified && len(od.Dirs) == 0 {
+			b.reused++
+			b.dirs[dir] = od
+			return
+		}
+	}
+
+	res := openlist.FetchFsListCached(dir, nil)
+	if res.Code != http.StatusOK {
+		b.failed++
+		logger.Warnf("索引目录失败: %s, err: %s", dir, res.Msg)
+		// 请求失败时保留旧的索引
+		if b.old != nil {
+			if _, ok := b.old.Dirs[dir]; ok {
+				b.reuse(dir)
+			}
+		}
+		return
+	}
+	b.listed++
+
+	d := &indexDir{Modified: modified}
+	b.dirs[dir] = d
+	for _, c := range res.Data.Content {
+		if c.IsDir {
+			d.Dirs = append(d.Dirs, c.Name)
+			b.walk(joinPath(dir, c.Name), c.Modified)
+			continue
+		}
+		if b.cfg.MatchExt(c.Name) {
+			d.Files = append(d.Files, indexedFile{Name: c.Name, Size: int64(c.Size)})
+		}
+	}
+}
+
+// reuse 复用旧索引中的目录及其所有子目录, 用于目录请求失败时保留旧的索引
+func (b *indexBuilder) reuse(dir string) {
+	od, ok := b.old.Dirs[dir]
+	if !ok {
+		return
+	}
+	b.reused++
+	b.dirs[dir] = od
+	for _, name := range od.Dirs {
+		b.reuse(joinPath(dir, name))
+	}
+}
+
+// setIndex 根据索引数据构建查询结构, 替换当前使用的索引
+func setIndex(data *indexData) {
+	idx := &pathIndex{
+		data:    data,
+		files:   make(map[string]int64),
+		byName:  make(map[string][]string),
+		byFuzzy: make(map[string][]string),
+	}
+	for dir, d := range data.Dirs {
+		for _, f := range d.Files {
+			p := joinPath(dir, f.Name)
+			idx.files[p] = f.Size
+			name := strings.ToLower(f.Name)
+			idx.byName[name] = append(idx.byName[name], p)
+			fuzzy := fuzzyName(f.Name)
+			idx.byFuzzy[fuzzy] = append(idx.byFuzzy[fuzzy], p)
+		}
+	}
+	currentIndex.Store(idx)
+	indexFiles.Set(float64(len(idx.files)))
+}
+
+// LookupIndex 从路径索引中查找 openlist 资源
+//
+// size 为资源的文件大小, 未知时传 0;
+// 索引未启用或者尚未构建完成时, 第二个返回值为 false
+//
+// 查找顺序:
+//
+//  1. 路径完全一致
+//  2. 文件名一致, 大小一致的排在前面
+//  3. 忽略大小写和符号后文件名一致, 并且大小一致 (需要传递 size)
+//
+// 同一顺序下, 与 openlistPath 末尾相同的目录层级越多越靠前
+func LookupIndex(openlistPath string, size int64) ([]string, bool) {
+	if cfg := config.C().Path.Index; cfg == nil || !cfg.Enable {
+		return nil, false
+	}
+	idx := currentIndex.Load()
+	if idx == nil {
+		return nil, false
+	}
+	return idx.lookup(openlistPath, size), true
+}
+
+// lookup 在索引中查找资源
+func (idx *pathIndex) lookup(openlistPath string, size int64) []string {
+	if s, ok := idx.files[openlistPath]; ok && (size <= 0 || s == size) {
+		return []string{openlistPath}
+	}
+
+	name := filepath.Base(openlistPath)
+	if cands := idx.byName[strings.ToLower(name)]; len(cands) > 0 {
+		sameSize, others := idx.splitBySize(cands, size)
+		return slices.Concat(sortBySuffix(sameSize, openlistPath), sortBySuffix(others, openlistPath))
+	}
+
+	if size <= 0 {
+		return nil
+	}
+	sameSize, _ := idx.splitBySize(idx.byFuzzy[fuzzyName(name)], size)
+	return sortBySuffix(sameSize, openlistPath)
+}
+
+// splitBySize 将路径按照文件大小是否与 size 一致拆分成两组
+//
+// size 小于等于 0 时, 所有路径都视为大小一致
+func (idx *pathIndex) splitBySize(paths []string, size int64) (same, others []string) {
+	for _, p := range paths {
+		if size <= 0 || idx.files[p] == size {
+			same = append(same, p)
+		} else {
+			others = append(others, p)
+		}
+	}
+	return
+}
+
+// sortBySuffix 按照与 target 末尾相同的目录层级数量倒序排列
+func sortBySuffix(paths []string, target string) []string {
+	targetSegs := strings.Split(target, "/")
+	score := func(p string) int {
+		segs := strings.Split(p, "/")
+		n := 0
+		for i, j := len(segs)-1, len(targetSegs)-1; i >= 0 && j >= 0 && segs[i] == targetSegs[j]; i, j = i-1, j-1 {
+			n++
+		}
+		return n
+	}
+	res := slices.Clone(paths)
+	slices.SortStableFunc(res, func(a, b string) int {
+		return score(b) - score(a)
+	})
+	return res
+}
+
+// fuzzyName 将文件名转换为模糊匹配使用的格式, 只保留小写的字母和数字
+func fuzzyName(name string) string {
+	sb := strings.Builder{}
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// joinPath 拼接 openlist 路径
+func joinPath(dir, name string) string {
+	if dir == "/" {
+		return "/" + name
+	}
+	return dir + "/" + name
+}
+
+// loadIndexData 从磁盘中加载索引数据, 文件不存在时返回 nil
+func loadIndexData(file string) (*indexData, error) {
+	bytes, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data indexData
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		return nil, fmt.Errorf("解析索引文件失败: %v", err)
+	}
+	if data.Version != indexVersion {
+		return nil, fmt.Errorf("索引文件版本不一致: %d", data.Version)
+	}
+	if data.Dirs == nil {
+		data.Dirs = make(map[string]*indexDir)
+	}
+	return &data, nil
+}
+
+// saveIndexData 将索引数据保存到磁盘, 先写入临时文件再重命名, 避免写入中断导致文件损坏
+func saveIndexData(file string, data *indexData) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
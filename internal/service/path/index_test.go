@@ -0,0 +1,178 @@
+package path
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+func TestIndexLookup(t *testing.T) {
+	setIndex(&indexData{
+		Version: indexVersion,
+		Roots:   []string{"/"},
+		Dirs: map[string]*indexDir{
+			"/":                   {Dirs: []string{"115", "阿里"}},
+			"/115":                {Dirs: []string{"电影"}},
+			"/115/电影":             {Files: []indexedFile{{Name: "Dune.2021.2160p.mkv", Size: 100}, {Name: "Alien.mkv", Size: 50}}},
+			"/阿里":                 {Dirs: []string{"电影"}},
+			"/阿里/电影":              {Files: []indexedFile{{Name: "Dune.2021.2160p.mkv", Size: 200}}},
+			"/阿里/电影/Alien (1979)": {Files: []indexedFile{{Name: "Alien.mkv", Size: 50}}},
+		},
+	})
+	defer currentIndex.Store(nil)
+
+	tests := []struct {
+		name string
+		path string
+		size int64
+		want []string
+	}{
+		{name: "完全一致", path: "/115/电影/Dune.2021.2160p.mkv", size: 100, want: []string{"/115/电影/Dune.2021.2160p.mkv"}},
+		{name: "完全一致但大小不同", path: "/115/电影/Dune.2021.2160p.mkv", size: 200, want: []string{"/阿里/电影/Dune.2021.2160p.mkv", "/115/电影/Dune.2021.2160p.mkv"}},
+		{name: "同名文件按目录层级排序", path: "/xx/电影/Alien.mkv", want: []string{"/115/电影/Alien.mkv", "/阿里/电影/Alien (1979)/Alien.mkv"}},
+		{name: "文件名忽略大小写", path: "/电影/dune.2021.2160P.mkv", size: 200, want: []string{"/阿里/电影/Dune.2021.2160p.mkv", "/115/电影/Dune.2021.2160p.mkv"}},
+		{name: "模糊匹配", path: "/电影/Dune 2021 2160p.mkv", size: 100, want: []string{"/115/电影/Dune.2021.2160p.mkv"}},
+		{name: "模糊匹配需要大小", path: "/电影/Dune 2021 2160p.mkv", want: nil},
+		{name: "找不到", path: "/电影/Blade Runner.mkv", size: 100, want: nil},
+	}
+
+	idx := currentIndex.Load()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idx.lookup(tt.path, tt.size)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("lookup(%q, %d) = %v, want %v", tt.path, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshIndexIncremental(t *testing.T) {
+	// fsDir 模拟的 openlist 目录
+	type fsDir struct {
+		modified string
+		dirs     []string
+		files    []string
+	}
+	tree := map[string]*fsDir{
+		"/":            {dirs: []string{"电视剧"}},
+		"/电视剧":         {modified: "t1", dirs: []string{"剧集A"}},
+		"/电视剧/剧集A":     {modified: "t1", dirs: []string{"S01"}, files: []string{"poster.jpg"}},
+		"/电视剧/剧集A/S01": {modified: "t1", files: []string{"E01.mkv"}},
+	}
+	var mu sync.Mutex
+	listed := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Path string `json:"path"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		listed[req.Path]++
+		d := tree[req.Path]
+		content := make([]map[string]any, 0)
+		for _, name := range d.dirs {
+			content = append(content, map[string]any{"name": name, "is_dir": true, "modified": tree[joinPath(req.Path, name)].modified})
+		}
+		for _, name := range d.files {
+			content = append(content, map[string]any{"name": name, "size": 1})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"code": 200, "data": map[string]any{"content": content}})
+	}))
+	defer srv.Close()
+
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+	config.Set(&config.Config{
+		Openlist: &config.Openlist{Host: srv.URL, Token: "token"},
+		Path:     &config.Path{Index: &config.PathIndex{Enable: true, File: filepath.Join(t.TempDir(), "index.json")}},
+	})
+	if err := config.C().Path.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer currentIndex.Store(nil)
+
+	if err := RefreshIndex(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// 在最深层的目录中新增文件, 只有该目录的修改时间会变化
+	mu.Lock()
+	tree["/电视剧/剧集A/S01"].modified = "t2"
+	tree["/电视剧/剧集A/S01"].files = append(tree["/电视剧/剧集A/S01"].files, "E02.mkv")
+	clear(listed)
+	mu.Unlock()
+
+	if err := RefreshIndex(false); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := LookupIndex("/电视剧/剧集A/S01/E02.mkv", 1); !ok || !slices.Equal(got, []string{"/电视剧/剧集A/S01/E02.mkv"}) {
+		t.Fatalf("增量刷新没有发现深层目录中新增的文件: %v", got)
+	}
+
+	// 没有变化的叶子目录直接复用, 不再请求
+	mu.Lock()
+	tree["/电视剧/剧集A/S01"].files = append(tree["/电视剧/剧集A/S01"].files, "E03.mkv")
+	clear(listed)
+	mu.Unlock()
+	if err := RefreshIndex(false); err != nil {
+		t.Fatal(err)
+	}
+	if listed["/电视剧/剧集A/S01"] != 0 {
+		t.Errorf("修改时间没有变化的叶子目录不应该被重新请求")
+	}
+}
+
+func TestEmby2OpenlistIndexMiss(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"code": 200, "data": map[string]any{"content": []map[string]any{
+			{"name": "115", "is_dir": true},
+			{"name": "阿里", "is_dir": true},
+		}}})
+	}))
+	defer srv.Close()
+
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+	config.Set(&config.Config{
+		Openlist: &config.Openlist{Host: srv.URL, Token: "token"},
+		Path:     &config.Path{Index: &config.PathIndex{Enable: true}},
+	})
+	setIndex(&indexData{
+		Version: indexVersion,
+		Roots:   []string{"/115"},
+		Dirs: map[string]*indexDir{
+			"/115":    {Dirs: []string{"电影"}},
+			"/115/电影": {Files: []indexedFile{{Name: "Dune.mkv", Size: 100}}},
+		},
+	})
+	defer currentIndex.Store(nil)
+
+	up := &config.EmbyUpstream{MountPath: "/mnt"}
+	tests := []struct {
+		name     string
+		embyPath string
+		want     []string
+	}{
+		{name: "索引命中", embyPath: "/mnt/xx/电影/Dune.mkv", want: []string{"/115/电影/Dune.mkv"}},
+		{name: "索引中找不到时遍历根目录", embyPath: "/mnt/xx/电影/Alien.mkv", want: []string{"/115/电影/Alien.mkv", "/阿里/电影/Alien.mkv"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Emby2Openlist(up, tt.embyPath, 100).Range()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Range() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
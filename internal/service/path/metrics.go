@@ -0,0 +1,14 @@
+package path
+
+import "github.com/AmbitiousJun/go-emby2openlist/v2/internal/metrics"
+
+var (
+	// indexFiles 路径索引中的文件数
+	indexFiles = metrics.NewGaugeVec("path_index_files", "路径索引中的文件数")
+
+	// indexRefreshTotal 路径索引刷新次数, result 取值: success, error
+	indexRefreshTotal = metrics.NewCounterVec("path_index_refresh_total", "路径索引刷新次数", "result")
+
+	// indexLookupTotal 路径索引查找次数, result 取值: hit, miss
+	indexLookupTotal = metrics.NewCounterVec("path_index_lookups_total", "路径索引查找次数", "result")
+)
@@ -2,16 +2,18 @@ package path
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
 )
 
+// logger path 模块日志记录器
+var logger = logs.Module("path")
+
 // OpenlistPathRes 路径转换结果
 type OpenlistPathRes struct {
 
@@ -25,8 +27,10 @@ type OpenlistPathRes struct {
 	Range func() ([]string, error)
 }
 
-// Emby2Openlist Emby 资源路径转 Openlist 资源路径
-func Emby2Openlist(embyPath string) OpenlistPathRes {
+// Emby2Openlist 将上游 Emby 的资源路径转换为 Openlist 资源路径
+//
+// size 为资源的文件大小, 启用路径索引时用于匹配同名文件, 未知时传 0
+func Emby2Openlist(up *config.EmbyUpstream, embyPath string, size int64) OpenlistPathRes {
 	pathRoutes := strings.Builder{}
 	pathRoutes.WriteString("[")
 	pathRoutes.WriteString("\n【原始路径】 => " + embyPath)
@@ -34,40 +38,32 @@ func Emby2Openlist(embyPath string) OpenlistPathRes {
 	embyPath = urls.TransferSlash(embyPath)
 	pathRoutes.WriteString("\n\n【Windows 反斜杠转换】 => " + embyPath)
 
-	embyMount := config.C.Emby.MountPath
+	embyMount := up.MountPath
 	openlistFilePath := strings.TrimPrefix(embyPath, embyMount)
 	pathRoutes.WriteString("\n\n【移除 mount-path】 => " + openlistFilePath)
 
 	openlistFilePath = urls.Unescape(openlistFilePath)
 	pathRoutes.WriteString("\n\n【URL 解码】 => " + openlistFilePath)
 
-	if mapPath, ok := config.C.Path.MapEmby2Openlist(openlistFilePath); ok {
+	if mapPath, ok := up.MapEmby2Openlist(openlistFilePath); ok {
 		openlistFilePath = mapPath
 		pathRoutes.WriteString("\n\n【命中 emby2openlist 映射】 => " + openlistFilePath)
 	}
 	pathRoutes.WriteString("\n]")
-	log.Printf(colors.ToGray("embyPath 转换路径: %s"), pathRoutes.String())
+	logger.Debugf("embyPath 转换路径: %s", pathRoutes.String())
 
 	rangeFunc := func() ([]string, error) {
-		filePath, err := SplitFromSecondSlash(openlistFilePath)
-		if err != nil {
-			return nil, fmt.Errorf("openlistFilePath 解析异常: %s, error: %v", openlistFilePath, err)
-		}
-
-		res := openlist.FetchFsList("/", nil)
-		if res.Code != http.StatusOK {
-			return nil, fmt.Errorf("请求 openlist fs list 接口异常: %s", res.Msg)
-		}
-
-		paths := make([]string, 0)
-		for _, c := range res.Data.Content {
-			if !c.IsDir {
-				continue
+		// 优先从路径索引中查找, 索引中找不到时 (如不在索引目录中或者是新增的文件), 再遍历根目录
+		if paths, ok := LookupIndex(openlistFilePath, size); ok {
+			if len(paths) > 0 {
+				indexLookupTotal.Inc("hit")
+				logger.Debugf("路径索引命中: %s => %v", openlistFilePath, paths)
+				return paths, nil
 			}
-			newPath := fmt.Sprintf("/%s%s", c.Name, filePath)
-			paths = append(paths, newPath)
+			indexLookupTotal.Inc("miss")
+			logger.Debugf("路径索引中找不到资源, 尝试遍历根目录: %s", openlistFilePath)
 		}
-		return paths, nil
+		return rangeRoots(openlistFilePath)
 	}
 
 	return OpenlistPathRes{
@@ -77,6 +73,29 @@ func Emby2Openlist(embyPath string) OpenlistPathRes {
 	}
 }
 
+// rangeRoots 遍历 openlist 的所有根目录, 将 openlistFilePath 去掉第一级目录后拼接到每个根目录下
+func rangeRoots(openlistFilePath string) ([]string, error) {
+	filePath, err := SplitFromSecondSlash(openlistFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("openlistFilePath 解析异常: %s, error: %v", openlistFilePath, err)
+	}
+
+	res := openlist.FetchFsList("/", nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求 openlist fs list 接口异常: %s", res.Msg)
+	}
+
+	paths := make([]string, 0)
+	for _, c := range res.Data.Content {
+		if !c.IsDir {
+			continue
+		}
+		newPath := fmt.Sprintf("/%s%s", c.Name, filePath)
+		paths = append(paths, newPath)
+	}
+	return paths, nil
+}
+
 // SplitFromSecondSlash 找到给定字符串 str 中第二个 '/' 字符的位置
 // 并以该位置为首字符切割剩余的子串返回
 func SplitFromSecondSlash(str string) (string, error) {
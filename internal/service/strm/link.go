@@ -0,0 +1,124 @@
+package strm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RoutePrefix strm 链接的路由前缀
+	RoutePrefix = "/ge2o/strm"
+
+	// QueryKeySign strm 链接中携带签名的 query 参数
+	QueryKeySign = "sign"
+)
+
+// BuildLink 生成写入 strm 文件的链接
+//
+// 链接格式: ${base-url}/ge2o/strm/${openlist 路径}?sign=${签名}, 路径中的每一段都会进行 url 编码
+func BuildLink(cfg *config.StrmSync, openlistPath string) string {
+	segs := strings.Split(strings.TrimPrefix(openlistPath, "/"), "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return cfg.BaseUrl + RoutePrefix + "/" + strings.Join(segs, "/") + "?" + QueryKeySign + "=" + sign(cfg.Secret, openlistPath)
+}
+
+// sign 使用密钥计算 openlist 路径的签名
+func sign(secret, openlistPath string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(openlistPath))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// ParseLink 解析 strm 同步生成的链接, 返回对应的 openlist 路径
+//
+// 只有以配置的 strm-sync.base-url 开头的链接才会被解析
+func ParseLink(link string) (string, bool) {
+	baseUrl := config.C().StrmSync.BaseUrl
+	if baseUrl == "" {
+		return "", false
+	}
+	prefix := baseUrl + RoutePrefix + "/"
+	if !strings.HasPrefix(link, prefix) {
+		return "", false
+	}
+	return decodePath(strings.TrimPrefix(link, prefix))
+}
+
+// decodePath 将链接中编码后的路径解码为 openlist 路径
+func decodePath(encPath string) (string, bool) {
+	if idx := strings.IndexAny(encPath, "?#"); idx != -1 {
+		encPath = encPath[:idx]
+	}
+	p, err := url.PathUnescape(encPath)
+	if err != nil || p == "" {
+		return "", false
+	}
+	return "/" + p, true
+}
+
+// Handle 将 strm 链接重定向到 openlist 直链, 匹配代理传输规则时由程序代理传输
+//
+// 只允许访问 strm-sync.jobs 中配置的 openlist 目录, 并且链接需要携带有效的签名
+func Handle(c *gin.Context) {
+	encPath := strings.TrimPrefix(c.Request.URL.EscapedPath(), RoutePrefix+"/")
+	openlistPath, ok := decodePath(encPath)
+	if !ok {
+		c.String(http.StatusBadRequest, "无效的 strm 链接")
+		return
+	}
+	// 清理路径中的 . 和 .., 避免通过 %2e%2e 访问同步目录之外的资源
+	openlistPath = path.Clean(openlistPath)
+
+	cfg := config.C().StrmSync
+	want := sign(cfg.Secret, openlistPath)
+	if cfg.Secret == "" || subtle.ConstantTimeCompare([]byte(c.Query(QueryKeySign)), []byte(want)) != 1 {
+		logger.Warnf("strm 链接签名校验失败: %s, ip: %s", openlistPath, c.ClientIP())
+		c.String(http.StatusUnauthorized, "strm 链接签名无效, 请重新同步 strm 文件")
+		return
+	}
+	if !cfg.Contains(openlistPath) {
+		logger.Warnf("strm 链接不在同步目录中: %s, ip: %s", openlistPath, c.ClientIP())
+		c.String(http.StatusForbidden, "strm 链接不在同步目录中")
+		return
+	}
+
+	res := openlist.FetchResource(openlist.FetchInfo{
+		Path:   openlistPath,
+		Header: c.Request.Header.Clone(),
+	})
+	if res.Code != http.StatusOK {
+		logger.Errorf("请求 openlist 资源失败: %s, code: %d, msg: %s", openlistPath, res.Code, res.Msg)
+		c.Header(cache.HeaderKeyExpired, "-1")
+		c.String(http.StatusBadGateway, "请求 openlist 资源失败: %s", res.Msg)
+		return
+	}
+	if rule, ok := config.C().ProxyStream.Match(c.GetHeader("X-Emby-Client"), c.GetHeader("User-Agent"), openlistPath); ok {
+		logger.Infof("strm 代理传输: %s, range: %s", openlistPath, c.GetHeader("Range"))
+		c.Header(cache.HeaderKeyExpired, "-1")
+		err := https.ProxyStream(c.Writer, c.Request, res.Data.Url, rule.Header())
+		if err == nil || errors.Is(err, https.ErrStreamAborted) {
+			return
+		}
+		logger.Warnf("strm 代理传输失败, 回退为重定向: %s, err: %v", openlistPath, err)
+	}
+	logger.Infof("strm 重定向: %s => %s", openlistPath, res.Data.Url)
+	c.Header(cache.HeaderKeyExpired, cache.Duration(time.Minute*10))
+	c.Redirect(http.StatusTemporaryRedirect, res.Data.Url)
+}
@@ -0,0 +1,337 @@
+package strm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
+)
+
+// logger strm 模块日志记录器
+var logger = logs.Module("strm")
+
+// manifestFile 记录同步下载的附属文件, 保存在本地目录中
+//
+// 清理时只删除由同步下载的附属文件, 不会误删 Emby 刮削生成的海报, nfo 等文件
+const manifestFile = ".ge2o-strm.json"
+
+var (
+	// syncMu 保证同一时间只有一个同步任务在执行
+	syncMu sync.Mutex
+
+	// startSchedulerOnce 保证定时同步协程只启动一次
+	startSchedulerOnce sync.Once
+)
+
+// SyncResult 同步结果统计
+type SyncResult struct {
+	Strm    int // 新增或更新的 strm 文件数
+	Sidecar int // 新增或更新的附属文件数
+	Skipped int // 没有变化而跳过的文件数
+	Removed int // 源文件已不存在而删除的文件数
+	Failed  int // 请求或写入失败的文件和目录数
+}
+
+func (r SyncResult) String() string {
+	return fmt.Sprintf("strm: %d, 附属文件: %d, 跳过: %d, 删除: %d, 失败: %d", r.Strm, r.Sidecar, r.Skipped, r.Removed, r.Failed)
+}
+
+// StartScheduler 启动后台协程, 按照配置的间隔定时同步所有任务
+func StartScheduler() {
+	startSchedulerOnce.Do(func() {
+		go func() {
+			for {
+				if cfg := config.C().StrmSync; cfg.Enable {
+					SyncAll(nil)
+				}
+				time.Sleep(config.C().StrmSync.IntervalDuration())
+			}
+		}()
+	})
+}
+
+// SyncAll 同步配置中的任务, names 为空时同步所有任务
+//
+// 返回执行失败的任务错误信息
+func SyncAll(names []string) error {
+	cfg := config.C().StrmSync
+	var errs []error
+	matched := 0
+	for _, job := range cfg.Jobs {
+		if len(names) > 0 && !slices.Contains(names, job.Name) {
+			continue
+		}
+		matched++
+		if _, err := Sync(cfg, job); err != nil {
+			errs = append(errs, fmt.Errorf("任务 [%s] 同步失败: %v", job.Name, err))
+		}
+	}
+	if matched == 0 {
+		return fmt.Errorf("找不到需要同步的任务: %v", names)
+	}
+	return errors.Join(errs...)
+}
+
+// Sync 将 openlist 目录同步到本地目录
+//
+// 视频文件生成对应的 strm 文件, 附属文件直接下载到本地,
+// 同步完成后删除源文件已不存在的 strm 文件和附属文件
+func Sync(cfg *config.StrmSync, job *config.StrmSyncJob) (SyncResult, error) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	start := time.Now()
+	logger.Infof("开始同步 strm 任务 [%s]: %s => %s", job.Name, job.OpenlistPath, job.LocalPath)
+	s := &syncer{
+		cfg:      cfg,
+		job:      job,
+		expected: make(map[string]struct{}),
+		synced:   loadManifest(job.LocalPath),
+	}
+	if err := s.walk(job.OpenlistPath, job.LocalPath); err != nil {
+		return s.res, err
+	}
+	s.clean()
+	if err := s.saveManifest(); err != nil {
+		logger.Warnf("保存同步记录失败: %v", err)
+	}
+	logger.Infof("strm 任务 [%s] 同步完成, 耗时: %v, %s", job.Name, time.Since(start).Truncate(time.Millisecond), s.res)
+	return s.res, nil
+}
+
+// syncer 单次同步任务的执行状态
+type syncer struct {
+	cfg *config.StrmSync
+	job *config.StrmSyncJob
+	res SyncResult
+
+	// expected 本次同步后应该存在的本地文件和目录
+	expected map[string]struct{}
+
+	// failedDirs 请求失败的本地目录, 清理时跳过这些目录, 避免误删
+	failedDirs []string
+
+	// synced 之前同步下载的附属文件, 相对于本地目录的路径
+	synced map[string]struct{}
+}
+
+// walk 递归同步 openlist 目录
+func (s *syncer) walk(openlistDir, localDir string) error {
+	res := openlist.FetchFsListCached(openlistDir, nil)
+	if res.Code != http.StatusOK {
+		if openlistDir == s.job.OpenlistPath {
+			return fmt.Errorf("请求 openlist 目录失败: %s, err: %s", openlistDir, res.Msg)
+		}
+		s.res.Failed++
+		s.failedDirs = append(s.failedDirs, localDir)
+		logger.Warnf("请求 openlist 目录失败: %s, err: %s", openlistDir, res.Msg)
+		return nil
+	}
+
+	s.expected[localDir] = struct{}{}
+	if err := os.MkdirAll(localDir, os.ModePerm); err != nil {
+		return fmt.Errorf("创建本地目录失败: %s, err: %v", localDir, err)
+	}
+
+	for _, c := range res.Data.Content {
+		openlistPath := strings.TrimSuffix(openlistDir, "/") + "/" + c.Name
+		localPath := filepath.Join(localDir, c.Name)
+		switch {
+		case c.IsDir:
+			if err := s.walk(openlistPath, localPath); err != nil {
+				return err
+			}
+		case s.cfg.IsVideo(c.Name):
+			strmPath := strings.TrimSuffix(localPath, filepath.Ext(localPath)) + ".strm"
+			s.expected[strmPath] = struct{}{}
+			s.writeStrm(strmPath, BuildLink(s.cfg, openlistPath))
+		case s.cfg.IsSidecar(c.Name):
+			s.expected[localPath] = struct{}{}
+			s.copySidecar(openlistPath, localPath, int64(c.Size))
+		}
+	}
+	return nil
+}
+
+// writeStrm 写入 strm 文件, 内容没有变化时跳过
+func (s *syncer) writeStrm(strmPath, link string) {
+	if old, err := os.ReadFile(strmPath); err == nil && string(old) == link {
+		s.res.Skipped++
+		return
+	}
+	if err := os.WriteFile(strmPath, []byte(link), 0644); err != nil {
+		s.res.Failed++
+		logger.Warnf("写入 strm 文件失败: %s, err: %v", strmPath, err)
+		return
+	}
+	s.res.Strm++
+}
+
+// copySidecar 下载附属文件到本地, 本地文件大小一致时跳过
+func (s *syncer) copySidecar(openlistPath, localPath string, size int64) {
+	if info, err := os.Stat(localPath); err == nil && info.Size() == size {
+		s.res.Skipped++
+		return
+	}
+	if err := download(openlistPath, localPath); err != nil {
+		s.res.Failed++
+		logger.Warnf("下载附属文件失败: %s, err: %v", openlistPath, err)
+		return
+	}
+	s.res.Sidecar++
+}
+
+// download 下载 openlist 文件到本地, 先写入临时文件再重命名
+func download(openlistPath, localPath string) error {
+	res := openlist.FetchFsGet(openlistPath, nil)
+	if res.Code != http.StatusOK {
+		return fmt.Errorf("获取下载链接失败: %s", res.Msg)
+	}
+	resp, err := https.Get(res.Data.RawUrl).Do()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载失败: %s", resp.Status)
+	}
+
+	tmp := localPath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, localPath)
+}
+
+// clean 删除源文件已不存在的 strm 文件和附属文件, 以及删除后为空的目录
+//
+// 只会删除 strm 和附属文件扩展名的文件, 不会影响 Emby 在本地生成的其他文件
+func (s *syncer) clean() {
+	var dirs []string
+	filepath.WalkDir(s.job.LocalPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if s.underFailedDir(p) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ok := s.expected[p]; ok {
+			return nil
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(p), ".strm") && !s.isSynced(p) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			s.res.Failed++
+			logger.Warnf("删除文件失败: %s, err: %v", p, err)
+			return nil
+		}
+		s.res.Removed++
+		logger.Infof("源文件已不存在, 删除: %s", p)
+		return nil
+	})
+
+	// 从最深的目录开始删除空目录
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+			os.Remove(dirs[i])
+		}
+	}
+}
+
+// isSynced 判断本地文件是否为之前同步下载的附属文件
+func (s *syncer) isSynced(p string) bool {
+	rel, err := filepath.Rel(s.job.LocalPath, p)
+	if err != nil {
+		return false
+	}
+	_, ok := s.synced[filepath.ToSlash(rel)]
+	return ok
+}
+
+// loadManifest 读取本地目录中的同步记录
+func loadManifest(localDir string) map[string]struct{} {
+	res := make(map[string]struct{})
+	bytes, err := os.ReadFile(filepath.Join(localDir, manifestFile))
+	if err != nil {
+		return res
+	}
+	var files []string
+	if err := json.Unmarshal(bytes, &files); err != nil {
+		logger.Warnf("解析同步记录失败: %v", err)
+		return res
+	}
+	for _, f := range files {
+		res[f] = struct{}{}
+	}
+	return res
+}
+
+// saveManifest 将本次同步的附属文件写入同步记录
+//
+// 请求失败的目录中的旧记录会被保留, 以便下次同步时继续清理
+func (s *syncer) saveManifest() error {
+	files := make([]string, 0)
+	for p := range s.expected {
+		if !s.cfg.IsSidecar(p) {
+			continue
+		}
+		if info, err := os.Stat(p); err != nil || info.IsDir() {
+			continue
+		}
+		if rel, err := filepath.Rel(s.job.LocalPath, p); err == nil {
+			files = append(files, filepath.ToSlash(rel))
+		}
+	}
+	for f := range s.synced {
+		if s.underFailedDir(filepath.Join(s.job.LocalPath, filepath.FromSlash(f))) {
+			files = append(files, f)
+		}
+	}
+	slices.Sort(files)
+	bytes, err := json.Marshal(slices.Compact(files))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.job.LocalPath, manifestFile), bytes, 0644)
+}
+
+// underFailedDir 判断本地路径是否在请求失败的目录下
+func (s *syncer) underFailedDir(p string) bool {
+	for _, dir := range s.failedDirs {
+		if p == dir || strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
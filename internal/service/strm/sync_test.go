@@ -0,0 +1,170 @@
+package strm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLink(t *testing.T) {
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+	config.Set(&config.Config{StrmSync: &config.StrmSync{BaseUrl: "http://ge2o:8095", Secret: "secret"}})
+
+	tests := []struct {
+		name string
+		path string
+		link string
+	}{
+		{name: "普通路径", path: "/115/电影/Dune.mkv", link: "http://ge2o:8095/ge2o/strm/115/%E7%94%B5%E5%BD%B1/Dune.mkv?sign=" + sign("secret", "/115/电影/Dune.mkv")},
+		{name: "特殊字符", path: "/115/A #1?/B%.mkv", link: "http://ge2o:8095/ge2o/strm/115/A%20%231%3F/B%25.mkv?sign=" + sign("secret", "/115/A #1?/B%.mkv")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link := BuildLink(config.C().StrmSync, tt.path)
+			if link != tt.link {
+				t.Fatalf("BuildLink() = %s, want %s", link, tt.link)
+			}
+			p, ok := ParseLink(link)
+			if !ok || p != tt.path {
+				t.Fatalf("ParseLink() = %s, %v, want %s", p, ok, tt.path)
+			}
+		})
+	}
+
+	if _, ok := ParseLink("http://other:8095/ge2o/strm/115/a.mkv"); ok {
+		t.Fatal("其他地址的链接不应被解析")
+	}
+}
+
+func TestSync(t *testing.T) {
+	// files 模拟的 openlist 目录结构, 文件内容为 nil 表示目录
+	files := map[string]map[string][]byte{
+		"/media":             {"Dune (2021)": nil, "readme.txt": []byte("x")},
+		"/media/Dune (2021)": {"Dune.mkv": []byte("video"), "Dune.nfo": []byte("<movie/>"), "Dune.zh.srt": []byte("1")},
+	}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/raw" {
+			dir, name := filepath.Split(r.URL.Query().Get("path"))
+			w.Write(files[filepath.Clean(dir)][name])
+			return
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		p := body["path"].(string)
+		switch r.URL.Path {
+		case "/api/fs/list":
+			entries, ok := files[p]
+			if !ok {
+				w.Write([]byte(`{"code":500,"message":"object not found"}`))
+				return
+			}
+			content := make([]map[string]any, 0)
+			for name, data := range entries {
+				content = append(content, map[string]any{"name": name, "size": len(data), "is_dir": data == nil})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"code": 200, "data": map[string]any{"content": content}})
+		case "/api/fs/get":
+			fmt.Fprintf(w, `{"code":200,"data":{"raw_url":"%s/raw?path=%s"}}`, srv.URL, url.QueryEscape(p))
+		}
+	}))
+	defer srv.Close()
+
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+	config.Set(&config.Config{Openlist: &config.Openlist{Host: srv.URL, Token: "token"}})
+	cfg := &config.StrmSync{BaseUrl: "http://ge2o:8095", Secret: "secret", Jobs: []*config.StrmSyncJob{{OpenlistPath: "/media", LocalPath: t.TempDir()}}}
+	if err := cfg.Init(); err != nil {
+		t.Fatal(err)
+	}
+	config.C().StrmSync = cfg
+	job := cfg.Jobs[0]
+	local := func(p string) string { return filepath.Join(job.LocalPath, filepath.FromSlash(p)) }
+
+	// Emby 刮削生成的文件, 不应被清理
+	os.MkdirAll(local("Dune (2021)"), os.ModePerm)
+	os.WriteFile(local("Dune (2021)/poster.jpg"), []byte("emby"), 0644)
+
+	res, err := Sync(cfg, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Strm != 1 || res.Sidecar != 2 {
+		t.Fatalf("首次同步结果: %s", res)
+	}
+	if link, _ := os.ReadFile(local("Dune (2021)/Dune.strm")); string(link) != "http://ge2o:8095/ge2o/strm/media/Dune%20%282021%29/Dune.mkv?sign="+sign("secret", "/media/Dune (2021)/Dune.mkv") {
+		t.Fatalf("strm 内容: %s", link)
+	}
+	if data, _ := os.ReadFile(local("Dune (2021)/Dune.nfo")); string(data) != "<movie/>" {
+		t.Fatalf("nfo 内容: %s", data)
+	}
+	if _, err := os.Stat(local("readme.txt")); err == nil {
+		t.Fatal("不应同步非视频和附属文件")
+	}
+
+	// 再次同步时跳过没有变化的文件
+	if res, _ = Sync(cfg, job); res.Skipped != 3 || res.Strm+res.Sidecar != 0 {
+		t.Fatalf("再次同步结果: %s", res)
+	}
+
+	// 源文件删除后, 清理本地文件
+	delete(files["/media/Dune (2021)"], "Dune.mkv")
+	delete(files["/media/Dune (2021)"], "Dune.zh.srt")
+	if res, _ = Sync(cfg, job); res.Removed != 2 {
+		t.Fatalf("清理结果: %s", res)
+	}
+	for _, p := range []string{"Dune (2021)/Dune.strm", "Dune (2021)/Dune.zh.srt"} {
+		if _, err := os.Stat(local(p)); err == nil {
+			t.Fatalf("文件未被清理: %s", p)
+		}
+	}
+	if _, err := os.Stat(local("Dune (2021)/poster.jpg")); err != nil {
+		t.Fatal("Emby 生成的文件被误删")
+	}
+}
+
+func TestHandleRejectsUnsignedLink(t *testing.T) {
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+	cfg := &config.StrmSync{BaseUrl: "http://ge2o:8095", Secret: "secret", Jobs: []*config.StrmSyncJob{{OpenlistPath: "/media", LocalPath: t.TempDir()}}}
+	if err := cfg.Init(); err != nil {
+		t.Fatal(err)
+	}
+	config.Set(&config.Config{StrmSync: cfg})
+
+	tests := []struct {
+		name string
+		uri  string
+		want int
+	}{
+		{name: "没有签名", uri: "/ge2o/strm/media/a.mkv", want: http.StatusUnauthorized},
+		{name: "签名错误", uri: "/ge2o/strm/media/a.mkv?sign=" + sign("other", "/media/a.mkv"), want: http.StatusUnauthorized},
+		{name: "路径穿越", uri: "/ge2o/strm/media/%2e%2e/private/a.mkv?sign=" + sign("secret", "/media/../private/a.mkv"), want: http.StatusUnauthorized},
+		{name: "同步目录之外", uri: "/ge2o/strm/private/a.mkv?sign=" + sign("secret", "/private/a.mkv"), want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, tt.uri, nil)
+			Handle(c)
+			if w.Code != tt.want {
+				t.Fatalf("code = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	if cfg.Contains("/media/../private/a.mkv") {
+		t.Fatal("包含 .. 的路径不应该被视为在同步目录中")
+	}
+}
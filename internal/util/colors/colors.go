@@ -1,5 +1,7 @@
 package colors
 
+import "sync/atomic"
+
 // 日志颜色输出常量
 const (
 	Blue   = "\x1b[38;2;090;156;248m"
@@ -19,10 +21,11 @@ type Enabler interface {
 	EnableColor() bool
 }
 
-var enabler Enabler
+// enabler 当前生效的颜色输出控制器, 配置热重载时会被替换
+var enabler atomic.Pointer[Enabler]
 
 // SetEnabler 设置颜色输出控制器
-func SetEnabler(e Enabler) { enabler = e }
+func SetEnabler(e Enabler) { enabler.Store(&e) }
 
 // ToBlue 将字符串转成蓝色
 func ToBlue(str string) string {
@@ -58,7 +61,7 @@ func ToGray(str string) string {
 //
 // 如果用户关闭了颜色输出, 则直接返回原字符串
 func wrapColor(color, str string) string {
-	if enabler != nil && !enabler.EnableColor() {
+	if e := enabler.Load(); e != nil && *e != nil && !(*e).EnableColor() {
 		return str
 	}
 	return color + str + reset
@@ -5,14 +5,18 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
 )
 
+// logger https 模块日志记录器
+var logger = logs.Module("https")
+
 const (
 
 	// MaxRedirectDepth 重定向的最大深度
@@ -32,6 +36,9 @@ func init() {
 			Dial: (&net.Dialer{Timeout: time.Minute}).Dial,
 			// 接收数据 5 分钟超时
 			ResponseHeaderTimeout: time.Minute * 5,
+			// 代理传输时客户端会对同一个直链发起大量 Range 请求, 保留更多空闲连接以便复用
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     time.Minute * 2,
 		},
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
@@ -70,7 +77,7 @@ func MapBody(body map[string]any) io.ReadCloser {
 	}
 	bodyBytes, err := json.Marshal(body)
 	if err != nil {
-		log.Printf("MapBody 转换失败, body: %v, err : %v", body, err)
+		logger.Warnf("MapBody 转换失败, body: %v, err : %v", body, err)
 		return nil
 	}
 	return io.NopCloser(bytes.NewBuffer(bodyBytes))
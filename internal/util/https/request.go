@@ -2,6 +2,7 @@ package https
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -25,6 +26,9 @@ type RequestHolder struct {
 
 	// redirect 是否自动重定向
 	redirect bool
+
+	// ctx 请求上下文, 可用于控制超时
+	ctx context.Context
 }
 
 // Request 构造自定义请求
@@ -83,6 +87,12 @@ func (r *RequestHolder) Body(body io.ReadCloser) *RequestHolder {
 	return r
 }
 
+// Context 设置请求上下文, 上下文取消时请求随之中断
+func (r *RequestHolder) Context(ctx context.Context) *RequestHolder {
+	r.ctx = ctx
+	return r
+}
+
 // Do 发起请求 自动重定向
 func (r *RequestHolder) Do() (*http.Response, error) {
 	r.redirect = true
@@ -121,7 +131,11 @@ func (r *RequestHolder) execute() (string, *http.Response, error) {
 				return "", nil, fmt.Errorf("读取请求体失败: %v", err)
 			}
 		}
-		req, err := http.NewRequest(method, url, bytes.NewBuffer(bodyBytes))
+		ctx := r.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(bodyBytes))
 		if err != nil {
 			return "", nil, fmt.Errorf("创建请求失败: %v", err)
 		}
@@ -0,0 +1,90 @@
+package https
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// streamBufferSize 代理传输时每次读写的缓冲区大小
+const streamBufferSize = 128 * 1024
+
+// streamBufPool 代理传输的缓冲区池, 避免每个请求重复分配内存
+var streamBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, streamBufferSize)
+		return &buf
+	},
+}
+
+// streamReqHeaders 代理传输时透传给远程服务器的客户端请求头
+var streamReqHeaders = []string{
+	"Range", "If-Range", "If-Match", "If-None-Match",
+	"If-Modified-Since", "If-Unmodified-Since", "User-Agent",
+}
+
+// streamRespHeaders 代理传输时返回给客户端的远程响应头
+var streamRespHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges",
+	"Content-Disposition", "Last-Modified", "ETag",
+}
+
+// ErrStreamAborted 已经开始向客户端传输数据后出现异常, 通常是客户端主动断开连接
+var ErrStreamAborted = errors.New("传输数据中断")
+
+// ProxyStream 请求远程资源, 并将数据流转发给客户端
+//
+// 客户端的 Range 等条件请求头会透传给远程服务器, 远程服务器的 206 响应和 Content-Range 原样返回;
+// 数据按固定大小的缓冲区同步读写, 客户端接收变慢时会自然减缓对远程服务器的读取;
+// header 中的请求头会覆盖客户端的同名请求头, 用于携带网盘所需的 Referer, Cookie 等信息
+//
+// 返回 ErrStreamAborted 以外的错误时, 还没有向客户端写入任何数据, 调用方可以继续尝试其他资源
+func ProxyStream(w http.ResponseWriter, r *http.Request, remote string, header http.Header) error {
+	method := r.Method
+	if method != http.MethodHead {
+		method = http.MethodGet
+	}
+
+	reqHeader := make(http.Header)
+	for _, key := range streamReqHeaders {
+		if values := r.Header.Values(key); len(values) > 0 {
+			reqHeader[key] = values
+		}
+	}
+	for key, values := range header {
+		reqHeader[http.CanonicalHeaderKey(key)] = values
+	}
+
+	resp, err := Request(method, remote).Header(reqHeader).Context(r.Context()).Do()
+	if err != nil {
+		return fmt.Errorf("请求远程资源失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if IsErrorCode(resp.StatusCode) && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		return fmt.Errorf("远程服务器响应异常: %s", resp.Status)
+	}
+
+	for _, key := range streamRespHeaders {
+		if values := resp.Header.Values(key); len(values) > 0 {
+			w.Header()[key] = values
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if method == http.MethodHead {
+		return nil
+	}
+
+	buf := streamBufPool.Get().(*[]byte)
+	defer streamBufPool.Put(buf)
+	if _, err := io.CopyBuffer(writerOnly{w}, resp.Body, *buf); err != nil {
+		return fmt.Errorf("%w: %v", ErrStreamAborted, err)
+	}
+	return nil
+}
+
+// writerOnly 隐藏 ResponseWriter 的 ReadFrom 方法, 确保 io.CopyBuffer 使用指定的缓冲区
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,82 @@
+package https_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+)
+
+func TestProxyStream(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/file", http.StatusFound)
+			return
+		}
+		if r.URL.Path != "/file" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Referer") != "https://drive.example.com" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "a.mp4", time.Time{}, strings.NewReader(content))
+	}))
+	defer remote.Close()
+
+	header := http.Header{"Referer": []string{"https://drive.example.com"}}
+	tests := []struct {
+		name     string
+		path     string
+		rangeVal string
+		header   http.Header
+		wantErr  bool
+		wantCode int
+		wantBody string
+	}{
+		{name: "full", path: "/file", header: header, wantCode: http.StatusOK, wantBody: content},
+		{name: "range", path: "/file", rangeVal: "bytes=10-19", header: header, wantCode: http.StatusPartialContent, wantBody: content[10:20]},
+		{name: "redirect", path: "/redirect", rangeVal: "bytes=990-", header: header, wantCode: http.StatusPartialContent, wantBody: content[990:]},
+		{name: "unsatisfiable", path: "/file", rangeVal: "bytes=5000-", header: header, wantCode: http.StatusRequestedRangeNotSatisfiable},
+		{name: "missing header", path: "/file", wantErr: true},
+		{name: "not found", path: "/none", header: header, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/stream", nil)
+			if tt.rangeVal != "" {
+				r.Header.Set("Range", tt.rangeVal)
+			}
+			w := httptest.NewRecorder()
+			err := https.ProxyStream(w, r, remote.URL+tt.path, tt.header)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望出现错误, 实际响应: %d", w.Code)
+				}
+				if w.Body.Len() > 0 {
+					t.Fatalf("出现错误时不应该写入响应体: %s", w.Body.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("代理传输失败: %v", err)
+			}
+			if w.Code != tt.wantCode {
+				t.Fatalf("响应码错误, 期望: %d, 实际: %d", tt.wantCode, w.Code)
+			}
+			if tt.wantBody != "" && !bytes.Equal(w.Body.Bytes(), []byte(tt.wantBody)) {
+				t.Fatalf("响应体错误, 期望长度: %d, 实际长度: %d", len(tt.wantBody), w.Body.Len())
+			}
+			if tt.wantCode == http.StatusPartialContent && w.Header().Get("Content-Range") == "" {
+				t.Fatal("206 响应缺少 Content-Range")
+			}
+		})
+	}
+}
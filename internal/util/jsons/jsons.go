@@ -34,6 +34,9 @@ func FromObject(obj any) *Item {
 
 	v := reflect.ValueOf(obj)
 	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return FromValue(nil)
+		}
 		v = v.Elem()
 	}
 	if v.Kind() != reflect.Struct && v.Kind() != reflect.Map {
@@ -0,0 +1,228 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"unicode"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
+)
+
+// textTimeLayout text 格式的时间格式
+const textTimeLayout = "2006/01/02 15:04:05"
+
+// textHandler 便于阅读的文本格式处理器
+//
+// 输出格式: 2006/01/02 15:04:05 INFO [module] message key=value ...
+type textHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	color bool
+
+	// attrs 通过 WithAttrs 预先设置的属性, 已格式化
+	attrs string
+
+	// group 通过 WithGroup 设置的属性前缀
+	group string
+}
+
+func newTextHandler(w io.Writer, color bool) *textHandler {
+	return &textHandler{w: w, mu: new(sync.Mutex), color: color}
+}
+
+func (h *textHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var module string
+	var attrs bytes.Buffer
+	attrs.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == ModuleKey && h.group == "" && module == "" {
+			module = a.Value.String()
+			return true
+		}
+		h.appendAttr(&attrs, h.group, a)
+		return true
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString(r.Time.Format(textTimeLayout))
+	buf.WriteByte(' ')
+	buf.WriteString(h.colorLevel(r.Level))
+	buf.WriteByte(' ')
+	if module != "" {
+		buf.WriteString("[" + module + "] ")
+	}
+	buf.WriteString(h.colorMsg(r.Level, r.Message))
+	buf.Write(attrs.Bytes())
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	nh := *h
+	var buf bytes.Buffer
+	buf.WriteString(h.attrs)
+	for _, a := range attrs {
+		h.appendAttr(&buf, h.group, a)
+	}
+	nh.attrs = buf.String()
+	return &nh
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	nh := *h
+	nh.group = h.group + name + "."
+	return &nh
+}
+
+// appendAttr 以 key=value 的形式追加属性
+func (h *textHandler) appendAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			h.appendAttr(buf, prefix, ga)
+		}
+		return
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(prefix + a.Key)
+	buf.WriteByte('=')
+	buf.WriteString(quoteIfNeeded(a.Value.String()))
+}
+
+// colorLevel 输出固定宽度的日志级别
+func (h *textHandler) colorLevel(level slog.Level) string {
+	str := fmt.Sprintf("%-5s", level.String())
+	if !h.color {
+		return str
+	}
+	switch {
+	case level >= slog.LevelError:
+		return colors.ToRed(str)
+	case level >= slog.LevelWarn:
+		return colors.ToYellow(str)
+	case level >= slog.LevelInfo:
+		return colors.ToGreen(str)
+	default:
+		return colors.ToGray(str)
+	}
+}
+
+// colorMsg 警告及以上级别的日志内容使用对应颜色标记
+func (h *textHandler) colorMsg(level slog.Level, msg string) string {
+	if !h.color {
+		return msg
+	}
+	switch {
+	case level >= slog.LevelError:
+		return colors.ToRed(msg)
+	case level >= slog.LevelWarn:
+		return colors.ToYellow(msg)
+	case level < slog.LevelInfo:
+		return colors.ToGray(msg)
+	default:
+		return msg
+	}
+}
+
+// quoteIfNeeded 属性值包含空白或特殊字符时加上引号
+func quoteIfNeeded(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// fanoutHandler 将日志同时分发给多个处理器
+type fanoutHandler struct {
+	handlers []slog.Handler
+}
+
+func newFanoutHandler(handlers ...slog.Handler) slog.Handler {
+	if len(handlers) == 1 {
+		return handlers[0]
+	}
+	return &fanoutHandler{handlers: handlers}
+}
+
+func (h *fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, hd := range h.handlers {
+		if hd.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, hd := range h.handlers {
+		if !hd.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := hd.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (h *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	hs := make([]slog.Handler, len(h.handlers))
+	for i, hd := range h.handlers {
+		hs[i] = hd.WithAttrs(attrs)
+	}
+	return &fanoutHandler{handlers: hs}
+}
+
+func (h *fanoutHandler) WithGroup(name string) slog.Handler {
+	hs := make([]slog.Handler, len(h.handlers))
+	for i, hd := range h.handlers {
+		hs[i] = hd.WithGroup(name)
+	}
+	return &fanoutHandler{handlers: hs}
+}
+
+// levelHandler 过滤低于指定级别的日志
+type levelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,200 @@
+// 基于 log/slog 的分级日志
+//
+// 各个模块通过 Module 获取独立的日志记录器, 支持为每个模块单独设置日志级别,
+// 输出格式支持 text 和 json, 可选同时输出到文件并按大小进行切割
+package logs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 支持的日志输出格式
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ModuleKey 模块名称在日志记录中的属性名
+const ModuleKey = "module"
+
+// Options 日志初始化参数
+type Options struct {
+	Level   slog.Level            // 默认日志级别
+	Format  string                // 输出格式: text, json
+	Color   bool                  // text 格式输出到控制台时是否启用颜色
+	Modules map[string]slog.Level // 模块单独设置的日志级别
+	File    *FileOptions          // 文件输出配置, 为空时不输出到文件
+}
+
+// state 当前生效的日志配置
+type state struct {
+	opts    Options
+	handler slog.Handler
+	file    *rotateWriter
+}
+
+var (
+	// current 当前生效的日志配置
+	current atomic.Pointer[state]
+
+	// setupMu 控制日志配置的更新
+	setupMu sync.Mutex
+)
+
+func init() {
+	current.Store(&state{
+		opts:    Options{Level: slog.LevelInfo, Format: FormatText},
+		handler: newTextHandler(os.Stderr, false),
+	})
+}
+
+// ParseLevel 解析日志级别字符串, 支持: debug, info, warn, error
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+		return 0, fmt.Errorf("无效的日志级别: %s, 支持的级别: debug, info, warn, error", level)
+	}
+	return l, nil
+}
+
+// Setup 使用新的参数初始化日志
+//
+// 文件输出配置不变时会复用已打开的日志文件,
+// 同时会接管标准库 log 包的输出
+func Setup(opts Options) error {
+	setupMu.Lock()
+	defer setupMu.Unlock()
+
+	if opts.Format == "" {
+		opts.Format = FormatText
+	}
+	if opts.Format != FormatText && opts.Format != FormatJSON {
+		return fmt.Errorf("无效的日志格式: %s, 支持的格式: %s, %s", opts.Format, FormatText, FormatJSON)
+	}
+
+	old := current.Load()
+	file := old.file
+	if !old.opts.File.equal(opts.File) {
+		file = nil
+		if opts.File != nil {
+			var err error
+			if file, err = openRotateWriter(*opts.File); err != nil {
+				return err
+			}
+		}
+	}
+
+	handlers := []slog.Handler{newHandler(os.Stderr, opts.Format, opts.Color)}
+	if file != nil {
+		handlers = append(handlers, newHandler(file, opts.Format, false))
+	}
+	st := &state{opts: opts, handler: newFanoutHandler(handlers...), file: file}
+	current.Store(st)
+
+	// 标准库 log 包的输出统一按照默认级别处理
+	slog.SetDefault(slog.New(&levelHandler{Handler: st.handler, level: opts.Level}))
+
+	if old.file != nil && old.file != file {
+		old.file.Close()
+	}
+	return nil
+}
+
+// Close 关闭日志文件
+func Close() error {
+	setupMu.Lock()
+	defer setupMu.Unlock()
+	if st := current.Load(); st.file != nil {
+		return st.file.Close()
+	}
+	return nil
+}
+
+// newHandler 根据输出格式创建日志处理器
+func newHandler(w io.Writer, format string, color bool) slog.Handler {
+	if format == FormatJSON {
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug - 4})
+	}
+	return newTextHandler(w, color)
+}
+
+// Logger 模块日志记录器
+type Logger struct {
+	module string
+}
+
+// Module 获取指定模块的日志记录器
+func Module(name string) *Logger {
+	return &Logger{module: name}
+}
+
+// Enabled 判断指定级别的日志是否需要输出
+func (l *Logger) Enabled(level slog.Level) bool {
+	opts := current.Load().opts
+	min, ok := opts.Modules[l.module]
+	if !ok {
+		min = opts.Level
+	}
+	return level >= min
+}
+
+// Debug 输出 debug 日志, args 为 slog 风格的键值对
+func (l *Logger) Debug(msg string, args ...any) { l.log(slog.LevelDebug, msg, args...) }
+
+// Info 输出 info 日志, args 为 slog 风格的键值对
+func (l *Logger) Info(msg string, args ...any) { l.log(slog.LevelInfo, msg, args...) }
+
+// Warn 输出 warn 日志, args 为 slog 风格的键值对
+func (l *Logger) Warn(msg string, args ...any) { l.log(slog.LevelWarn, msg, args...) }
+
+// Error 输出 error 日志, args 为 slog 风格的键值对
+func (l *Logger) Error(msg string, args ...any) { l.log(slog.LevelError, msg, args...) }
+
+// Debugf 格式化输出 debug 日志
+func (l *Logger) Debugf(format string, args ...any) { l.logf(slog.LevelDebug, format, args...) }
+
+// Infof 格式化输出 info 日志
+func (l *Logger) Infof(format string, args ...any) { l.logf(slog.LevelInfo, format, args...) }
+
+// Warnf 格式化输出 warn 日志
+func (l *Logger) Warnf(format string, args ...any) { l.logf(slog.LevelWarn, format, args...) }
+
+// Errorf 格式化输出 error 日志
+func (l *Logger) Errorf(format string, args ...any) { l.logf(slog.LevelError, format, args...) }
+
+func (l *Logger) logf(level slog.Level, format string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.write(level, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) log(level slog.Level, msg string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.write(level, msg, args...)
+}
+
+// write 构造日志记录并交给处理器输出
+func (l *Logger) write(level slog.Level, msg string, args ...any) {
+	// 跳过 runtime.Callers, write, log/logf, 导出方法
+	var pcs [1]uintptr
+	runtime.Callers(4, pcs[:])
+
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	if l.module != "" {
+		r.AddAttrs(slog.String(ModuleKey, l.module))
+	}
+	r.Add(args...)
+	current.Load().handler.Handle(context.Background(), r)
+}
@@ -0,0 +1,83 @@
+package logs
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModuleLevel(t *testing.T) {
+	if err := Setup(Options{
+		Level:   slog.LevelInfo,
+		Modules: map[string]slog.Level{"path": slog.LevelDebug, "cache": slog.LevelWarn},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer Setup(Options{Level: slog.LevelInfo})
+
+	tests := []struct {
+		module string
+		level  slog.Level
+		want   bool
+	}{
+		{"path", slog.LevelDebug, true},
+		{"cache", slog.LevelInfo, false},
+		{"cache", slog.LevelWarn, true},
+		{"emby", slog.LevelDebug, false},
+		{"emby", slog.LevelInfo, true},
+	}
+	for _, tt := range tests {
+		if got := Module(tt.module).Enabled(tt.level); got != tt.want {
+			t.Errorf("Module(%q).Enabled(%v) = %v, want %v", tt.module, tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestTextHandler(t *testing.T) {
+	var sb strings.Builder
+	h := newTextHandler(&sb, false)
+	r := slog.NewRecord(time.Date(2025, 1, 2, 3, 4, 5, 0, time.Local), slog.LevelWarn, "缓存写入失败", 0)
+	r.AddAttrs(slog.String(ModuleKey, "cache"), slog.String("key", "a b"), slog.Int("size", 10))
+	if err := h.Handle(t.Context(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `2025/01/02 03:04:05 WARN  [cache] 缓存写入失败 key="a b" size=10` + "\n"
+	if sb.String() != want {
+		t.Errorf("got %q, want %q", sb.String(), want)
+	}
+}
+
+func TestRotateWriter(t *testing.T) {
+	dir := t.TempDir()
+	rw, err := openRotateWriter(FileOptions{Path: filepath.Join(dir, "ge2o.log"), MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+
+	for range 5 {
+		if _, err := rw.Write([]byte("12345678\n")); err != nil {
+			t.Fatal(err)
+		}
+		// 保证切割后的文件名不重复
+		time.Sleep(time.Millisecond * 2)
+	}
+	rw.cleanBackups()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 当前文件 + 最多 2 个切割文件
+	if len(entries) != 3 {
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("got files %v, want 3 files", names)
+	}
+}
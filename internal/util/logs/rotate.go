@@ -0,0 +1,159 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeLayout 切割后的日志文件名中的时间格式
+const backupTimeLayout = "20060102-150405.000"
+
+// FileOptions 日志文件输出配置
+type FileOptions struct {
+	Path       string        // 日志文件路径
+	MaxSize    int64         // 单个日志文件的最大大小 (Byte), 超出后进行切割, 小于等于 0 时不切割
+	MaxAge     time.Duration // 切割后的日志文件最长保留时间, 小于等于 0 时不限制
+	MaxBackups int           // 切割后的日志文件最多保留个数, 小于等于 0 时不限制
+}
+
+// equal 判断两个文件输出配置是否相同
+func (fo *FileOptions) equal(other *FileOptions) bool {
+	if fo == nil || other == nil {
+		return fo == other
+	}
+	return *fo == *other
+}
+
+// rotateWriter 按大小切割的日志文件
+//
+// 当前日志文件超出大小限制后, 重命名为 name-时间.ext, 再重新创建日志文件
+type rotateWriter struct {
+	opts FileOptions
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// openRotateWriter 打开日志文件, 文件不存在时自动创建
+func openRotateWriter(opts FileOptions) (*rotateWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(opts.Path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("创建日志目录失败: %v", err)
+	}
+	rw := &rotateWriter{opts: opts}
+	if err := rw.open(); err != nil {
+		return nil, err
+	}
+	rw.cleanBackups()
+	return rw, nil
+}
+
+// open 以追加模式打开日志文件
+func (rw *rotateWriter) open() error {
+	f, err := os.OpenFile(rw.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %v", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("读取日志文件信息失败: %v", err)
+	}
+	rw.file, rw.size = f, stat.Size()
+	return nil
+}
+
+func (rw *rotateWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.file == nil {
+		return 0, os.ErrClosed
+	}
+	if rw.opts.MaxSize > 0 && rw.size > 0 && rw.size+int64(len(p)) > rw.opts.MaxSize {
+		if err := rw.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rw.file.Write(p)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Close 关闭日志文件
+func (rw *rotateWriter) Close() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.file == nil {
+		return nil
+	}
+	err := rw.file.Close()
+	rw.file = nil
+	return err
+}
+
+// rotate 切割当前日志文件, 需要在持有锁的情况下调用
+func (rw *rotateWriter) rotate() error {
+	if err := rw.file.Close(); err != nil {
+		return fmt.Errorf("关闭日志文件失败: %v", err)
+	}
+	rw.file = nil
+
+	prefix, ext := rw.backupPattern()
+	backup := prefix + time.Now().Format(backupTimeLayout) + ext
+	if err := os.Rename(rw.opts.Path, backup); err != nil {
+		return fmt.Errorf("切割日志文件失败: %v", err)
+	}
+	if err := rw.open(); err != nil {
+		return err
+	}
+	go rw.cleanBackups()
+	return nil
+}
+
+// backupPattern 切割后的日志文件名前缀和后缀
+func (rw *rotateWriter) backupPattern() (prefix, ext string) {
+	ext = filepath.Ext(rw.opts.Path)
+	return strings.TrimSuffix(rw.opts.Path, ext) + "-", ext
+}
+
+// cleanBackups 清理超出保留时间或保留个数的日志文件
+func (rw *rotateWriter) cleanBackups() {
+	if rw.opts.MaxAge <= 0 && rw.opts.MaxBackups <= 0 {
+		return
+	}
+
+	prefix, ext := rw.backupPattern()
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return
+	}
+
+	// 文件名中带有时间, 字典序即为时间顺序
+	backups := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ts := strings.TrimSuffix(strings.TrimPrefix(m, prefix), ext)
+		if _, err := time.Parse(backupTimeLayout, ts); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	slices.Sort(backups)
+	slices.Reverse(backups)
+
+	for i, b := range backups {
+		remove := rw.opts.MaxBackups > 0 && i >= rw.opts.MaxBackups
+		if !remove && rw.opts.MaxAge > 0 {
+			if stat, err := os.Stat(b); err == nil && time.Since(stat.ModTime()) > rw.opts.MaxAge {
+				remove = true
+			}
+		}
+		if remove {
+			os.Remove(b)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package maps
+
+import (
+	"sync"
+	"time"
+)
+
+// Expiring 并发安全的 map, 每个值都有过期时间, 并且限制最大数量
+//
+// 数量达到上限时, 先清理已过期的值, 仍然超出时淘汰最早过期的值
+type Expiring[K comparable, V any] struct {
+	mu      sync.Mutex
+	max     int
+	entries map[K]expiringEntry[V]
+}
+
+// expiringEntry Expiring 中存放的值
+type expiringEntry[V any] struct {
+	value    V
+	expireAt time.Time
+}
+
+// NewExpiring 创建一个最多存放 max 个值的 Expiring
+func NewExpiring[K comparable, V any](max int) *Expiring[K, V] {
+	return &Expiring[K, V]{max: max, entries: make(map[K]expiringEntry[V])}
+}
+
+// Load 获取未过期的值
+func (m *Expiring[K, V]) Load(key K) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.load(key)
+}
+
+// LoadAndDelete 获取未过期的值, 并将其移除
+func (m *Expiring[K, V]) LoadAndDelete(key K) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.load(key)
+	delete(m.entries, key)
+	return value, ok
+}
+
+// LoadOrStore 获取未过期的值, 不存在时存入 value, 有效期为 ttl
+//
+// 返回值为 true 时表示获取到了已经存在的值
+func (m *Expiring[K, V]) LoadOrStore(key K, value V, ttl time.Duration) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := m.load(key); ok {
+		return old, true
+	}
+	m.store(key, value, ttl)
+	return value, false
+}
+
+// Store 存入 value, 有效期为 ttl
+func (m *Expiring[K, V]) Store(key K, value V, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store(key, value, ttl)
+}
+
+// Clear 移除所有的值
+func (m *Expiring[K, V]) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.entries)
+}
+
+// Len 当前存放的值的数量, 包含已过期但还未被清理的值
+func (m *Expiring[K, V]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// load 获取未过期的值, 已过期的值会被移除, 调用方需要持有锁
+func (m *Expiring[K, V]) load(key K) (V, bool) {
+	e, ok := m.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	if time.Now().After(e.expireAt) {
+		delete(m.entries, key)
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// store 存入值, 数量达到上限时进行淘汰, 调用方需要持有锁
+func (m *Expiring[K, V]) store(key K, value V, ttl time.Duration) {
+	if _, ok := m.entries[key]; !ok && m.max > 0 && len(m.entries) >= m.max {
+		now := time.Now()
+		var oldestKey K
+		var oldest time.Time
+		for k, e := range m.entries {
+			if now.After(e.expireAt) {
+				delete(m.entries, k)
+				continue
+			}
+			if oldest.IsZero() || e.expireAt.Before(oldest) {
+				oldestKey, oldest = k, e.expireAt
+			}
+		}
+		if len(m.entries) >= m.max {
+			delete(m.entries, oldestKey)
+		}
+	}
+	m.entries[key] = expiringEntry[V]{value: value, expireAt: time.Now().Add(ttl)}
+}
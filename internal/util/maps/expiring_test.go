@@ -0,0 +1,47 @@
+package maps_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/maps"
+)
+
+func TestExpiring(t *testing.T) {
+	m := maps.NewExpiring[string, int](2)
+	m.Store("expired", 0, -time.Second)
+	m.Store("a", 1, time.Minute)
+	m.Store("b", 2, time.Minute*2)
+	m.Store("c", 3, time.Minute*3)
+
+	tests := []struct {
+		key  string
+		want int
+		ok   bool
+	}{
+		{key: "expired", ok: false},
+		{key: "a", ok: false}, // 数量达到上限, 淘汰最早过期的值
+		{key: "b", want: 2, ok: true},
+		{key: "c", want: 3, ok: true},
+	}
+	for _, tt := range tests {
+		if got, ok := m.Load(tt.key); ok != tt.ok || got != tt.want {
+			t.Errorf("Load(%s) = %d, %v, want: %d, %v", tt.key, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if v, loaded := m.LoadOrStore("b", 20, time.Minute); !loaded || v != 2 {
+		t.Errorf("LoadOrStore(b) = %d, %v", v, loaded)
+	}
+	if v, ok := m.LoadAndDelete("b"); !ok || v != 2 {
+		t.Errorf("LoadAndDelete(b) = %d, %v", v, ok)
+	}
+	if _, ok := m.Load("b"); ok {
+		t.Error("LoadAndDelete 之后不应该还能获取到值")
+	}
+
+	m.Clear()
+	if m.Len() != 0 {
+		t.Errorf("Clear 之后数量应为 0, 实际: %d", m.Len())
+	}
+}
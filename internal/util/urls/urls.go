@@ -1,14 +1,17 @@
 package urls
 
 import (
-	"log"
 	"net/url"
 	"path/filepath"
 	"strings"
 
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
 )
 
+// logger urls 模块日志记录器
+var logger = logs.Module("urls")
+
 // IsRemote 检查一个地址是否是远程地址
 func IsRemote(path string) bool {
 	u, err := url.Parse(path)
@@ -69,7 +72,7 @@ func AppendArgs(rawUrl string, kvs ...string) string {
 
 	u, err := url.Parse(rawUrl)
 	if err != nil {
-		log.Printf("AppendUrlArgs 转换 rawUrl 时出现异常: %v", err)
+		logger.Warnf("AppendUrlArgs 转换 rawUrl 时出现异常: %v", err)
 		return rawUrl
 	}
 
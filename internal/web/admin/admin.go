@@ -0,0 +1,176 @@
+// 管理接口, 用于查看和清理程序内部维护的缓存
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/m3u8"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logger admin 模块日志记录器
+var logger = logs.Module("admin")
+
+const (
+	// RoutePrefix 管理接口路由前缀
+	RoutePrefix = "/ge2o/admin"
+
+	// HeaderKeyToken 传递管理接口密钥的请求头
+	HeaderKeyToken = "X-Admin-Token"
+
+	// QueryKeyToken 传递管理接口密钥的 query 参数
+	QueryKeyToken = "token"
+)
+
+// handlers 管理接口路由表, key 的格式为: "请求方法 子路径"
+var handlers = map[string]gin.HandlerFunc{
+	http.MethodGet + " /cache":        listCache,
+	http.MethodDelete + " /cache":     purgeCache,
+	http.MethodGet + " /cache/spaces": listSpaces,
+	http.MethodGet + " /playlists":    listPlaylists,
+	http.MethodDelete + " /playlists": removePlaylists,
+	http.MethodGet + " /openlist":     listOpenlistBackends,
+}
+
+// Handle 管理接口统一入口
+func Handle(c *gin.Context) {
+	if !config.C().Admin.Enable {
+		c.String(http.StatusNotFound, "管理接口未启用")
+		return
+	}
+
+	if !checkToken(c) {
+		logger.Warnf("管理接口鉴权失败, ip: %s, uri: %s", c.ClientIP(), c.Request.URL.Path)
+		c.String(http.StatusUnauthorized, "无效的管理接口密钥")
+		return
+	}
+
+	subPath := strings.TrimPrefix(strings.ToLower(c.Request.URL.Path), RoutePrefix)
+	subPath = strings.TrimSuffix(subPath, "/")
+	handler, ok := handlers[c.Request.Method+" "+subPath]
+	if !ok {
+		c.String(http.StatusNotFound, "不支持的管理接口: %s %s", c.Request.Method, c.Request.URL.Path)
+		return
+	}
+	handler(c)
+}
+
+// Authorized 判断请求是否携带了有效的管理接口密钥, 管理接口未启用时始终返回 false
+func Authorized(c *gin.Context) bool {
+	return config.C().Admin.Enable && checkToken(c)
+}
+
+// checkToken 校验客户端传递的管理接口密钥
+func checkToken(c *gin.Context) bool {
+	token := c.GetHeader(HeaderKeyToken)
+	if token == "" {
+		token = c.Query(QueryKeyToken)
+	}
+	want := config.C().Admin.Token
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// listCache 列出缓存条目
+//
+// 支持的 query 参数: key, space, item, 用于过滤缓存条目
+func listCache(c *gin.Context) {
+	stats, err := cache.GetStats()
+	if err != nil {
+		c.String(http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	filter, _ := entryFilter(c)
+	c.JSON(http.StatusOK, gin.H{
+		"stats":   stats,
+		"entries": cache.ListEntries(filter),
+	})
+}
+
+// purgeCache 清除缓存条目
+//
+// 支持的 query 参数: key, space, item, 多个参数同时传递时需同时满足;
+// 传递 all=true 时清除所有缓存
+func purgeCache(c *gin.Context) {
+	filter, ok := entryFilter(c)
+	if !ok && c.Query("all") != "true" {
+		c.String(http.StatusBadRequest, "请指定要清除的缓存 (key, space, item), 或者传递 all=true 清除所有缓存")
+		return
+	}
+
+	cnt, err := cache.Purge(filter)
+	if err != nil {
+		c.String(http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	logger.Infof("管理接口清除缓存 %d 条, query: %s", cnt, c.Request.URL.RawQuery)
+	c.JSON(http.StatusOK, gin.H{"purged": cnt})
+}
+
+// listSpaces 列出所有缓存空间
+func listSpaces(c *gin.Context) {
+	c.JSON(http.StatusOK, cache.ListSpaces())
+}
+
+// listPlaylists 列出内存中维护的 m3u8 播放列表
+func listPlaylists(c *gin.Context) {
+	c.JSON(http.StatusOK, m3u8.ListPlaylists())
+}
+
+// listOpenlistBackends 列出所有 openlist 后端的健康状态
+func listOpenlistBackends(c *gin.Context) {
+	c.JSON(http.StatusOK, openlist.BackendStatuses())
+}
+
+// removePlaylists 移除内存中维护的 m3u8 播放列表
+//
+// 支持的 query 参数: path (openlist 路径), template (转码模板 id);
+// 传递 all=true 时移除所有播放列表
+func removePlaylists(c *gin.Context) {
+	path, template := c.Query("path"), c.Query("template")
+	if path == "" && template == "" && c.Query("all") != "true" {
+		c.String(http.StatusBadRequest, "请指定要移除的播放列表 (path, template), 或者传递 all=true 移除所有播放列表")
+		return
+	}
+
+	cnt := m3u8.RemovePlaylists(func(pi m3u8.PlaylistInfo) bool {
+		return (path == "" || pi.OpenlistPath == path) && (template == "" || pi.TemplateId == template)
+	})
+	logger.Infof("管理接口移除播放列表 %d 个, query: %s", cnt, c.Request.URL.RawQuery)
+	c.JSON(http.StatusOK, gin.H{"removed": cnt})
+}
+
+// entryFilter 根据请求参数构造缓存条目过滤器
+//
+// 没有传递任何过滤参数时, 返回 nil, false
+func entryFilter(c *gin.Context) (func(cache.EntryInfo) bool, bool) {
+	key, space, item := c.Query("key"), c.Query("space"), c.Query("item")
+	if key == "" && space == "" && item == "" {
+		return nil, false
+	}
+
+	var itemReg *regexp.Regexp
+	if item != "" {
+		itemReg = regexp.MustCompile(`(?i)/(items|videos|audio|playeditems)/` + regexp.QuoteMeta(item) + `([/?]|$)`)
+	}
+
+	return func(ei cache.EntryInfo) bool {
+		if key != "" && ei.Key != key {
+			return false
+		}
+		if space != "" && ei.Space != space {
+			return false
+		}
+		if itemReg != nil && !itemReg.MatchString(ei.Uri) && !strings.HasPrefix(ei.SpaceKey, item+"_") {
+			return false
+		}
+		return true
+	}, true
+}
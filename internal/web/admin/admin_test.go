@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHandleAuth(t *testing.T) {
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+	config.Set(&config.Config{Admin: &config.Admin{Enable: true, Token: "secret"}})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Any("/*vars", Handle)
+
+	tests := []struct {
+		name   string
+		method string
+		uri    string
+		token  string
+		want   int
+	}{
+		{name: "no-token", method: http.MethodGet, uri: "/ge2o/admin/cache/spaces", want: http.StatusUnauthorized},
+		{name: "wrong-token", method: http.MethodGet, uri: "/ge2o/admin/cache/spaces", token: "wrong", want: http.StatusUnauthorized},
+		{name: "header-token", method: http.MethodGet, uri: "/ge2o/admin/cache/spaces", token: "secret", want: http.StatusOK},
+		{name: "query-token", method: http.MethodGet, uri: "/ge2o/admin/cache/spaces/?token=secret", want: http.StatusOK},
+		{name: "unknown-route", method: http.MethodGet, uri: "/ge2o/admin/unknown", token: "secret", want: http.StatusNotFound},
+		{name: "purge-without-filter", method: http.MethodDelete, uri: "/ge2o/admin/cache", token: "secret", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.uri, nil)
+			if tt.token != "" {
+				req.Header.Set(HeaderKeyToken, tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("code = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestEntryFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	entries := []cache.EntryInfo{
+		{Key: "1", Uri: "/emby/videos/123/stream.mkv?MediaSourceId=1"},
+		{Key: "2", Uri: "/emby/Items/123/PlaybackInfo", Space: "PlaybackInfo", SpaceKey: "123_apikey"},
+		{Key: "3", Uri: "/emby/videos/1234/stream.mkv"},
+		{Key: "4", Uri: "/emby/Items/456/PlaybackInfo", Space: "PlaybackInfo", SpaceKey: "456_apikey"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "item=123", want: []string{"1", "2"}},
+		{query: "space=PlaybackInfo", want: []string{"2", "4"}},
+		{query: "space=PlaybackInfo&item=456", want: []string{"4"}},
+		{query: "key=3", want: []string{"3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/ge2o/admin/cache?"+tt.query, nil)
+			filter, ok := entryFilter(c)
+			if !ok {
+				t.Fatal("entryFilter() should return a filter")
+			}
+			got := make([]string, 0)
+			for _, ei := range entries {
+				if filter(ei) {
+					got = append(got, ei.Key)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
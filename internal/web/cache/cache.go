@@ -2,23 +2,29 @@ package cache
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"log"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/constant"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/encrypts"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/urls"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 
 	"github.com/gin-gonic/gin"
 )
 
+// logger cache 模块日志记录器
+var logger = logs.Module("cache")
+
 // CacheKeyIgnoreParams 忽略的请求头或者参数
 //
 // 如果请求地址包含列表中的请求头或者参数, 则不参与 cacheKey 运算
@@ -44,8 +50,14 @@ var CacheKeyIgnoreParams = map[string]struct{}{
 	"Via": {}, "Forwarded-For": {}, "X-From-Cdn": {},
 }
 
+// RuleGinKey 命中缓存规则时, 会将规则存放到 Gin 上下文
+const RuleGinKey = "cacheRule"
+
 // CacheableRouteMarker 缓存白名单
 // 只有匹配上正则表达式的路由才会被缓存
+//
+// 优先使用配置中的缓存规则 (cache.rules) 进行匹配,
+// 未命中任何规则时, 再使用内置的白名单进行匹配
 func CacheableRouteMarker() gin.HandlerFunc {
 	cacheablePatterns := []*regexp.Regexp{
 		regexp.MustCompile(constant.Reg_PlaybackInfo),
@@ -57,6 +69,15 @@ func CacheableRouteMarker() gin.HandlerFunc {
 	}
 
 	return func(c *gin.Context) {
+		if rule, ok := config.C().Cache.MatchRule(c.Request.RequestURI); ok {
+			if !rule.Enabled() {
+				c.Header(HeaderKeyExpired, "-1")
+				return
+			}
+			c.Set(RuleGinKey, rule)
+			return
+		}
+
 		for _, pattern := range cacheablePatterns {
 			if pattern.MatchString(c.Request.RequestURI) {
 				return
@@ -66,6 +87,19 @@ func CacheableRouteMarker() gin.HandlerFunc {
 	}
 }
 
+// ruleExpired 如果请求命中了配置了过期时间的缓存规则, 则返回规则的缓存时间
+func ruleExpired(c *gin.Context) (string, bool) {
+	v, ok := c.Get(RuleGinKey)
+	if !ok {
+		return "", false
+	}
+	rule := v.(*config.CacheRule)
+	if rule.ExpiredDuration() <= 0 {
+		return "", false
+	}
+	return Duration(rule.ExpiredDuration()), true
+}
+
 // RequestCacher 请求缓存中间件
 func RequestCacher() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -77,51 +111,148 @@ func RequestCacher() gin.HandlerFunc {
 		// 2 计算 cache key
 		cacheKey, err := calcCacheKey(c)
 		if err != nil {
-			log.Printf("cache key 计算异常: %v, 跳过缓存", err)
+			logger.Errorf("cache key 计算异常: %v, 跳过缓存", err)
 			// 如果没有调用 Abort, Gin 会自动继续调用处理器链
 			return
 		}
 
 		// 3 尝试获取缓存
 		if rc, ok := getCache(cacheKey); ok {
-			if https.IsRedirectCode(rc.code) {
-				// 适配重定向请求
-				c.Redirect(rc.code, rc.header.header.Get("Location"))
-			} else {
-				c.Status(rc.code)
-				https.CloneHeader(c.Writer, rc.header.header)
-				c.Writer.Write(rc.body)
-			}
+			cacheRequests.Inc("hit")
+			writeCache(c, rc)
 			c.Abort()
 			return
 		}
 
-		// 4 使用自定义的响应器
-		customWriter := &respCacheWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-		c.Writer = customWriter
-
-		// 5 执行请求处理器
-		c.Next()
+		// 4 Range 请求通常是媒体流, 耗时较长, 不参与合并
+		if c.Request.Header.Get("Range") != "" {
+			cacheRequests.Inc("miss")
+			handleAndCache(c, cacheKey, nil)
+			return
+		}
 
-		// 6 不缓存错误请求
-		if https.IsErrorStatus(c.Writer.Status()) {
+		// 5 合并相同 cacheKey 的并发请求, 只有一个请求会执行处理器, 其余请求等待并复用其响应
+		p, leader := joinPending(cacheKey)
+		if leader {
+			// 处理器 panic 时也需要结束等待
+			defer p.release(cacheKey, nil)
+			cacheRequests.Inc("miss")
+			p.release(cacheKey, handleAndCache(c, cacheKey, func() { p.release(cacheKey, nil) }))
 			return
 		}
 
-		// 7 刷新缓存
-		header := c.Writer.Header()
-		respHeader := respHeader{
-			expired:  header.Get(HeaderKeyExpired),
-			space:    header.Get(HeaderKeySpace),
-			spaceKey: header.Get(HeaderKeySpaceKey),
-			header:   header.Clone(),
+		select {
+		case <-p.done:
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return
 		}
-		defer header.Del(HeaderKeyExpired)
-		defer header.Del(HeaderKeySpace)
-		defer header.Del(HeaderKeySpaceKey)
+		if p.rc != nil {
+			cacheRequests.Inc("coalesced")
+			logger.Debugf("复用并发请求的响应, cacheKey: %s", cacheKey)
+			writeCache(c, p.rc)
+			c.Abort()
+			return
+		}
+
+		// 响应不可缓存, 自行执行处理器
+		cacheRequests.Inc("miss")
+		handleAndCache(c, cacheKey, nil)
+	}
+}
+
+// pendingRequest 正在执行处理器的请求, 相同 cacheKey 的并发请求等待其响应
+type pendingRequest struct {
+	once sync.Once
+	done chan struct{} // 响应可以复用或者确定不可复用时关闭
+	rc   *respCache    // 可以复用的响应, 为 nil 时等待的请求需要自行执行处理器
+}
 
-		go putCache(cacheKey, c, customWriter.body, respHeader)
+var (
+	// pendingRequests 正在执行处理器的请求, key 为 cacheKey
+	pendingRequests = make(map[string]*pendingRequest)
+
+	// pendingMu 保护 pendingRequests
+	pendingMu sync.Mutex
+)
+
+// joinPending 获取 cacheKey 对应的正在执行的请求, 不存在时创建一个, 并返回 true 表示当前请求负责执行处理器
+func joinPending(cacheKey string) (*pendingRequest, bool) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	if p, ok := pendingRequests[cacheKey]; ok {
+		return p, false
+	}
+	p := &pendingRequest{done: make(chan struct{})}
+	pendingRequests[cacheKey] = p
+	return p, true
+}
+
+// release 结束等待, 只有第一次调用生效
+//
+// 处理器开始传输不可缓存的响应 (如代理的媒体流) 时就会提前调用, 等待的请求无需等到传输结束
+func (p *pendingRequest) release(cacheKey string, rc *respCache) {
+	p.once.Do(func() {
+		pendingMu.Lock()
+		delete(pendingRequests, cacheKey)
+		pendingMu.Unlock()
+		p.rc = rc
+		close(p.done)
+	})
+}
+
+// writeCache 将缓存的响应写回客户端
+func writeCache(c *gin.Context, rc *respCache) {
+	if https.IsRedirectCode(rc.Code()) {
+		// 适配重定向请求
+		c.Redirect(rc.Code(), rc.Header("Location"))
+		return
+	}
+	c.Status(rc.Code())
+	https.CloneHeader(c.Writer, rc.Headers())
+	c.Writer.Write(rc.BodyBytes())
+}
+
+// handleAndCache 执行请求处理器, 并将响应结果放入缓存
+//
+// 响应可以缓存时, 返回缓存对象, 否则返回 nil;
+// onSkip 在处理器开始写入不可缓存的响应时回调, 可以为 nil
+func handleAndCache(c *gin.Context, cacheKey string, onSkip func()) *respCache {
+	// 1 使用自定义的响应器
+	customWriter := &respCacheWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer, limit: MaxCacheSize(), onSkip: onSkip}
+	c.Writer = customWriter
+
+	// 2 执行请求处理器
+	c.Next()
+
+	// 3 不缓存错误请求以及写入过程中确定不可缓存的响应
+	if https.IsErrorStatus(c.Writer.Status()) || customWriter.skipped {
+		return nil
 	}
+
+	// 4 刷新缓存
+	header := c.Writer.Header()
+
+	// 使用缓存规则覆盖接口默认的缓存时间, 接口标记为不缓存时不覆盖
+	if expired, ok := ruleExpired(c); ok && header.Get(HeaderKeyExpired) != "-1" {
+		header.Set(HeaderKeyExpired, expired)
+	}
+	respHeader := respHeader{
+		expired:  header.Get(HeaderKeyExpired),
+		space:    header.Get(HeaderKeySpace),
+		spaceKey: header.Get(HeaderKeySpaceKey),
+		header:   header.Clone(),
+	}
+	defer header.Del(HeaderKeyExpired)
+	defer header.Del(HeaderKeySpace)
+	defer header.Del(HeaderKeySpaceKey)
+
+	rc := newRespCache(cacheKey, c.Request.URL.String(), c.Writer.Status(), customWriter.body.Bytes(), respHeader)
+	if rc == nil {
+		return nil
+	}
+	go putCache(rc)
+	return rc
 }
 
 // Duration 将一个标准的时间转换成适用于缓存时间的字符串
@@ -135,6 +266,24 @@ func WaitingForHandleChan() {
 	cacheHandleWaitGroup.Wait()
 }
 
+// Flush 等待预缓存通道处理完毕, 超出 ctx 期限时返回错误
+//
+// 磁盘存储在写入缓存时会同步落盘, 通道处理完毕即表示缓存已持久化
+func Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		WaitingForHandleChan()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("等待预缓存通道处理超时: %v", ctx.Err())
+	}
+}
+
 // calcCacheKey 计算缓存 key
 //
 // 计算方式: 取出 请求方法, 请求路径, 请求体, 请求头 转换成字符串之后字典排序,
@@ -172,7 +321,7 @@ func calcCacheKey(c *gin.Context) (string, error) {
 	headerStr := header.String()
 	preEnc := strs.Sort(c.Request.URL.RawQuery + body + headerStr)
 	if headerStr != "" {
-		log.Println("headers to encode cacheKey: ", colors.ToYellow(headerStr))
+		logger.Debugf("headers to encode cacheKey: %s", headerStr)
 	}
 
 	// 为防止字典排序后, 不同的 uri 冲突, 这里在排序完的字符串前再加上原始的 uri
@@ -182,6 +331,7 @@ func calcCacheKey(c *gin.Context) (string, error) {
 		c.Request.URL.RawQuery, "",
 	)
 
-	hash := encrypts.Md5Hash(method + uriNoArgs + preEnc)
+	// 不同上游服务器的相同请求, 响应不能共用
+	hash := encrypts.Md5Hash(upstream.Of(c).Name + method + uriNoArgs + preEnc)
 	return hash, nil
 }
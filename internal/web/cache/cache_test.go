@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestCacherCoalescing(t *testing.T) {
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+	config.Set(&config.Config{Cache: &config.Cache{Enable: true}})
+	if err := config.C().Cache.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	var calls atomic.Int32
+	r := gin.New()
+	r.Use(RequestCacher())
+	r.GET("/cacheable", func(c *gin.Context) {
+		calls.Add(1)
+		time.Sleep(time.Millisecond * 200)
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/stream", func(c *gin.Context) {
+		calls.Add(1)
+		c.Header(HeaderKeyExpired, "-1")
+		c.String(http.StatusOK, "chunk")
+		time.Sleep(time.Millisecond * 500)
+	})
+	r.GET("/error", func(c *gin.Context) {
+		calls.Add(1)
+		time.Sleep(time.Millisecond * 200)
+		c.String(http.StatusInternalServerError, "error")
+	})
+
+	request := func(uri string, n int) []*httptest.ResponseRecorder {
+		var wg sync.WaitGroup
+		recorders := make([]*httptest.ResponseRecorder, n)
+		for i := range n {
+			recorders[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.ServeHTTP(recorders[i], httptest.NewRequest(http.MethodGet, uri, nil))
+			}()
+		}
+		wg.Wait()
+		return recorders
+	}
+
+	for _, w := range request("/cacheable", 5) {
+		if w.Code != http.StatusOK || w.Body.String() != "ok" {
+			t.Errorf("unexpected response: %d, %s", w.Code, w.Body.String())
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("并发的相同请求应只执行一次处理器, 实际执行 %d 次", got)
+	}
+
+	// 不可缓存的流式响应开始传输后, 等待的请求立即自行执行处理器, 不需要等待传输结束
+	calls.Store(0)
+	start := time.Now()
+	for _, w := range request("/stream", 3) {
+		if w.Code != http.StatusOK || w.Body.String() != "chunk" {
+			t.Errorf("unexpected response: %d, %s", w.Code, w.Body.String())
+		}
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("流式响应不应被共享, 实际执行 %d 次", got)
+	}
+	if cost := time.Since(start); cost > time.Millisecond*900 {
+		t.Errorf("等待的请求不应等到流式响应传输结束, 耗时: %v", cost)
+	}
+
+	// 错误响应不共享, 每个请求各自执行处理器
+	calls.Store(0)
+	for _, w := range request("/error", 3) {
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("unexpected response code: %d", w.Code)
+		}
+	}
+	if got := calls.Load(); got < 2 {
+		t.Errorf("错误响应不应被共享, 实际执行 %d 次", got)
+	}
+}
@@ -1,133 +1,227 @@
 package cache
 
 import (
-	"bytes"
-	"log"
+	"cmp"
+	"fmt"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/strs"
-
-	"github.com/gin-gonic/gin"
 )
 
 const (
 
-	// MaxCacheSize 缓存最大大小 (Byte)
-	//
-	// 这里的大小指的是响应体大小, 实际占用大小可能略大一些
-	MaxCacheSize int64 = 100 * 1024 * 1024
-
-	// MaxCacheNum 最多缓存多少个请求信息
-	MaxCacheNum = 8092
+	// PreCacheChanSize 预缓存通道大小
+	PreCacheChanSize = 8092
 
 	// HeaderKeyExpired 缓存过期响应头, 用于覆盖默认的缓存过期时间
 	HeaderKeyExpired = "Expired"
 )
 
 // currentCacheSize 当前内存中的缓存大小 (Byte)
+//
+// 这里的大小指的是响应体大小, 实际占用大小可能略大一些
 var currentCacheSize int64 = 0
 
+// currentCacheNum 当前缓存的请求数量
+var currentCacheNum = 0
+
+// MaxCacheSize 缓存最大大小 (Byte)
+var MaxCacheSize = func() int64 { return config.C().Cache.MaxSizeBytes() }
+
+// MaxCacheNum 最多缓存多少个请求信息
+var MaxCacheNum = func() int { return config.C().Cache.MaxEntries }
+
 // DefaultExpired 默认的请求过期时间
 //
 // 可通过设置 "Expired" 响应头进行覆盖
-var DefaultExpired = func() time.Duration { return config.C.Cache.ExpiredDuration() }
-
-// cacheMap 存放缓存数据的 map
-var cacheMap = sync.Map{}
+var DefaultExpired = func() time.Duration { return config.C().Cache.ExpiredDuration() }
 
 // preCacheChan 预缓存通道
 //
 // 缓存数据先暂存在通道中, 再由专门的 goroutine 单线程处理
 //
 // preCacheChan 的淘汰规则是先入先淘汰, 不管缓存对象的过期时间
-var preCacheChan = make(chan *respCache, MaxCacheNum)
+var preCacheChan = make(chan *respCache, PreCacheChanSize)
 
 // cacheHandleWaitGroup 允许等待预缓存通道处理完毕后再获取数据
 var cacheHandleWaitGroup = sync.WaitGroup{}
 
-func init() {
-	go loopMaintainCache()
-}
+// initOnce 确保缓存只初始化一次
+var initOnce sync.Once
 
-// loopMaintainCache cacheMap 由单独的 goroutine 维护
-func loopMaintainCache() {
+// started 标记缓存维护协程是否已经启动
+var started atomic.Bool
 
-	// cleanCache 清洗缓存数据
-	cleanCache := func() {
-		validCnt := 0
-		nowMillis := time.Now().UnixMilli()
-		toDelete := make([]*respCache, 0)
-
-		cacheMap.Range(func(key, value any) bool {
-			rc := value.(*respCache)
-			if nowMillis > rc.expired || validCnt == MaxCacheNum || currentCacheSize > MaxCacheSize {
-				toDelete = append(toDelete, rc)
-			} else {
-				validCnt++
-			}
-			return true
-		})
+// maintainOpChan 需要在缓存维护协程中执行的操作
+//
+// 外界对缓存的修改操作统一放到维护协程中执行, 确保缓存计数准确
+var maintainOpChan = make(chan func())
 
-		for _, rc := range toDelete {
-			cacheMap.Delete(rc.cacheKey)
-			currentCacheSize -= int64(len(rc.body))
-			delSpaceCache(rc.header.space, rc.header.spaceKey)
+// Init 初始化缓存存储后端, 并启动缓存维护协程
+//
+// 使用磁盘存储时, 会将上次运行时持久化的缓存重新加载到内存中
+func Init() (err error) {
+	initOnce.Do(func() {
+		if err = initStorage(config.C().Cache); err != nil {
+			err = fmt.Errorf("初始化缓存存储失败: %v", err)
+			return
 		}
-	}
+		restoreCache()
+		go loopMaintainCache()
+		started.Store(true)
+	})
+	return
+}
 
-	// putrespCache 将缓存对象维护到 cacheMap 中
-	//
-	// 同时淘汰掉过期缓存
-	putrespCache := func(rc *respCache) {
-		cacheMap.Store(rc.cacheKey, rc)
-		currentCacheSize += int64(len(rc.body))
-		space, spaceKey := rc.header.space, rc.header.spaceKey
-		if strs.AllNotEmpty(space, spaceKey) {
-			putSpaceCache(space, spaceKey, rc)
-			log.Printf(colors.ToGreen("刷新缓存空间, space: %s, spaceKey: %s"), space, spaceKey)
+// restoreCache 恢复存储后端中已有的缓存
+//
+// 过期缓存直接删除, 有效缓存重新计算缓存大小以及维护缓存空间
+func restoreCache() {
+	nowMillis := time.Now().UnixMilli()
+	toDelete := make([]string, 0)
+	validCnt := 0
+	store.Range(func(rc *respCache) bool {
+		if nowMillis > rc.expired {
+			toDelete = append(toDelete, rc.cacheKey)
+			return true
 		}
+		validCnt++
+		currentCacheNum++
+		currentCacheSize += rc.Size()
+		rc.touch()
+		putSpaceCache(rc.header.space, rc.header.spaceKey, rc)
+		return true
+	})
+	for _, key := range toDelete {
+		store.Delete(key)
+	}
+	updateCacheGauges()
+	if validCnt > 0 {
+		logger.Infof("已恢复 %d 条缓存, 清理过期缓存 %d 条", validCnt, len(toDelete))
 	}
+}
 
+// loopMaintainCache 缓存由单独的 goroutine 维护
+func loopMaintainCache() {
 	timer := time.NewTicker(time.Second * 10)
 	defer timer.Stop()
 	for {
 		select {
 		case rc := <-preCacheChan:
-			putrespCache(rc)
+			putRespCache(rc)
+			if currentCacheNum > MaxCacheNum() || currentCacheSize > MaxCacheSize() {
+				cleanCache()
+			}
 			cacheHandleWaitGroup.Done()
+		case op := <-maintainOpChan:
+			op()
 		case <-timer.C:
 			cleanCache()
 		}
 	}
 }
 
+// putRespCache 将缓存对象维护到存储后端中
+func putRespCache(rc *respCache) {
+	if old, ok := store.Load(rc.cacheKey); ok {
+		removeRespCache(old, evictReasonReplace)
+	}
+	rc.touch()
+	store.Store(rc)
+	currentCacheNum++
+	currentCacheSize += rc.Size()
+	space, spaceKey := rc.header.space, rc.header.spaceKey
+	if strs.AllNotEmpty(space, spaceKey) {
+		putSpaceCache(space, spaceKey, rc)
+		logger.Infof("刷新缓存空间, space: %s, spaceKey: %s", space, spaceKey)
+	}
+	updateCacheGauges()
+}
+
+// removeRespCache 从存储后端以及缓存空间中移除缓存对象
+func removeRespCache(rc *respCache, reason string) {
+	store.Delete(rc.cacheKey)
+	currentCacheNum--
+	currentCacheSize -= rc.Size()
+	delSpaceCache(rc.header.space, rc.header.spaceKey, rc)
+	cacheEvictions.Inc(reason)
+}
+
+// cleanCache 清洗缓存数据
+//
+// 先淘汰掉所有过期缓存, 如果缓存数量或大小仍超出限制,
+// 再按照最近访问时间从旧到新依次淘汰 (LRU)
+func cleanCache() {
+	defer updateCacheGauges()
+	nowMillis := time.Now().UnixMilli()
+	valid := make([]*respCache, 0)
+	var validSize int64
+
+	store.Range(func(rc *respCache) bool {
+		if nowMillis > rc.expired {
+			removeRespCache(rc, evictReasonExpired)
+			return true
+		}
+		valid = append(valid, rc)
+		validSize += rc.Size()
+		return true
+	})
+
+	// 重新校准计数, 避免缓存被更新后统计出现偏差
+	currentCacheNum, currentCacheSize = len(valid), validSize
+
+	maxNum, maxSize := MaxCacheNum(), MaxCacheSize()
+	if currentCacheNum <= maxNum && currentCacheSize <= maxSize {
+		return
+	}
+
+	slices.SortFunc(valid, func(a, b *respCache) int {
+		return cmp.Compare(a.lastAccess.Load(), b.lastAccess.Load())
+	})
+	evictCnt := 0
+	for _, rc := range valid {
+		if currentCacheNum <= maxNum && currentCacheSize <= maxSize {
+			break
+		}
+		removeRespCache(rc, evictReasonLRU)
+		evictCnt++
+	}
+	logger.Warnf("缓存超出限制, 已淘汰最久未访问的缓存 %d 条", evictCnt)
+}
+
 // getCache 根据 cacheKey 获取缓存
+//
+// 命中缓存时会刷新缓存的最近访问时间
 func getCache(cacheKey string) (*respCache, bool) {
-	if c, ok := cacheMap.Load(cacheKey); ok {
-		return c.(*respCache), true
+	rc, ok := store.Load(cacheKey)
+	if ok {
+		rc.touch()
 	}
-	return nil, false
+	return rc, ok
 }
 
-// putCache 设置缓存
-func putCache(cacheKey string, c *gin.Context, respBody *bytes.Buffer, respHeader respHeader) {
-	if cacheKey == "" || c == nil || respBody == nil {
-		return
+// newRespCache 根据响应信息构造缓存对象
+//
+// 响应被标记为不缓存时, 返回 nil
+func newRespCache(cacheKey, uri string, code int, respBody []byte, respHeader respHeader) *respCache {
+	if cacheKey == "" || respBody == nil {
+		return nil
 	}
 
 	// 计算缓存过期时间
 	nowMillis := time.Now().UnixMilli()
-	expiredMillis := int64(DefaultExpired()) + nowMillis
+	expiredMillis := DefaultExpired().Milliseconds() + nowMillis
 	if expiredNum, err := strconv.Atoi(respHeader.expired); err == nil {
 		customMillis := int64(expiredNum)
 
 		// 特定接口不使用缓存
 		if customMillis < 0 {
-			return
+			return nil
 		}
 
 		if customMillis > nowMillis {
@@ -135,13 +229,21 @@ func putCache(cacheKey string, c *gin.Context, respBody *bytes.Buffer, respHeade
 		}
 	}
 
-	rc := &respCache{
-		code:     c.Writer.Status(),
-		body:     respBody.Bytes(),
+	return &respCache{
+		code:     code,
+		body:     respBody,
 		cacheKey: cacheKey,
+		uri:      uri,
 		expired:  expiredMillis,
 		header:   respHeader,
 	}
+}
+
+// putCache 设置缓存
+func putCache(rc *respCache) {
+	if rc == nil {
+		return
+	}
 
 	// 依据先进先淘汰原则, 将最新缓存放入预缓存通道中
 	cacheHandleWaitGroup.Add(1)
@@ -151,7 +253,7 @@ func putCache(cacheKey string, c *gin.Context, respBody *bytes.Buffer, respHeade
 		case preCacheChan <- rc:
 			return
 		default:
-			log.Println("预缓存通道已满, 淘汰旧缓存")
+			logger.Warn("预缓存通道已满, 淘汰旧缓存")
 			<-preCacheChan
 			doneOnce()
 		}
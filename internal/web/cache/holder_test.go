@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCleanCacheLRU(t *testing.T) {
+	originStore, originNum, originSize := store, MaxCacheNum, MaxCacheSize
+	defer func() {
+		store, MaxCacheNum, MaxCacheSize = originStore, originNum, originSize
+		currentCacheNum, currentCacheSize = 0, 0
+	}()
+	store = newMemoryStorage()
+	MaxCacheNum = func() int { return 2 }
+	MaxCacheSize = func() int64 { return 1024 }
+
+	expired := time.Now().Add(time.Hour).UnixMilli()
+	for i, key := range []string{"a", "b", "c"} {
+		rc := &respCache{cacheKey: key, body: []byte(key), expired: expired}
+		putRespCache(rc)
+		rc.lastAccess.Store(int64(i + 1))
+	}
+	putRespCache(&respCache{cacheKey: "expired", expired: 1})
+
+	// 访问最早放入的缓存, 淘汰时应保留
+	rc, _ := getCache("a")
+	rc.lastAccess.Store(100)
+
+	cleanCache()
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "expired": false} {
+		if _, ok := store.Load(key); ok != want {
+			t.Errorf("key: %s, exist: %v, want: %v", key, ok, want)
+		}
+	}
+	if currentCacheNum != 2 || currentCacheSize != 2 {
+		t.Errorf("currentCacheNum: %d, currentCacheSize: %d", currentCacheNum, currentCacheSize)
+	}
+
+	// 超出大小限制时同样按照 LRU 淘汰
+	MaxCacheSize = func() int64 { return 1 }
+	cleanCache()
+	if _, ok := store.Load("c"); ok {
+		t.Error("超出大小限制时, 最久未访问的缓存未被淘汰")
+	}
+	if _, ok := store.Load("a"); !ok {
+		t.Error("最近访问的缓存被误淘汰")
+	}
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// ErrNotStarted 缓存功能未启用
+var ErrNotStarted = errors.New("缓存功能未启用")
+
+// EntryInfo 缓存条目的概要信息, 用于对外展示
+type EntryInfo struct {
+	Key        string `json:"key"`        // 缓存 key
+	Uri        string `json:"uri"`        // 原始请求地址
+	Code       int    `json:"code"`       // 响应码
+	Size       int    `json:"size"`       // 响应体大小 (Byte)
+	Expired    int64  `json:"expired"`    // 过期时间戳 UnixMilli
+	LastAccess int64  `json:"lastAccess"` // 最近访问时间戳 UnixMilli
+	Space      string `json:"space"`      // 缓存空间名称
+	SpaceKey   string `json:"spaceKey"`   // 缓存空间 key
+}
+
+// Stats 缓存整体统计信息
+type Stats struct {
+	Num     int   `json:"num"`     // 缓存条目数
+	Size    int64 `json:"size"`    // 缓存总大小 (Byte)
+	MaxNum  int   `json:"maxNum"`  // 最大缓存条目数
+	MaxSize int64 `json:"maxSize"` // 缓存最大大小 (Byte)
+}
+
+// entryInfo 获取缓存对象的概要信息
+func (c *respCache) entryInfo() EntryInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return EntryInfo{
+		Key:        c.cacheKey,
+		Uri:        c.uri,
+		Code:       c.code,
+		Size:       len(c.body),
+		Expired:    c.expired,
+		LastAccess: c.lastAccess.Load(),
+		Space:      c.header.space,
+		SpaceKey:   c.header.spaceKey,
+	}
+}
+
+// runInLoop 在缓存维护协程中执行操作, 并等待执行完毕
+func runInLoop(op func()) error {
+	if !started.Load() {
+		return ErrNotStarted
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	maintainOpChan <- func() {
+		defer wg.Done()
+		op()
+	}
+	wg.Wait()
+	return nil
+}
+
+// GetStats 获取缓存统计信息
+func GetStats() (Stats, error) {
+	var stats Stats
+	err := runInLoop(func() {
+		stats = Stats{
+			Num:     currentCacheNum,
+			Size:    currentCacheSize,
+			MaxNum:  MaxCacheNum(),
+			MaxSize: MaxCacheSize(),
+		}
+	})
+	return stats, err
+}
+
+// ListEntries 列出所有符合条件的缓存条目, 按照最近访问时间倒序排列
+//
+// filter 为 nil 时列出所有缓存条目
+func ListEntries(filter func(EntryInfo) bool) []EntryInfo {
+	res := make([]EntryInfo, 0)
+	store.Range(func(rc *respCache) bool {
+		info := rc.entryInfo()
+		if filter == nil || filter(info) {
+			res = append(res, info)
+		}
+		return true
+	})
+	slices.SortFunc(res, func(a, b EntryInfo) int {
+		return cmp.Compare(b.LastAccess, a.LastAccess)
+	})
+	return res
+}
+
+// ListSpaces 列出所有缓存空间及其中的 spaceKey
+func ListSpaces() map[string][]string {
+	res := make(map[string][]string)
+	spaceMap.Range(func(space, value any) bool {
+		keys := make([]string, 0)
+		value.(*sync.Map).Range(func(spaceKey, _ any) bool {
+			keys = append(keys, spaceKey.(string))
+			return true
+		})
+		slices.Sort(keys)
+		res[space.(string)] = keys
+		return true
+	})
+	return res
+}
+
+// Purge 清除所有符合条件的缓存条目, 返回清除的条目数
+//
+// filter 为 nil 时清除所有缓存
+func Purge(filter func(EntryInfo) bool) (int, error) {
+	cnt := 0
+	err := runInLoop(func() {
+		toDelete := make([]*respCache, 0)
+		store.Range(func(rc *respCache) bool {
+			if filter == nil || filter(rc.entryInfo()) {
+				toDelete = append(toDelete, rc)
+			}
+			return true
+		})
+		for _, rc := range toDelete {
+			removeRespCache(rc, evictReasonPurge)
+		}
+		cnt = len(toDelete)
+		updateCacheGauges()
+	})
+	return cnt, err
+}
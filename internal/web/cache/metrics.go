@@ -0,0 +1,31 @@
+package cache
+
+import "github.com/AmbitiousJun/go-emby2openlist/v2/internal/metrics"
+
+// 缓存淘汰原因
+const (
+	evictReasonExpired = "expired" // 缓存过期
+	evictReasonLRU     = "lru"     // 超出缓存限制, 按照 LRU 淘汰
+	evictReasonReplace = "replace" // 被相同 cacheKey 的新缓存替换
+	evictReasonPurge   = "purge"   // 手动清除
+)
+
+var (
+	// cacheRequests 缓存中间件的请求统计, result 取值: hit, miss, coalesced
+	cacheRequests = metrics.NewCounterVec("cache_requests_total", "缓存中间件处理的请求数", "result")
+
+	// cacheEvictions 缓存淘汰统计
+	cacheEvictions = metrics.NewCounterVec("cache_evictions_total", "被淘汰的缓存条目数", "reason")
+
+	// cacheBytes 当前缓存大小
+	cacheBytes = metrics.NewGaugeVec("cache_bytes", "当前缓存的响应体总大小 (Byte)")
+
+	// cacheEntries 当前缓存条目数
+	cacheEntries = metrics.NewGaugeVec("cache_entries", "当前缓存的条目数")
+)
+
+// updateCacheGauges 刷新缓存大小相关的指标
+func updateCacheGauges() {
+	cacheBytes.Set(float64(currentCacheSize))
+	cacheEntries.Set(float64(currentCacheNum))
+}
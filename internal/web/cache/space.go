@@ -43,11 +43,14 @@ func putSpaceCache(space, spaceKey string, cache *respCache) {
 	getSpace(space).Store(spaceKey, cache)
 }
 
-func delSpaceCache(space, spaceKey string) {
+// delSpaceCache 从缓存空间中移除指定的缓存
+//
+// 只有当缓存空间中存放的仍是 cache 时才移除, 避免误删已被刷新的新缓存
+func delSpaceCache(space, spaceKey string, cache *respCache) {
 	if strs.AnyEmpty(space, spaceKey) {
 		return
 	}
-	getSpace(space).Delete(spaceKey)
+	getSpace(space).CompareAndDelete(spaceKey, cache)
 }
 
 // getSpace 获取缓存空间
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+)
+
+// storage 缓存存储后端
+//
+// 缓存的读写统一经过该接口, 便于切换不同的存储实现
+type storage interface {
+	// Load 根据 cacheKey 获取缓存
+	Load(cacheKey string) (*respCache, bool)
+
+	// Store 存储缓存, 已存在相同 cacheKey 的缓存时进行覆盖
+	Store(rc *respCache)
+
+	// Delete 删除缓存
+	Delete(cacheKey string)
+
+	// Range 遍历所有缓存, fn 返回 false 时停止遍历
+	Range(fn func(rc *respCache) bool)
+}
+
+// store 当前使用的缓存存储后端, 默认存放在内存中
+var store storage = newMemoryStorage()
+
+// memoryStorage 内存存储, 程序重启后缓存丢失
+type memoryStorage struct {
+	m sync.Map
+}
+
+func newMemoryStorage() *memoryStorage {
+	return new(memoryStorage)
+}
+
+func (ms *memoryStorage) Load(cacheKey string) (*respCache, bool) {
+	if c, ok := ms.m.Load(cacheKey); ok {
+		return c.(*respCache), true
+	}
+	return nil, false
+}
+
+func (ms *memoryStorage) Store(rc *respCache) {
+	ms.m.Store(rc.cacheKey, rc)
+}
+
+func (ms *memoryStorage) Delete(cacheKey string) {
+	ms.m.Delete(cacheKey)
+}
+
+func (ms *memoryStorage) Range(fn func(rc *respCache) bool) {
+	ms.m.Range(func(key, value any) bool {
+		return fn(value.(*respCache))
+	})
+}
+
+// diskStorage 磁盘存储
+//
+// 读取时依旧从内存中获取, 写入时同步将缓存序列化到磁盘中,
+// 每个缓存对应目录下的一个 json 文件, 程序启动时再从磁盘加载回内存
+type diskStorage struct {
+	memoryStorage
+
+	// dir 缓存文件存放目录
+	dir string
+
+	// mu 控制文件写入
+	mu sync.Mutex
+}
+
+// diskCacheExt 磁盘缓存文件后缀
+const diskCacheExt = ".json"
+
+// diskCache 磁盘缓存的序列化结构
+type diskCache struct {
+	Code     int         `json:"code"`
+	Body     []byte      `json:"body"`
+	CacheKey string      `json:"cacheKey"`
+	Uri      string      `json:"uri"`
+	Expired  int64       `json:"expired"`
+	Space    string      `json:"space"`
+	SpaceKey string      `json:"spaceKey"`
+	Header   http.Header `json:"header"`
+}
+
+// newDiskStorage 初始化磁盘存储, 目录不存在时自动创建
+//
+// 缓存中包含 PlaybackInfo 等携带令牌和直链的响应, 目录和文件只允许当前用户访问
+func newDiskStorage(dir string) (*diskStorage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+	return &diskStorage{dir: dir}, nil
+}
+
+func (ds *diskStorage) Store(rc *respCache) {
+	ds.memoryStorage.Store(rc)
+	if err := ds.persist(rc); err != nil {
+		logger.Errorf("缓存写入磁盘失败, cacheKey: %s, err: %v", rc.cacheKey, err)
+	}
+}
+
+func (ds *diskStorage) Delete(cacheKey string) {
+	ds.memoryStorage.Delete(cacheKey)
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if err := os.Remove(ds.filePath(cacheKey)); err != nil && !os.IsNotExist(err) {
+		logger.Errorf("删除磁盘缓存失败, cacheKey: %s, err: %v", cacheKey, err)
+	}
+}
+
+// persist 将缓存序列化到磁盘中
+//
+// 先写入临时文件再重命名, 避免程序异常退出时留下不完整的缓存文件
+func (ds *diskStorage) persist(rc *respCache) error {
+	rc.mu.RLock()
+	dc := diskCache{
+		Code:     rc.code,
+		Body:     rc.body,
+		CacheKey: rc.cacheKey,
+		Uri:      rc.uri,
+		Expired:  rc.expired,
+		Space:    rc.header.space,
+		SpaceKey: rc.header.spaceKey,
+		Header:   rc.header.header,
+	}
+	bytes, err := json.Marshal(dc)
+	rc.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("序列化失败: %v", err)
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	// 缓存已经被删除, 不再写入
+	if cur, ok := ds.memoryStorage.Load(rc.cacheKey); !ok || cur != rc {
+		return nil
+	}
+
+	fp := ds.filePath(rc.cacheKey)
+	tmp := fp + ".tmp"
+	if err = os.WriteFile(tmp, bytes, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fp)
+}
+
+// loadAll 从磁盘中读取所有缓存到内存
+//
+// 无法解析的缓存文件会被直接删除
+func (ds *diskStorage) loadAll() error {
+	entries, err := os.ReadDir(ds.dir)
+	if err != nil {
+		return fmt.Errorf("读取缓存目录失败: %v", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		fp := filepath.Join(ds.dir, name)
+		if !strings.HasSuffix(name, diskCacheExt) {
+			// 清理上次异常退出残留的临时文件
+			if strings.HasSuffix(name, diskCacheExt+".tmp") {
+				os.Remove(fp)
+			}
+			continue
+		}
+
+		bytes, err := os.ReadFile(fp)
+		if err != nil {
+			logger.Errorf("读取磁盘缓存失败: %s, err: %v", name, err)
+			continue
+		}
+		var dc diskCache
+		if err := json.Unmarshal(bytes, &dc); err != nil || dc.CacheKey+diskCacheExt != name {
+			logger.Warnf("磁盘缓存文件已损坏, 自动删除: %s", name)
+			os.Remove(fp)
+			continue
+		}
+
+		ds.memoryStorage.Store(&respCache{
+			code:     dc.Code,
+			body:     dc.Body,
+			cacheKey: dc.CacheKey,
+			uri:      dc.Uri,
+			expired:  dc.Expired,
+			header: respHeader{
+				space:    dc.Space,
+				spaceKey: dc.SpaceKey,
+				header:   dc.Header,
+			},
+		})
+	}
+	return nil
+}
+
+// filePath 获取缓存文件路径
+func (ds *diskStorage) filePath(cacheKey string) string {
+	return filepath.Join(ds.dir, cacheKey+diskCacheExt)
+}
+
+// initStorage 根据配置初始化缓存存储后端
+func initStorage(c *config.Cache) error {
+	if c.Storage != config.CacheStorageDisk {
+		store = newMemoryStorage()
+		return nil
+	}
+
+	ds, err := newDiskStorage(c.DirPath())
+	if err != nil {
+		return err
+	}
+	if err = ds.loadAll(); err != nil {
+		return err
+	}
+	store = ds
+	logger.Infof("磁盘缓存已启用, 缓存目录: %s", ds.dir)
+	return nil
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskStorage(t *testing.T) {
+	dir := t.TempDir()
+	ds, err := newDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	rc := &respCache{
+		code:     http.StatusOK,
+		body:     []byte(`{"Id":"1"}`),
+		cacheKey: "test-key",
+		expired:  time.Now().Add(time.Hour).UnixMilli(),
+		header:   respHeader{space: "PlaybackInfo", spaceKey: "1", header: header},
+	}
+	ds.Store(rc)
+	ds.Store(&respCache{cacheKey: "deleted-key"})
+	ds.Delete("deleted-key")
+
+	// 模拟残留的损坏文件
+	os.WriteFile(filepath.Join(dir, "broken"+diskCacheExt), []byte("{"), os.ModePerm)
+
+	reload, err := newDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = reload.loadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := reload.Load(rc.cacheKey)
+	if !ok {
+		t.Fatal("缓存未从磁盘中恢复")
+	}
+	if got.code != rc.code || string(got.body) != string(rc.body) || got.expired != rc.expired {
+		t.Errorf("恢复的缓存不一致: %+v", got)
+	}
+	if got.header.space != "PlaybackInfo" || got.header.spaceKey != "1" {
+		t.Errorf("缓存空间信息丢失: %+v", got.header)
+	}
+	if got.Header("Content-Type") != "application/json" {
+		t.Errorf("响应头丢失: %v", got.header.header)
+	}
+	if _, ok := reload.Load("deleted-key"); ok {
+		t.Error("已删除的缓存被恢复")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "broken"+diskCacheExt)); !os.IsNotExist(err) {
+		t.Error("损坏的缓存文件未被清理")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/jsons"
 
@@ -14,10 +16,23 @@ import (
 type respCacheWriter struct {
 	gin.ResponseWriter               // gin 原始的响应器
 	body               *bytes.Buffer // gin 回写响应时, 同步缓存
+	limit              int64         // 最多暂存的响应体大小, 超出后响应不可缓存
+	skipped            bool          // 响应是否已确定不可缓存
+	onSkip             func()        // 响应确定不可缓存时回调, 可以为 nil
 }
 
 func (rcw *respCacheWriter) Write(b []byte) (int, error) {
-	rcw.body.Write(b)
+	// 处理器标记为不缓存的响应 (如代理传输的媒体流) 以及超出缓存大小限制的响应不需要暂存, 避免占用大量内存
+	if !rcw.skipped && (rcw.Header().Get(HeaderKeyExpired) == "-1" || int64(rcw.body.Len()+len(b)) > rcw.limit) {
+		rcw.skipped = true
+		rcw.body.Reset()
+		if rcw.onSkip != nil {
+			rcw.onSkip()
+		}
+	}
+	if !rcw.skipped {
+		rcw.body.Write(b)
+	}
 	return rcw.ResponseWriter.Write(b)
 }
 
@@ -33,12 +48,18 @@ type respCache struct {
 	// cacheKey 缓存 key
 	cacheKey string
 
+	// uri 原始请求地址, 便于排查问题
+	uri string
+
 	// expired 缓存过期时间戳 UnixMilli
 	expired int64
 
 	// header 响应头信息
 	header respHeader
 
+	// lastAccess 最近访问时间戳 UnixMilli, 用于 LRU 淘汰
+	lastAccess atomic.Int64
+
 	// mu 读写互斥控制
 	mu sync.RWMutex
 }
@@ -51,6 +72,11 @@ type respHeader struct {
 	header   http.Header // 原始请求的克隆请求头
 }
 
+// touch 刷新最近访问时间
+func (c *respCache) touch() {
+	c.lastAccess.Store(time.Now().UnixMilli())
+}
+
 // Code 响应码
 func (c *respCache) Code() int {
 	c.mu.RLock()
@@ -72,6 +98,13 @@ func (c *respCache) BodyBytes() []byte {
 	return append([]byte(nil), c.body...)
 }
 
+// Size 响应体大小, 不会克隆响应体
+func (c *respCache) Size() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return int64(len(c.body))
+}
+
 // JsonBody 将响应体转化成 json 返回
 func (c *respCache) JsonBody() (*jsons.Item, error) {
 	c.mu.RLock()
@@ -121,7 +154,6 @@ func (c *respCache) Update(code int, body []byte, header http.Header) {
 		return
 	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
 
 	if code != 0 {
 		c.code = code
@@ -135,4 +167,12 @@ func (c *respCache) Update(code int, body []byte, header http.Header) {
 	if header != nil {
 		c.header.header = header.Clone()
 	}
+	c.mu.Unlock()
+
+	// 同步更新到存储后端
+	if ds, ok := store.(*diskStorage); ok {
+		if err := ds.persist(c); err != nil {
+			logger.Errorf("缓存写入磁盘失败, cacheKey: %s, err: %v", c.cacheKey, err)
+		}
+	}
 }
@@ -1,7 +1,6 @@
 package web
 
 import (
-	"log"
 	"net/http"
 	"regexp"
 
@@ -12,23 +11,47 @@ import (
 // MatchRouteKey 存储在 gin 上下文的路由匹配字段
 const MatchRouteKey = "matchRoute"
 
+// headHonoredRoutes 需要正常处理 HEAD 请求的路由
+//
+// 其余路由的 HEAD 请求统一返回 200
+var headHonoredRoutes = map[string]struct{}{
+	constant.Reg_Healthz: {},
+	constant.Reg_Readyz:  {},
+}
+
 // globalDftHandler 全局默认兜底的请求处理器
 func globalDftHandler(c *gin.Context) {
-	if c.Request.Method == http.MethodHead {
+	// 依次匹配路由规则, 找到其他的处理器
+	reg, handler, ok := matchRule(c.Request.RequestURI)
+
+	if c.Request.Method == http.MethodHead && !(ok && isHeadHonored(reg)) {
 		c.String(http.StatusOK, "")
 		return
 	}
 
-	// 依次匹配路由规则, 找到其他的处理器
+	if !ok {
+		return
+	}
+	c.Set(MatchRouteKey, reg.String())
+	c.Set(constant.RouteSubMatchGinKey, reg.FindStringSubmatch(c.Request.RequestURI))
+	handler(c)
+}
+
+// isHeadHonored 判断路由是否需要正常处理 HEAD 请求
+func isHeadHonored(reg *regexp.Regexp) bool {
+	_, ok := headHonoredRoutes[reg.String()]
+	return ok
+}
+
+// matchRule 获取第一个匹配 uri 的路由规则
+func matchRule(uri string) (*regexp.Regexp, gin.HandlerFunc, bool) {
 	for _, rule := range rules {
 		reg := rule[0].(*regexp.Regexp)
-		if reg.MatchString(c.Request.RequestURI) {
-			c.Set(MatchRouteKey, reg.String())
-			c.Set(constant.RouteSubMatchGinKey, reg.FindStringSubmatch(c.Request.RequestURI))
-			rule[1].(gin.HandlerFunc)(c)
-			return
+		if reg.MatchString(uri) {
+			return reg, rule[1].(gin.HandlerFunc), true
 		}
 	}
+	return nil, nil, false
 }
 
 // compileRules 编译路由的正则表达式
@@ -37,14 +60,14 @@ func compileRules(rs [][2]any) [][2]any {
 	for _, rule := range rs {
 		reg, err := regexp.Compile(rule[0].(string))
 		if err != nil {
-			log.Printf("路由正则编译失败, pattern: %v, error: %v", rule[0], err)
+			logger.Errorf("路由正则编译失败, pattern: %v, error: %v", rule[0], err)
 			continue
 		}
 		rule[0] = reg
 
 		rawHandler, ok := rule[1].(func(*gin.Context))
 		if !ok {
-			log.Printf("错误的请求处理器, pattern: %v", rule[0])
+			logger.Errorf("错误的请求处理器, pattern: %v", rule[0])
 			continue
 		}
 		var handler gin.HandlerFunc = rawHandler
@@ -0,0 +1,295 @@
+// 健康检查接口, 供反向代理和容器编排工具探测服务状态
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/constant"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/openlist"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/admin"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ProbeTimeout 探测上游服务的超时时间
+	ProbeTimeout = time.Second * 5
+
+	// EmbyProbeUri emby 探测地址, 无需鉴权
+	EmbyProbeUri = "/System/Info/Public"
+
+	// OpenlistProbeUri openlist 探测地址, 使用配置的 token 或登录获取到的 token 访问
+	OpenlistProbeUri = "/api/me"
+
+	// ReadyCacheTTL 就绪检查探测结果的缓存时间, 避免频繁的匿名请求不断探测上游服务
+	ReadyCacheTTL = time.Second * 5
+)
+
+// startTime 程序启动时间
+var startTime = time.Now()
+
+// ProbeResult 上游服务的探测结果
+type ProbeResult struct {
+	Ok      bool   `json:"ok"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Healthz 存活检查, 进程正常运行即返回 200
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"version": constant.CurrentVersion,
+		"uptime":  time.Since(startTime).Truncate(time.Second).String(),
+	})
+}
+
+// readyReport 一次就绪检查的探测结果
+type readyReport struct {
+	at        time.Time              // 探测时间
+	cfg       *config.Config         // 探测时使用的配置
+	emby      ProbeResult            // emby 整体探测结果
+	upstreams map[string]ProbeResult // 每个 emby 上游的探测结果
+	openlist  ProbeResult            // openlist 整体探测结果
+	backends  map[string]ProbeResult // 每个 openlist 后端的探测结果
+}
+
+var (
+	// lastReport 最近一次就绪检查的探测结果
+	lastReport *readyReport
+
+	// reportMutex 保证同一时间只有一个请求在探测上游服务, 其余请求等待并复用探测结果
+	reportMutex sync.Mutex
+)
+
+// Readyz 就绪检查, 探测 emby 和 openlist 是否可用
+//
+// 所有上游服务都可用时返回 200, 否则返回 503;
+// 探测结果缓存 ReadyCacheTTL, 只有携带了管理接口密钥的请求才会返回每个上游的探测详情以及程序状态
+func Readyz(c *gin.Context) {
+	report := getReport()
+
+	ready := report.emby.Ok && report.openlist.Ok
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	if !admin.Authorized(c) {
+		c.JSON(code, gin.H{
+			"ready": ready,
+			"checks": gin.H{
+				"emby":     ProbeResult{Ok: report.emby.Ok, Latency: report.emby.Latency},
+				"openlist": ProbeResult{Ok: report.openlist.Ok, Latency: report.openlist.Latency},
+			},
+		})
+		return
+	}
+
+	cfg := report.cfg
+	c.JSON(code, gin.H{
+		"ready": ready,
+		"checks": gin.H{
+			"emby":             report.emby,
+			"embyUpstreams":    report.upstreams,
+			"openlist":         report.openlist,
+			"openlistBackends": report.backends,
+		},
+		"config": configStatus(),
+		"cache":  cacheStatus(cfg),
+		"ssl": gin.H{
+			"enable":     cfg.Ssl.Enable,
+			"singlePort": cfg.Ssl.SinglePort,
+		},
+	})
+}
+
+// getReport 获取就绪检查的探测结果, 缓存过期或配置发生变更时重新探测
+func getReport() *readyReport {
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+
+	cfg := config.C()
+	if r := lastReport; r != nil && r.cfg == cfg && time.Since(r.at) < ReadyCacheTTL {
+		return r
+	}
+
+	report := readyReport{at: time.Now(), cfg: cfg}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		report.emby, report.upstreams = probeEmby(cfg.Emby)
+	}()
+	go func() {
+		defer wg.Done()
+		report.openlist, report.backends = probeOpenlist(cfg.Openlist)
+	}()
+	wg.Wait()
+
+	lastReport = &report
+	return lastReport
+}
+
+// probe 请求上游地址, 响应码为 200 时视为可用
+//
+// bodyChecker 不为空时, 会对响应体做进一步的校验
+func probe(u string, header http.Header, bodyChecker func([]byte) error) (res ProbeResult) {
+	start := time.Now()
+	defer func() { res.Latency = time.Since(start).Truncate(time.Millisecond).String() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ProbeTimeout)
+	defer cancel()
+	resp, err := https.Get(u).Header(header).Context(ctx).Do()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		res.Error = fmt.Sprintf("响应状态异常: %s", resp.Status)
+		return res
+	}
+
+	if bodyChecker != nil {
+		body, err := io.ReadAll(resp.Body)
+		if err == nil {
+			err = bodyChecker(body)
+		}
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+	}
+	res.Ok = true
+	return res
+}
+
+// probeEmby 探测所有 emby 上游服务器
+//
+// 所有上游都可用才视为 emby 可用, 同时返回每个上游的探测结果
+func probeEmby(cfg *config.Emby) (ProbeResult, map[string]ProbeResult) {
+	ups := cfg.AllUpstreams()
+	results := make([]ProbeResult, len(ups))
+	var wg sync.WaitGroup
+	for i, u := range ups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probe(u.Host+EmbyProbeUri, nil, nil)
+		}()
+	}
+	wg.Wait()
+
+	total := results[0]
+	errs := make([]string, 0)
+	upstreamsRes := make(map[string]ProbeResult, len(ups))
+	for i, u := range ups {
+		res := results[i]
+		upstreamsRes[u.Name] = res
+		if !res.Ok {
+			errs = append(errs, fmt.Sprintf("[%s] %s", u.Name, res.Error))
+		}
+	}
+	if len(errs) > 0 {
+		total.Ok = false
+		total.Error = strings.Join(errs, "; ")
+	}
+	return total, upstreamsRes
+}
+
+// probeOpenlist 探测所有 openlist 后端
+//
+// 任意一个后端可用即视为 openlist 可用, 同时返回每个后端的探测结果
+func probeOpenlist(cfg *config.Openlist) (ProbeResult, map[string]ProbeResult) {
+	bs := cfg.AllBackends()
+	results := make([]ProbeResult, len(bs))
+	var wg sync.WaitGroup
+	for i, b := range bs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := openlist.Token(b)
+			if err != nil {
+				results[i] = ProbeResult{Latency: "0s", Error: err.Error()}
+				return
+			}
+			header := http.Header{"Authorization": []string{token}}
+			results[i] = probe(b.Host+OpenlistProbeUri, header, checkOpenlistBody)
+		}()
+	}
+	wg.Wait()
+
+	total := ProbeResult{}
+	errs := make([]string, 0, len(bs))
+	backendsRes := make(map[string]ProbeResult, len(bs))
+	for i, b := range bs {
+		res := results[i]
+		backendsRes[b.Name] = res
+		if res.Ok && !total.Ok {
+			total = res
+		}
+		if !res.Ok {
+			errs = append(errs, fmt.Sprintf("[%s] %s", b.Name, res.Error))
+		}
+	}
+	if !total.Ok {
+		total.Latency = "0s"
+		total.Error = strings.Join(errs, "; ")
+	}
+	return total, backendsRes
+}
+
+// checkOpenlistBody 校验 openlist 接口响应中的业务状态码
+//
+// openlist 鉴权失败时, http 响应码依旧是 200
+func checkOpenlistBody(body []byte) error {
+	var res struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return fmt.Errorf("响应解析失败: %v", err)
+	}
+	if res.Code != http.StatusOK {
+		return fmt.Errorf("响应状态异常: %d, 消息: %s", res.Code, res.Message)
+	}
+	return nil
+}
+
+// configStatus 配置文件加载状态
+func configStatus() gin.H {
+	status := gin.H{"path": config.FilePath()}
+	lr := config.LastReload()
+	if !lr.Time.IsZero() {
+		status["lastReload"] = lr.Time.Format(time.DateTime)
+	}
+	if lr.Err != nil {
+		status["lastReloadError"] = lr.Err.Error()
+	}
+	return status
+}
+
+// cacheStatus 缓存状态
+func cacheStatus(cfg *config.Config) gin.H {
+	status := gin.H{"enable": cfg.Cache.Enable}
+	if !cfg.Cache.Enable {
+		return status
+	}
+	status["storage"] = cfg.Cache.Storage
+	if stats, err := cache.GetStats(); err == nil {
+		status["stats"] = stats
+	} else {
+		status["error"] = err.Error()
+	}
+	return status
+}
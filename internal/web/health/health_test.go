@@ -0,0 +1,107 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadyz(t *testing.T) {
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != EmbyProbeUri {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"ServerName":"test"}`))
+	}))
+	defer emby.Close()
+
+	var openlistHits atomic.Int32
+	openlist := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openlistHits.Add(1)
+		if r.Header.Get("Authorization") != "valid-token" {
+			w.Write([]byte(`{"code":401,"message":"token is invalidated"}`))
+			return
+		}
+		w.Write([]byte(`{"code":200,"message":"success","data":{}}`))
+	}))
+	defer openlist.Close()
+
+	originC := config.C()
+	defer func() { config.Set(originC) }()
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "ready", token: "valid-token", want: http.StatusOK},
+		{name: "openlist-unauthorized", token: "invalid-token", want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Set(&config.Config{
+				Emby:     &config.Emby{Host: emby.URL},
+				Openlist: &config.Openlist{Host: openlist.URL, Token: tt.token},
+				Cache:    &config.Cache{},
+				Ssl:      &config.Ssl{},
+				Admin:    &config.Admin{Enable: true, Token: "admin-token"},
+			})
+			openlistHits.Store(0)
+
+			readyz := func(adminToken string) (int, map[string]json.RawMessage) {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest(http.MethodGet, "/ge2o/readyz", nil)
+				c.Request.Header.Set("X-Admin-Token", adminToken)
+				Readyz(c)
+
+				var body map[string]json.RawMessage
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				return w.Code, body
+			}
+
+			// 匿名请求只返回整体的探测结果
+			code, body := readyz("")
+			if code != tt.want {
+				t.Fatalf("code = %d, want %d", code, tt.want)
+			}
+			var checks map[string]ProbeResult
+			if err := json.Unmarshal(body["checks"], &checks); err != nil {
+				t.Fatal(err)
+			}
+			if !checks["emby"].Ok || checks["emby"].Latency == "" || checks["openlist"].Latency == "" {
+				t.Errorf("unexpected checks: %v", checks)
+			}
+			if _, ok := checks["embyUpstreams"]; ok || checks["openlist"].Error != "" || body["config"] != nil {
+				t.Errorf("匿名请求不应返回探测详情: %v", checks)
+			}
+
+			// 携带管理接口密钥时返回探测详情, 并复用缓存的探测结果
+			code, body = readyz("admin-token")
+			if code != tt.want {
+				t.Fatalf("code = %d, want %d", code, tt.want)
+			}
+			if err := json.Unmarshal(body["checks"], &checks); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := checks["embyUpstreams"]; !ok || body["config"] == nil {
+				t.Errorf("携带管理接口密钥时应返回探测详情: %s", body["checks"])
+			}
+			if (tt.want == http.StatusOK) == (checks["openlist"].Error != "") {
+				t.Errorf("unexpected openlist check: %v", checks["openlist"])
+			}
+			if hits := openlistHits.Load(); hits != 1 {
+				t.Errorf("缓存时间内不应重复探测, 探测次数: %d", hits)
+			}
+		})
+	}
+}
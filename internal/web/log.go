@@ -1,16 +1,19 @@
 package web
 
 import (
-	"fmt"
-	"strconv"
+	"net/http"
 	"time"
 
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/constant"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
+
 	"github.com/gin-gonic/gin"
 )
 
+// accessLogger 请求日志记录器
+var accessLogger = logs.Module("access")
+
+// CustomLogger 记录请求日志, 服务端异常的请求使用 warn 级别输出
 func CustomLogger(port string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -19,28 +22,18 @@ func CustomLogger(port string) gin.HandlerFunc {
 		c.Next()
 
 		// 记录日志
-		fmt.Printf("%s %s | %s | %s | %s | %s %s | %s %s\n",
-			colors.ToYellow("[ge2o:"+constant.CurrentVersion+"]"),
-			start.Format("2006-01-02 15:04:05"),
-			colorStatusCode(c.Writer.Status()),
-			time.Since(start),
-			c.ClientIP(),
-			colors.ToBlue(port),
-			colors.ToBlue(c.GetString(MatchRouteKey)),
-			colors.ToBlue(c.Request.Method),
-			c.Request.RequestURI,
+		code := c.Writer.Status()
+		record := accessLogger.Info
+		if code >= http.StatusInternalServerError {
+			record = accessLogger.Warn
+		}
+		record(c.Request.Method+" "+c.Request.RequestURI,
+			"status", code,
+			"latency", time.Since(start),
+			"ip", c.ClientIP(),
+			"port", port,
+			"route", c.GetString(MatchRouteKey),
+			"upstream", upstream.Of(c).Name,
 		)
 	}
 }
-
-// colorStatusCode 将响应码打上颜色标记
-func colorStatusCode(code int) string {
-	str := strconv.Itoa(code)
-	if https.IsSuccessCode(code) || https.IsRedirectCode(code) {
-		return colors.ToGreen(str)
-	}
-	if https.IsErrorCode(code) {
-		return colors.ToRed(str)
-	}
-	return colors.ToBlue(str)
-}
@@ -0,0 +1,37 @@
+package web
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// requestsTotal 请求总数
+	requestsTotal = metrics.NewCounterVec("http_requests_total", "处理的 http 请求总数", "route", "method", "code")
+
+	// requestDuration 请求耗时分布
+	requestDuration = metrics.NewHistogramVec("http_request_duration_seconds", "http 请求的处理耗时 (秒)", nil, "route")
+)
+
+// metricsRecorder 记录请求的指标信息
+func metricsRecorder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		// 命中缓存或者被中间件拦截的请求不会进入路由处理器, 这里重新匹配一次
+		route := c.GetString(MatchRouteKey)
+		if route == "" {
+			if reg, _, ok := matchRule(c.Request.RequestURI); ok {
+				route = reg.String()
+			}
+		}
+		requestsTotal.Inc(route, c.Request.Method, strconv.Itoa(c.Writer.Status()))
+		requestDuration.Observe(time.Since(start).Seconds(), route)
+	}
+}
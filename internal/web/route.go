@@ -1,12 +1,13 @@
 package web
 
 import (
-	"log"
-
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/constant"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/metrics"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/emby"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/m3u8"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/strm"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/admin"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/health"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,8 +18,18 @@ import (
 var rules [][2]any
 
 func initRulePatterns() {
-	log.Println(colors.ToBlue("正在初始化路由规则..."))
+	logger.Info("正在初始化路由规则...")
 	rules = compileRules([][2]any{
+		// 管理接口
+		{constant.Reg_Admin, admin.Handle},
+		// Prometheus 指标
+		{constant.Reg_Metrics, metrics.Handle},
+		// 健康检查
+		{constant.Reg_Healthz, health.Healthz},
+		{constant.Reg_Readyz, health.Readyz},
+		// strm 同步生成的链接, 重定向到直链
+		{constant.Reg_Strm, strm.Handle},
+
 		// websocket
 		{constant.Reg_Socket, emby.ProxySocket()},
 
@@ -53,8 +64,12 @@ func initRulePatterns() {
 		{constant.Reg_ResourceMaster, emby.Redirect2Transcode},
 		// main 路由到直链接口
 		{constant.Reg_ResourceMain, emby.Redirect2OpenlistLink},
+		// 自适应清晰度的 m3u8 转码播放列表
+		{constant.Reg_ProxyMaster, m3u8.ProxyMaster},
 		// m3u8 转码播放列表
 		{constant.Reg_ProxyPlaylist, m3u8.ProxyPlaylist},
+		// m3u8 转码播放列表对应的 DASH 清单
+		{constant.Reg_ProxyDash, m3u8.ProxyDash},
 		// ts 重定向到直链
 		{constant.Reg_ProxyTs, m3u8.ProxyTsLink},
 		// m3u8 字幕
@@ -83,7 +98,7 @@ func initRulePatterns() {
 		// 其余资源走重定向回源
 		{constant.Reg_All, emby.ProxyOrigin},
 	})
-	log.Println(colors.ToGreen("路由规则初始化完成"))
+	logger.Info("路由规则初始化完成")
 }
 
 // initRoutes 初始化路由
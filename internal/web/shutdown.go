@@ -0,0 +1,54 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+)
+
+// ShutdownTimeout 停止服务时等待请求处理完毕的最长时间, 可通过启动参数覆盖
+var ShutdownTimeout = time.Second * 30
+
+// FlushTimeout 停止服务时等待缓存落盘的最长时间, 与等待请求的时间分开计算
+const FlushTimeout = time.Second * 30
+
+// shutdown 优雅停止服务
+//
+//  1. 停止接收新连接, 等待处理中的请求完成
+//  2. 超时后强制关闭剩余连接
+//  3. 中断 websocket 等已被劫持的长连接
+//  4. 等待预缓存通道处理完毕, 将缓存落盘
+func shutdown(servers []*http.Server, cancelBase context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	logger.Infof("停止接收新连接, 等待处理中的请求完成, 最长等待: %v", ShutdownTimeout)
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				logger.Warnf("等待请求处理超时, 强制关闭剩余连接 [%s]: %v", srv.Addr, err)
+				srv.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	cancelBase()
+
+	if config.C().Cache.Enable {
+		logger.Info("正在处理剩余的缓存...")
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), FlushTimeout)
+		defer cancelFlush()
+		if err := cache.Flush(flushCtx); err != nil {
+			logger.Warnf("缓存处理未完成: %v", err)
+		}
+	}
+
+	logger.Info("服务已停止")
+}
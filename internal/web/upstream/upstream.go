@@ -0,0 +1,75 @@
+package upstream
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/webport"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// GinKey 当前请求选中的上游服务器在 gin 上下文中的 key
+	GinKey = "upstream"
+
+	// PrefixGinKey 当前请求匹配到的上游路径前缀在 gin 上下文中的 key
+	PrefixGinKey = "upstreamPrefix"
+)
+
+// Selector 根据请求的 Host, 监听端口以及路径前缀选择上游服务器
+//
+// 通过路径前缀匹配时, 会将前缀从请求路径中移除, 后续处理器无需感知前缀
+func Selector() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		port := c.GetString(webport.GinKey)
+		u, prefix := config.C().Emby.SelectUpstream(c.Request.Host, port, c.Request.URL.Path)
+		c.Set(GinKey, u)
+		if prefix == "" {
+			return
+		}
+		c.Set(PrefixGinKey, prefix)
+		stripPrefix(c.Request, prefix)
+	}
+}
+
+// stripPrefix 移除请求路径中的上游前缀
+func stripPrefix(r *http.Request, prefix string) {
+	trim := func(p string) string {
+		if p == "" {
+			return p
+		}
+		p = strings.TrimPrefix(p, prefix)
+		if p == "" || p[0] != '/' {
+			p = "/" + p
+		}
+		return p
+	}
+	r.URL.Path = trim(r.URL.Path)
+	r.URL.RawPath = trim(r.URL.RawPath)
+	r.RequestURI = trim(r.RequestURI)
+}
+
+// Of 获取当前请求选中的上游服务器, 未经过 Selector 时返回默认上游
+func Of(c *gin.Context) *config.EmbyUpstream {
+	if c != nil {
+		if v, ok := c.Get(GinKey); ok {
+			return v.(*config.EmbyUpstream)
+		}
+	}
+	return config.C().Emby.DefaultUpstream()
+}
+
+// Prefix 获取当前请求匹配到的上游路径前缀, 未通过路径前缀匹配时为空
+//
+// 重定向到本程序的其他接口时, 需要在地址前加上前缀
+func Prefix(c *gin.Context) string {
+	return c.GetString(PrefixGinKey)
+}
+
+// BaseUrl 获取客户端访问当前上游使用的根地址, 包含匹配到的路径前缀
+func BaseUrl(c *gin.Context) string {
+	return https.ClientRequestHost(c.Request) + Prefix(c)
+}
@@ -1,75 +1,149 @@
 package web
 
 import (
+	"context"
 	"crypto/tls"
-	"log"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/emby"
-	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/m3u8"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/service/strm"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/cache"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/upstream"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/webport"
 
 	"github.com/gin-gonic/gin"
 )
 
+// logger web 模块日志记录器
+var logger = logs.Module("web")
+
 // Listen 监听指定端口
 func Listen() error {
 	initRulePatterns()
+	cfg := config.C()
+
+	if cfg.Cache.Enable {
+		if err := cache.Init(); err != nil {
+			return err
+		}
+	}
 
-	errChanHTTP, errChanHTTPS := make(chan error, 1), make(chan error, 1)
-	if !config.C.Ssl.Enable {
-		go listenHTTP(errChanHTTP)
-	} else if config.C.Ssl.SinglePort {
-		go listenHTTPS(errChanHTTPS)
-	} else {
-		go listenHTTP(errChanHTTP)
-		go listenHTTPS(errChanHTTPS)
+	if cfg.Path.Index.Enable {
+		path.StartIndexer()
+	}
+	if cfg.StrmSync.Enable {
+		strm.StartScheduler()
+	}
+	if cfg.VideoPreview.Playlist.Persist {
+		loadPlaylists()
+	}
+
+	// baseCtx 作为所有请求的根上下文, 停止服务时取消,
+	// 用于中断 websocket 等已被劫持的长连接
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
+	var servers []*http.Server
+	httpPorts := make([]string, 0)
+	if !cfg.Ssl.Enable || !cfg.Ssl.SinglePort {
+		httpPorts = append(httpPorts, webport.HTTP)
+	}
+	// 上游匹配规则中配置的端口, 额外启动 http 服务
+	for _, port := range cfg.Emby.ListenPorts() {
+		if port == webport.HTTP || (cfg.Ssl.Enable && port == webport.HTTPS) {
+			continue
+		}
+		httpPorts = append(httpPorts, port)
 	}
 
+	errChan := make(chan error, len(httpPorts)+1)
+	for _, port := range httpPorts {
+		srv := newHTTPServer(baseCtx, port)
+		servers = append(servers, srv)
+		go listenHTTP(srv, port, errChan)
+	}
+	if cfg.Ssl.Enable {
+		srv := newHTTPSServer(baseCtx)
+		servers = append(servers, srv)
+		go listenHTTPS(srv, errChan)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigChan)
+
 	select {
-	case err := <-errChanHTTP:
-		log.Fatal("http 服务异常: ", err)
-	case err := <-errChanHTTPS:
-		log.Fatal("https 服务异常: ", err)
+	case err := <-errChan:
+		return err
+	case sig := <-sigChan:
+		logger.Warnf("接收到 %v 信号, 正在停止服务...", sig)
+	}
+
+	shutdown(servers, cancelBase)
+	if config.C().VideoPreview.Playlist.Persist {
+		if err := m3u8.SavePlaylists(); err != nil {
+			logger.Warnf("m3u8 播放列表持久化失败: %v", err)
+		}
 	}
 	return nil
 }
 
+// loadPlaylists 加载持久化的 m3u8 播放列表, 避免重启后所有客户端重新请求 openlist
+func loadPlaylists() {
+	cnt, err := m3u8.LoadPlaylists()
+	if err != nil {
+		logger.Warnf("加载 m3u8 播放列表失败: %v", err)
+		return
+	}
+	if cnt > 0 {
+		logger.Infof("已加载持久化的 m3u8 播放列表, 个数: %d", cnt)
+	}
+}
+
 // initRouter 初始化路由引擎
 func initRouter(r *gin.Engine) {
+	r.Use(upstream.Selector())
+	r.Use(metricsRecorder())
 	r.Use(referrerPolicySetter())
 	r.Use(emby.ApiKeyChecker())
 	r.Use(emby.DownloadStrategyChecker())
-	if config.C.Cache.Enable {
+	if config.C().Cache.Enable {
 		r.Use(cache.CacheableRouteMarker())
 		r.Use(cache.RequestCacher())
 	}
 	initRoutes(r)
 }
 
-// listenHTTP 在指定端口上监听 http 服务
-//
-// 出现错误时, 会写入 errChan 中
-func listenHTTP(errChan chan error) {
+// newHTTPServer 初始化指定端口上的 http 服务
+func newHTTPServer(baseCtx context.Context, port string) *http.Server {
 	r := gin.New()
 	r.Use(gin.Recovery())
-	r.Use(CustomLogger(webport.HTTP))
+	r.Use(CustomLogger(port))
 	r.Use(func(c *gin.Context) {
-		c.Set(webport.GinKey, webport.HTTP)
+		c.Set(webport.GinKey, port)
 	})
 	initRouter(r)
-	log.Printf(colors.ToBlue("在端口【%s】上启动 HTTP 服务"), webport.HTTP)
-	err := r.Run("0.0.0.0:" + webport.HTTP)
-	errChan <- err
-	close(errChan)
+	emby.SetPrefetchHandler(port, r)
+
+	return &http.Server{
+		Addr:        net.JoinHostPort(webport.ListenAddr, port),
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
 }
 
-// listenHTTPS 在指定端口上监听 https 服务
-//
-// 出现错误时, 会写入 errChan 中
-func listenHTTPS(errChan chan error) {
+// newHTTPSServer 初始化 https 服务
+func newHTTPSServer(baseCtx context.Context) *http.Server {
 	r := gin.New()
 	r.Use(gin.Recovery())
 	r.Use(CustomLogger(webport.HTTPS))
@@ -77,17 +151,37 @@ func listenHTTPS(errChan chan error) {
 		c.Set(webport.GinKey, webport.HTTPS)
 	})
 	initRouter(r)
-	log.Printf(colors.ToBlue("在端口【%s】上启动 HTTPS 服务"), webport.HTTPS)
-	ssl := config.C.Ssl
+	emby.SetPrefetchHandler(webport.HTTPS, r)
 
 	srv := &http.Server{
-		Addr:    "0.0.0.0:" + webport.HTTPS,
-		Handler: r,
+		Addr:        net.JoinHostPort(webport.ListenAddr, webport.HTTPS),
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
 	}
 	// 禁用 HTTP/2
 	srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	return srv
+}
 
+// listenHTTP 在指定端口上监听 http 服务
+//
+// 出现错误时, 会写入 errChan 中, 服务被主动关闭时不视为错误
+func listenHTTP(srv *http.Server, port string, errChan chan error) {
+	logger.Infof("在端口【%s】上启动 HTTP 服务", port)
+	err := srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errChan <- fmt.Errorf("http 服务 [%s] 异常: %v", port, err)
+	}
+}
+
+// listenHTTPS 在指定端口上监听 https 服务
+//
+// 出现错误时, 会写入 errChan 中, 服务被主动关闭时不视为错误
+func listenHTTPS(srv *http.Server, errChan chan error) {
+	logger.Infof("在端口【%s】上启动 HTTPS 服务", webport.HTTPS)
+	ssl := config.C().Ssl
 	err := srv.ListenAndServeTLS(ssl.CrtPath(), ssl.KeyPath())
-	errChan <- err
-	close(errChan)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errChan <- fmt.Errorf("https 服务异常: %v", err)
+	}
 }
@@ -1,7 +1,13 @@
 package webport
 
-const (
-	HTTPS  = "8094"
-	HTTP   = "8095"
-	GinKey = "port"
+// GinKey 当前请求的端口在 gin 上下文中的 key
+const GinKey = "port"
+
+// 默认监听端口, 可通过启动参数覆盖
+var (
+	HTTPS = "8094"
+	HTTP  = "8095"
 )
+
+// ListenAddr 服务监听地址, 可通过启动参数覆盖
+var ListenAddr = "0.0.0.0"
@@ -1,30 +1,66 @@
 package main
 
 import (
-	"log"
+	"flag"
+	"fmt"
+	"os"
 
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/config"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/constant"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web"
+	"github.com/AmbitiousJun/go-emby2openlist/v2/internal/web/webport"
 )
 
+// configFile 配置文件路径
+var configFile string
+
+// logger 主程序日志记录器
+var logger = logs.Module("main")
+
+func init() {
+	flag.StringVar(&configFile, "config", "config.yml", "配置文件路径")
+	flag.StringVar(&webport.HTTP, "http-port", webport.HTTP, "http 服务监听端口")
+	flag.StringVar(&webport.HTTPS, "https-port", webport.HTTPS, "https 服务监听端口")
+	flag.StringVar(&webport.ListenAddr, "listen-addr", webport.ListenAddr, "服务监听地址")
+	flag.DurationVar(&web.ShutdownTimeout, "shutdown-timeout", web.ShutdownTimeout, "停止服务时等待请求处理完毕的最长时间")
+}
+
 func main() {
-	log.Println("正在加载配置...")
-	if err := config.ReadFromFile("config.yml"); err != nil {
-		log.Fatal(err)
+	flag.Parse()
+
+	logger.Info("正在加载配置...")
+	if err := config.ReadFromFile(configFile); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 
+	// 携带子命令时, 执行完毕后直接退出, 不启动服务
+	if args := flag.Args(); len(args) > 0 {
+		code := runCommand(args)
+		logs.Close()
+		os.Exit(code)
+	}
+
+	config.Watch()
+
 	printBanner()
 
-	log.Println(colors.ToBlue("正在启动服务..."))
-	if err := web.Listen(); err != nil {
-		log.Fatal(colors.ToRed(err.Error()))
+	logger.Info("正在启动服务...")
+	err := web.Listen()
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	logs.Close()
+	if err != nil {
+		os.Exit(1)
 	}
 }
 
+// printBanner 输出启动横幅, 不经过日志模块
 func printBanner() {
-	log.Printf(colors.ToYellow(`
+	fmt.Fprintf(os.Stderr, colors.ToYellow(`
                                  _           ___                        _ _     _   
                                 | |         |__ \                      | (_)   | |  
   __ _  ___ ______ ___ _ __ ___ | |__  _   _   ) |___  _ __   ___ _ __ | |_ ___| |_ 
@@ -36,5 +72,6 @@ func printBanner() {
 
  Repository: %s
     Version: %s
-	`), constant.RepoAddr, constant.CurrentVersion)
+
+`), constant.RepoAddr, constant.CurrentVersion)
 }